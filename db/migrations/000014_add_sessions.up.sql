@@ -0,0 +1,18 @@
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id UUID NOT NULL,
+    refresh_token_hash BYTEA NOT NULL UNIQUE,
+    device_identifier TEXT NOT NULL,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    rotated_at TIMESTAMP WITHOUT TIME ZONE,
+    revoked_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_family_id ON sessions(family_id);
+
+COMMENT ON COLUMN sessions.family_id IS 'Shared by every refresh token rotated from the same login';
+COMMENT ON COLUMN sessions.refresh_token_hash IS 'SHA-256 of the opaque refresh token; the raw token is never stored';
+COMMENT ON COLUMN sessions.rotated_at IS 'Set when the refresh token is exchanged; presenting it again revokes the family';
@@ -0,0 +1,21 @@
+BEGIN;
+ALTER TABLE users
+    ADD COLUMN "email_verified_at" TIMESTAMP;
+-- Accounts that existed before verification was introduced are trusted as-is
+UPDATE users SET email_verified_at = created_at;
+
+CREATE TABLE email_verification_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_email_verification_tokens_user_id ON email_verification_tokens(user_id);
+
+COMMENT ON COLUMN email_verification_tokens.email IS 'Address the token proves ownership of';
+COMMENT ON COLUMN email_verification_tokens.token_hash IS 'SHA-256 of the emailed verification token; the raw token is never stored';
+COMMIT;
@@ -0,0 +1,43 @@
+BEGIN;
+
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP WITHOUT TIME ZONE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN user_totp.secret IS 'Base32 RFC 6238 shared secret';
+COMMENT ON COLUMN user_totp.enabled_at IS 'NULL while enrollment is pending confirmation with a first code';
+COMMENT ON COLUMN user_totp.last_used_step IS 'Most recent accepted time step; codes at or before it are rejected as replays';
+
+CREATE TABLE totp_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (user_id, code_hash)
+);
+
+COMMENT ON COLUMN totp_recovery_codes.code_hash IS 'SHA-256 of the normalized recovery code; the raw code is never stored';
+
+CREATE TABLE mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    device_identifier TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges(user_id);
+
+COMMENT ON COLUMN mfa_challenges.token_hash IS 'SHA-256 of the mfa pending token returned by login; the raw token is never stored';
+COMMENT ON COLUMN mfa_challenges.public_key IS 'Base64 device public key from the login request, registered once the second factor passes';
+
+COMMIT;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_sessions_user_id_device_identifier;
+
+ALTER TABLE device_keys DROP COLUMN IF EXISTS name;
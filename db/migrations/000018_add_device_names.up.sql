@@ -0,0 +1,5 @@
+ALTER TABLE device_keys ADD COLUMN name TEXT;
+
+CREATE INDEX idx_sessions_user_id_device_identifier ON sessions(user_id, device_identifier);
+
+COMMENT ON COLUMN device_keys.name IS 'User-chosen label shown in device management';
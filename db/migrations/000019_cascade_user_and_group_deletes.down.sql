@@ -0,0 +1,19 @@
+BEGIN;
+
+ALTER TABLE user_groups
+    DROP CONSTRAINT user_groups_group_id_fkey,
+    ADD CONSTRAINT user_groups_group_id_fkey FOREIGN KEY (group_id) REFERENCES groups (id);
+
+ALTER TABLE user_groups
+    DROP CONSTRAINT user_groups_user_id_fkey,
+    ADD CONSTRAINT user_groups_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE messages
+    DROP CONSTRAINT messages_group_id_fkey,
+    ADD CONSTRAINT messages_group_id_fkey FOREIGN KEY (group_id) REFERENCES groups (id);
+
+ALTER TABLE messages
+    DROP CONSTRAINT messages_user_id_fkey,
+    ADD CONSTRAINT messages_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Messages outlive their sender's account but not their group.
+ALTER TABLE messages
+    DROP CONSTRAINT messages_user_id_fkey,
+    ADD CONSTRAINT messages_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE messages
+    DROP CONSTRAINT messages_group_id_fkey,
+    ADD CONSTRAINT messages_group_id_fkey FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE;
+
+ALTER TABLE user_groups
+    DROP CONSTRAINT user_groups_user_id_fkey,
+    ADD CONSTRAINT user_groups_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE user_groups
+    DROP CONSTRAINT user_groups_group_id_fkey,
+    ADD CONSTRAINT user_groups_group_id_fkey FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE;
+
+COMMIT;
@@ -0,0 +1,37 @@
+BEGIN;
+
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    last_login_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+COMMENT ON COLUMN user_identities.issuer IS 'OpenID Connect issuer URL (iss claim)';
+COMMENT ON COLUMN user_identities.subject IS 'Stable user identifier at the issuer (sub claim)';
+COMMENT ON COLUMN user_identities.email IS 'Email the provider reported when the identity was last used; informational only';
+
+CREATE TABLE oidc_login_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state_hash BYTEA NOT NULL UNIQUE,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    device_identifier TEXT,
+    public_key TEXT,
+    link_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN oidc_login_states.state_hash IS 'SHA-256 of the OAuth state parameter; the raw state is never stored';
+COMMENT ON COLUMN oidc_login_states.code_verifier IS 'PKCE verifier sent with the code exchange';
+COMMENT ON COLUMN oidc_login_states.link_user_id IS 'Set when a signed-in user is linking an identity instead of logging in';
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
+
+COMMIT;
@@ -0,0 +1,34 @@
+BEGIN;
+
+CREATE TABLE webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    name TEXT,
+    last_used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+COMMENT ON COLUMN webauthn_credentials.credential_id IS 'Raw credential ID chosen by the authenticator';
+COMMENT ON COLUMN webauthn_credentials.public_key IS 'COSE_Key encoded credential public key';
+COMMENT ON COLUMN webauthn_credentials.sign_count IS 'Last signature counter seen; a counter that does not increase suggests a cloned authenticator';
+
+CREATE TABLE webauthn_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    challenge_hash BYTEA NOT NULL UNIQUE,
+    ceremony TEXT NOT NULL CHECK (ceremony IN ('registration', 'authentication')),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN webauthn_challenges.challenge_hash IS 'SHA-256 of the base64url challenge; the raw challenge is never stored';
+COMMENT ON COLUMN webauthn_challenges.user_id IS 'Account registering a passkey; NULL for discoverable-credential logins';
+
+COMMIT;
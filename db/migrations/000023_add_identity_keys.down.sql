@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE oidc_login_states
+    DROP COLUMN IF EXISTS identity_key,
+    DROP COLUMN IF EXISTS device_key_signature;
+
+ALTER TABLE mfa_challenges
+    DROP COLUMN IF EXISTS identity_key,
+    DROP COLUMN IF EXISTS device_key_signature;
+
+ALTER TABLE device_keys DROP COLUMN IF EXISTS signature;
+
+DROP TABLE IF EXISTS user_identity_keys;
+
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+
+CREATE TABLE user_identity_keys (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN user_identity_keys.public_key IS 'Long-term Ed25519 public key that signs the user''s device keys';
+
+ALTER TABLE device_keys ADD COLUMN signature BYTEA;
+
+COMMENT ON COLUMN device_keys.signature IS 'Ed25519 signature by the user''s identity key over the device key; NULL for keys registered before signing was required';
+
+ALTER TABLE mfa_challenges
+    ADD COLUMN device_key_signature TEXT NOT NULL DEFAULT '',
+    ADD COLUMN identity_key TEXT;
+
+ALTER TABLE oidc_login_states
+    ADD COLUMN device_key_signature TEXT,
+    ADD COLUMN identity_key TEXT;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS device_keys_transparency_log ON device_keys;
+DROP FUNCTION IF EXISTS log_device_key_change();
+DROP TABLE IF EXISTS key_transparency_tree_heads;
+DROP TABLE IF EXISTS key_transparency_entries;
+DROP FUNCTION IF EXISTS forbid_sequenced_key_transparency_change();
+
+COMMIT;
@@ -0,0 +1,76 @@
+BEGIN;
+
+CREATE TABLE key_transparency_entries (
+    id BIGSERIAL PRIMARY KEY,
+    operation TEXT NOT NULL CHECK (operation IN ('insert', 'update', 'delete')),
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    public_key BYTEA NOT NULL,
+    signature BYTEA,
+    changed_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    leaf_index BIGINT UNIQUE,
+    leaf_data BYTEA,
+    leaf_hash BYTEA
+);
+
+CREATE INDEX idx_key_transparency_entries_pending ON key_transparency_entries(id) WHERE leaf_index IS NULL;
+CREATE INDEX idx_key_transparency_entries_user_device ON key_transparency_entries(user_id, device_identifier, leaf_index);
+
+COMMENT ON COLUMN key_transparency_entries.user_id IS 'Not a foreign key: entries outlive the account so its key deletions stay provable';
+COMMENT ON COLUMN key_transparency_entries.leaf_index IS 'Position in the Merkle log, assigned by the sequencer; NULL while pending';
+COMMENT ON COLUMN key_transparency_entries.leaf_data IS 'Exact bytes hashed into the log (JSON), so clients can recompute the leaf hash';
+COMMENT ON COLUMN key_transparency_entries.leaf_hash IS 'RFC 6962 leaf hash: SHA-256(0x00 || leaf_data)';
+
+CREATE TABLE key_transparency_tree_heads (
+    tree_size BIGINT PRIMARY KEY,
+    root_hash BYTEA NOT NULL,
+    timestamp_ms BIGINT NOT NULL,
+    signature BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN key_transparency_tree_heads.signature IS 'Ed25519 signature by the log key over the tree size, timestamp and root hash';
+
+-- Every change to key material in device_keys is queued for the log. Updates
+-- that only touch last_seen_at or name are not key changes and are skipped.
+CREATE FUNCTION log_device_key_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO key_transparency_entries (operation, user_id, device_identifier, public_key, signature)
+        VALUES ('delete', OLD.user_id, OLD.device_identifier, OLD.public_key, OLD.signature);
+        RETURN OLD;
+    END IF;
+    IF TG_OP = 'UPDATE'
+        AND OLD.public_key IS NOT DISTINCT FROM NEW.public_key
+        AND OLD.signature IS NOT DISTINCT FROM NEW.signature THEN
+        RETURN NEW;
+    END IF;
+    INSERT INTO key_transparency_entries (operation, user_id, device_identifier, public_key, signature)
+    VALUES (lower(TG_OP), NEW.user_id, NEW.device_identifier, NEW.public_key, NEW.signature);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER device_keys_transparency_log
+AFTER INSERT OR UPDATE OR DELETE ON device_keys
+FOR EACH ROW EXECUTE FUNCTION log_device_key_change();
+
+-- Sequenced entries are append-only.
+CREATE FUNCTION forbid_sequenced_key_transparency_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'key transparency entry % is already sequenced and cannot change', OLD.id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER key_transparency_entries_append_only
+BEFORE UPDATE OR DELETE ON key_transparency_entries
+FOR EACH ROW WHEN (OLD.leaf_index IS NOT NULL)
+EXECUTE FUNCTION forbid_sequenced_key_transparency_change();
+
+-- Start the log from the keys that already exist.
+INSERT INTO key_transparency_entries (operation, user_id, device_identifier, public_key, signature, changed_at)
+SELECT 'insert', user_id, device_identifier, public_key, signature, created_at
+FROM device_keys
+ORDER BY created_at, id;
+
+COMMIT;
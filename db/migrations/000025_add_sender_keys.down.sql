@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS sender_device_id,
+    DROP COLUMN IF EXISTS sender_key_id;
+
+DROP TABLE IF EXISTS sender_key_distributions;
+DROP TABLE IF EXISTS sender_keys;
+
+COMMIT;
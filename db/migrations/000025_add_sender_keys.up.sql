@@ -0,0 +1,39 @@
+BEGIN;
+
+CREATE TABLE sender_keys (
+    id UUID PRIMARY KEY,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    sender_id UUID NOT NULL,
+    sender_device_id TEXT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    FOREIGN KEY (sender_id, sender_device_id) REFERENCES device_keys(user_id, device_identifier) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE sender_keys IS 'Sender-key chains, one per sending device and group until the sender rotates it; the key material itself only ever leaves the device sealed to each recipient device';
+
+CREATE INDEX idx_sender_keys_group_sender ON sender_keys (group_id, sender_id, sender_device_id);
+
+CREATE TABLE sender_key_distributions (
+    key_id UUID NOT NULL REFERENCES sender_keys(id) ON DELETE CASCADE,
+    recipient_user_id UUID NOT NULL,
+    recipient_device_id TEXT NOT NULL,
+    eph_pub_key BYTEA NOT NULL,
+    key_nonce BYTEA NOT NULL,
+    sealed_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (key_id, recipient_user_id, recipient_device_id)
+);
+
+COMMENT ON TABLE sender_key_distributions IS 'A sender key distribution message sealed to one recipient device. Rows outlive the recipient''s membership and device so the server knows who has seen a key and can demand a rotation';
+COMMENT ON COLUMN sender_key_distributions.sealed_key IS 'Distribution message (chain key and signing key) boxed to the recipient device key with the sender''s ephemeral key, like a message envelope';
+
+CREATE INDEX idx_sender_key_distributions_recipient ON sender_key_distributions (recipient_user_id, recipient_device_id, created_at);
+
+ALTER TABLE messages
+    ADD COLUMN sender_key_id UUID,
+    ADD COLUMN sender_device_id TEXT;
+
+COMMENT ON COLUMN messages.sender_key_id IS 'Sender key the ciphertext is encrypted under; NULL for messages that carry per-device key_envelopes';
+COMMENT ON COLUMN messages.sender_device_id IS 'Device that sent a sender-key message';
+
+COMMIT;
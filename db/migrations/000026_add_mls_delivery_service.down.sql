@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS mls_epoch;
+
+DROP TABLE IF EXISTS mls_key_packages;
+DROP TABLE IF EXISTS mls_welcomes;
+DROP TABLE IF EXISTS mls_commits;
+DROP TABLE IF EXISTS mls_groups;
+
+COMMIT;
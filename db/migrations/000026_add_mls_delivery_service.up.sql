@@ -0,0 +1,57 @@
+BEGIN;
+
+CREATE TABLE mls_groups (
+    group_id UUID PRIMARY KEY REFERENCES groups(id) ON DELETE CASCADE,
+    epoch BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON COLUMN mls_groups.epoch IS 'Current MLS epoch; the next accepted Commit must be built on it';
+
+CREATE TABLE mls_commits (
+    group_id UUID NOT NULL REFERENCES mls_groups(group_id) ON DELETE CASCADE,
+    epoch BIGINT NOT NULL,
+    sender_id UUID NOT NULL,
+    sender_device_id TEXT NOT NULL,
+    commit_message BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, epoch)
+);
+
+COMMENT ON COLUMN mls_commits.epoch IS 'Epoch the Commit was built on; applying it moves the group to epoch + 1';
+COMMENT ON COLUMN mls_commits.commit_message IS 'MLSMessage carrying the Commit, as sent by the committer';
+
+CREATE TABLE mls_welcomes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES mls_groups(group_id) ON DELETE CASCADE,
+    epoch BIGINT NOT NULL,
+    recipient_user_id UUID NOT NULL,
+    recipient_device_id TEXT NOT NULL,
+    welcome_message BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    FOREIGN KEY (recipient_user_id, recipient_device_id) REFERENCES device_keys(user_id, device_identifier) ON DELETE CASCADE
+);
+
+COMMENT ON COLUMN mls_welcomes.epoch IS 'Epoch the new member joins at';
+
+CREATE INDEX idx_mls_welcomes_recipient ON mls_welcomes (recipient_user_id, recipient_device_id, created_at);
+
+CREATE TABLE mls_key_packages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    key_package BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    FOREIGN KEY (user_id, device_identifier) REFERENCES device_keys(user_id, device_identifier) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE mls_key_packages IS 'Unclaimed one-time MLS KeyPackages; claiming one deletes it';
+
+CREATE INDEX idx_mls_key_packages_device ON mls_key_packages (user_id, device_identifier, created_at);
+
+ALTER TABLE messages ADD COLUMN mls_epoch BIGINT;
+
+COMMENT ON COLUMN messages.mls_epoch IS 'Epoch of an MLS application message; NULL for messages in groups that do not use MLS';
+
+COMMIT;
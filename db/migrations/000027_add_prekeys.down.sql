@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS device_one_time_prekeys;
+DROP TABLE IF EXISTS device_signed_prekeys;
+
+COMMIT;
@@ -0,0 +1,34 @@
+BEGIN;
+
+CREATE TABLE device_signed_prekeys (
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    key_id BIGINT NOT NULL,
+    public_key BYTEA NOT NULL,
+    signature BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, device_identifier),
+    FOREIGN KEY (user_id, device_identifier) REFERENCES device_keys(user_id, device_identifier) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE device_signed_prekeys IS 'Current X3DH signed prekey of each device; uploading a new one replaces it';
+COMMENT ON COLUMN device_signed_prekeys.key_id IS 'Client-chosen ID the initiator echoes back so the device knows which private key to use';
+COMMENT ON COLUMN device_signed_prekeys.public_key IS 'Curve25519 public key bytes';
+COMMENT ON COLUMN device_signed_prekeys.signature IS 'Ed25519 signature by the user''s identity key over the signed prekey';
+
+CREATE TABLE device_one_time_prekeys (
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    key_id BIGINT NOT NULL,
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, device_identifier, key_id),
+    FOREIGN KEY (user_id, device_identifier) REFERENCES device_keys(user_id, device_identifier) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE device_one_time_prekeys IS 'Unclaimed X3DH one-time prekeys; claiming one deletes it';
+COMMENT ON COLUMN device_one_time_prekeys.public_key IS 'Curve25519 public key bytes';
+
+CREATE INDEX idx_device_one_time_prekeys_created ON device_one_time_prekeys (user_id, device_identifier, created_at);
+
+COMMIT;
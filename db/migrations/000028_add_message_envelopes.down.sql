@@ -0,0 +1,26 @@
+BEGIN;
+
+ALTER TABLE messages ADD COLUMN key_envelopes JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+UPDATE messages m
+SET key_envelopes = e.envelopes
+FROM (
+    SELECT message_id, jsonb_agg(jsonb_build_object(
+        'deviceId', device_id,
+        'ephPubKey', translate(encode(eph_pub_key, 'base64'), E'\n', ''),
+        'keyNonce', translate(encode(key_nonce, 'base64'), E'\n', ''),
+        'sealedKey', translate(encode(sealed_key, 'base64'), E'\n', '')
+    )) AS envelopes
+    FROM message_envelopes
+    GROUP BY message_id
+) e
+WHERE m.id = e.message_id;
+
+ALTER TABLE messages ALTER COLUMN key_envelopes DROP DEFAULT;
+
+COMMENT ON COLUMN messages.key_envelopes IS 'JSON array of per-recipient sealed symmetric keys. Each element: {deviceId, ephPubKey, keyNonce, sealedKey}';
+COMMENT ON COLUMN messages.sender_key_id IS 'Sender key the ciphertext is encrypted under; NULL for messages that carry per-device key_envelopes';
+
+DROP TABLE IF EXISTS message_envelopes;
+
+COMMIT;
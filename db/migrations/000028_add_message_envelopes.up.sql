@@ -0,0 +1,32 @@
+BEGIN;
+
+CREATE TABLE message_envelopes (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    eph_pub_key BYTEA NOT NULL,
+    key_nonce BYTEA NOT NULL,
+    sealed_key BYTEA NOT NULL,
+    PRIMARY KEY (message_id, device_id)
+);
+
+COMMENT ON TABLE message_envelopes IS 'Message key sealed to one recipient device; each device only syncs its own';
+COMMENT ON COLUMN message_envelopes.sealed_key IS 'Message key boxed to the device key with the sender''s ephemeral key';
+
+-- Envelopes whose fields are not valid base64 could never have been opened,
+-- so they are skipped rather than failing the migration.
+INSERT INTO message_envelopes (message_id, device_id, eph_pub_key, key_nonce, sealed_key)
+SELECT m.id, e->>'deviceId', decode(e->>'ephPubKey', 'base64'), decode(e->>'keyNonce', 'base64'), decode(e->>'sealedKey', 'base64')
+FROM messages m
+CROSS JOIN LATERAL jsonb_array_elements(m.key_envelopes) AS e
+WHERE jsonb_typeof(m.key_envelopes) = 'array'
+AND e->>'deviceId' IS NOT NULL
+AND e->>'ephPubKey' ~ '^([A-Za-z0-9+/]{4})*([A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$'
+AND e->>'keyNonce' ~ '^([A-Za-z0-9+/]{4})*([A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$'
+AND e->>'sealedKey' ~ '^([A-Za-z0-9+/]{4})*([A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$'
+ON CONFLICT (message_id, device_id) DO NOTHING;
+
+ALTER TABLE messages DROP COLUMN key_envelopes;
+
+COMMENT ON COLUMN messages.sender_key_id IS 'Sender key the ciphertext is encrypted under; NULL for messages that carry per-device message_envelopes';
+
+COMMIT;
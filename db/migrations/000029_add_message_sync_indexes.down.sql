@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_messages_group_id_created_at_id;
+
+COMMIT;
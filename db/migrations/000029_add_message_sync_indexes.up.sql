@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Keyset pagination walks each group's messages in (created_at, id) order.
+CREATE INDEX idx_messages_group_id_created_at_id ON messages (group_id, created_at, id);
+
+COMMIT;
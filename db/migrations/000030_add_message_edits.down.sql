@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS message_edit_envelopes;
+DROP TABLE IF EXISTS message_edits;
+
+COMMIT;
@@ -0,0 +1,32 @@
+BEGIN;
+
+CREATE TABLE message_edits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    ciphertext BYTEA NOT NULL,
+    msg_nonce BYTEA NOT NULL,
+    sender_key_id UUID,
+    sender_device_id TEXT,
+    mls_epoch BIGINT,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    replaced_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+COMMENT ON TABLE message_edits IS 'Previous versions of edited messages, copied from messages before each edit';
+COMMENT ON COLUMN message_edits.created_at IS 'When this version was written: the message''s created_at or the time of the edit that produced it';
+COMMENT ON COLUMN message_edits.replaced_at IS 'When the next edit replaced this version';
+
+CREATE INDEX idx_message_edits_message_id ON message_edits (message_id, replaced_at);
+
+CREATE TABLE message_edit_envelopes (
+    edit_id UUID NOT NULL REFERENCES message_edits(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    eph_pub_key BYTEA NOT NULL,
+    key_nonce BYTEA NOT NULL,
+    sealed_key BYTEA NOT NULL,
+    PRIMARY KEY (edit_id, device_id)
+);
+
+COMMENT ON TABLE message_edit_envelopes IS 'Envelopes of a previous message version, moved out of message_envelopes by the edit';
+
+COMMIT;
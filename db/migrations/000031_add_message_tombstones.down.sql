@@ -0,0 +1,9 @@
+BEGIN;
+
+-- Tombstones have no content left to show.
+DELETE FROM messages WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_messages_deleted_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
+
+COMMIT;
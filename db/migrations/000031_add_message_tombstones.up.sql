@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP WITHOUT TIME ZONE;
+
+COMMENT ON COLUMN messages.deleted_at IS 'When the message was deleted for everyone; the row stays as a tombstone without ciphertext or envelopes';
+
+-- Incremental syncs look up tombstones by deletion time.
+CREATE INDEX idx_messages_deleted_at ON messages (deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS message_reactions;
+ALTER TABLE groups DROP COLUMN IF EXISTS encrypted_reactions;
+
+COMMIT;
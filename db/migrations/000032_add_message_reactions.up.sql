@@ -0,0 +1,20 @@
+BEGIN;
+
+ALTER TABLE groups ADD COLUMN encrypted_reactions BOOLEAN NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN groups.encrypted_reactions IS 'Whether new reactions in the group are encrypted payloads instead of plaintext emoji';
+
+CREATE TABLE message_reactions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction TEXT NOT NULL,
+    encrypted BOOLEAN NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (message_id, user_id, reaction)
+);
+
+COMMENT ON TABLE message_reactions IS 'Reactions to messages, one row per (message, user, reaction)';
+COMMENT ON COLUMN message_reactions.reaction IS 'The emoji, or the base64 encrypted reaction payload when encrypted';
+COMMENT ON COLUMN message_reactions.encrypted IS 'Whether the group used encrypted reactions when this reaction was added';
+
+COMMIT;
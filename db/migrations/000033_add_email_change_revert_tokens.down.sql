@@ -0,0 +1,4 @@
+BEGIN;
+DROP INDEX IF EXISTS idx_email_change_revert_tokens_user_id;
+DROP TABLE IF EXISTS email_change_revert_tokens;
+COMMIT;
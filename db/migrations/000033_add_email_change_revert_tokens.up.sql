@@ -0,0 +1,16 @@
+BEGIN;
+CREATE TABLE email_change_revert_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email VARCHAR(255) NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_email_change_revert_tokens_user_id ON email_change_revert_tokens(user_id);
+
+COMMENT ON COLUMN email_change_revert_tokens.old_email IS 'Address the account had when the change was requested, restored by the token';
+COMMENT ON COLUMN email_change_revert_tokens.token_hash IS 'SHA-256 of the token emailed to the old address; the raw token is never stored';
+COMMIT;
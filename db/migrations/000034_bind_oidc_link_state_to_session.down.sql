@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE oidc_login_states
+    DROP COLUMN link_session_id;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+ALTER TABLE oidc_login_states
+    ADD COLUMN link_session_id UUID;
+
+COMMENT ON COLUMN oidc_login_states.link_session_id IS 'Session family that started a link; only that session may complete it';
+COMMIT;
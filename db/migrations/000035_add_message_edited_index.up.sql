@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Incremental syncs look up edited messages by edit time.
+CREATE INDEX idx_messages_edited_at ON messages (updated_at) WHERE updated_at > created_at AND deleted_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE mfa_challenges
+    DROP COLUMN reset_identity_key;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+ALTER TABLE mfa_challenges
+    ADD COLUMN reset_identity_key BOOLEAN NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN mfa_challenges.reset_identity_key IS 'Login asked to replace the account''s identity key if the uploaded one does not match';
+COMMIT;
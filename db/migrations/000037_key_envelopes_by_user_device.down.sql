@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TABLE message_edit_envelopes DROP CONSTRAINT message_edit_envelopes_pkey;
+DELETE FROM message_edit_envelopes a
+USING message_edit_envelopes b
+WHERE a.edit_id = b.edit_id AND a.device_id = b.device_id AND a.user_id > b.user_id;
+ALTER TABLE message_edit_envelopes DROP COLUMN user_id;
+ALTER TABLE message_edit_envelopes ADD PRIMARY KEY (edit_id, device_id);
+
+ALTER TABLE message_envelopes DROP CONSTRAINT message_envelopes_pkey;
+DELETE FROM message_envelopes a
+USING message_envelopes b
+WHERE a.message_id = b.message_id AND a.device_id = b.device_id AND a.user_id > b.user_id;
+ALTER TABLE message_envelopes DROP COLUMN user_id;
+ALTER TABLE message_envelopes ADD PRIMARY KEY (message_id, device_id);
+
+COMMIT;
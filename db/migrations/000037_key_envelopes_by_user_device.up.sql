@@ -0,0 +1,36 @@
+BEGIN;
+
+-- Device identifiers are only unique per user, so an envelope has to name the
+-- recipient user as well as the device.
+ALTER TABLE message_envelopes ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE message_envelopes DROP CONSTRAINT message_envelopes_pkey;
+
+-- Existing envelopes go to every user with a device of that identifier; only
+-- the one holding the device key can open it. Envelopes of devices that are
+-- gone can't be opened by anyone any more.
+INSERT INTO message_envelopes (message_id, user_id, device_id, eph_pub_key, key_nonce, sealed_key)
+SELECT me.message_id, dk.user_id, me.device_id, me.eph_pub_key, me.key_nonce, me.sealed_key
+FROM message_envelopes me
+JOIN device_keys dk ON dk.device_identifier = me.device_id
+WHERE me.user_id IS NULL;
+DELETE FROM message_envelopes WHERE user_id IS NULL;
+
+ALTER TABLE message_envelopes ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE message_envelopes ADD PRIMARY KEY (message_id, user_id, device_id);
+
+ALTER TABLE message_edit_envelopes ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE message_edit_envelopes DROP CONSTRAINT message_edit_envelopes_pkey;
+
+INSERT INTO message_edit_envelopes (edit_id, user_id, device_id, eph_pub_key, key_nonce, sealed_key)
+SELECT mee.edit_id, dk.user_id, mee.device_id, mee.eph_pub_key, mee.key_nonce, mee.sealed_key
+FROM message_edit_envelopes mee
+JOIN device_keys dk ON dk.device_identifier = mee.device_id
+WHERE mee.user_id IS NULL;
+DELETE FROM message_edit_envelopes WHERE user_id IS NULL;
+
+ALTER TABLE message_edit_envelopes ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE message_edit_envelopes ADD PRIMARY KEY (edit_id, user_id, device_id);
+
+COMMENT ON COLUMN message_envelopes.user_id IS 'Recipient user; device_id is only unique per user';
+
+COMMIT;
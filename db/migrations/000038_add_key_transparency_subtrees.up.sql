@@ -0,0 +1,37 @@
+BEGIN;
+
+-- Hashes of the complete subtrees of the key transparency log. The log is
+-- append-only, so a subtree never changes once its last leaf is sequenced,
+-- and any proof can be built from O(log^2 n) of these instead of every leaf.
+CREATE TABLE key_transparency_subtrees (
+    level SMALLINT NOT NULL,
+    start_index BIGINT NOT NULL,
+    hash BYTEA NOT NULL,
+    PRIMARY KEY (level, start_index)
+);
+
+COMMENT ON COLUMN key_transparency_subtrees.level IS 'The subtree covers 2^level leaves from start_index; level 0 holds the leaf hashes';
+
+-- Build the subtrees of the leaves sequenced so far, one level at a time.
+INSERT INTO key_transparency_subtrees (level, start_index, hash)
+SELECT 0, leaf_index, leaf_hash
+FROM key_transparency_entries
+WHERE leaf_index IS NOT NULL;
+
+DO $$
+DECLARE
+    lvl INT := 1;
+BEGIN
+    LOOP
+        INSERT INTO key_transparency_subtrees (level, start_index, hash)
+        SELECT lvl, l.start_index, sha256('\x01'::bytea || l.hash || r.hash)
+        FROM key_transparency_subtrees l
+        JOIN key_transparency_subtrees r
+            ON r.level = l.level AND r.start_index = l.start_index + (1::bigint << (lvl - 1))
+        WHERE l.level = lvl - 1 AND l.start_index % (1::bigint << lvl) = 0;
+        EXIT WHEN NOT FOUND;
+        lvl := lvl + 1;
+    END LOOP;
+END $$;
+
+COMMIT;
@@ -3,12 +3,14 @@ INSERT INTO device_keys (
     user_id,
     device_identifier,
     public_key,
+    signature,
     last_seen_at
 ) VALUES (
-    $1, $2, $3, now()
+    $1, $2, $3, $4, now()
 )
 ON CONFLICT (user_id, device_identifier) DO UPDATE SET
     public_key = EXCLUDED.public_key,
+    signature = EXCLUDED.signature,
     last_seen_at = now()
 RETURNING *;
 
@@ -22,6 +24,15 @@ SELECT * FROM device_keys
 WHERE user_id = $1
 ORDER BY created_at DESC;
 
+-- name: GetGroupDeviceIdentifiers :many
+-- Every device of every current member of the group, i.e. the devices a
+-- message to the group must carry an envelope for.
+SELECT dk.user_id, dk.device_identifier
+FROM device_keys dk
+JOIN user_groups ug ON ug.user_id = dk.user_id
+WHERE ug.group_id = $1
+ORDER BY dk.user_id, dk.device_identifier;
+
 -- name: UpdateDeviceKeyLastSeen :exec
 UPDATE device_keys
 SET last_seen_at = now()
@@ -35,3 +46,19 @@ WHERE user_id = $1 AND device_identifier = $2;
 DELETE FROM device_keys
 WHERE user_id = $1;
 
+
+-- name: RenameDeviceKey :one
+UPDATE device_keys
+SET name = $3
+WHERE user_id = $1 AND device_identifier = $2
+RETURNING *;
+
+-- name: DeleteOtherDeviceKeysForUser :many
+DELETE FROM device_keys
+WHERE user_id = $1 AND device_identifier <> $2
+RETURNING device_identifier;
+
+-- name: UpdateDeviceKeySignature :execrows
+UPDATE device_keys
+SET signature = $3
+WHERE user_id = $1 AND device_identifier = $2;
@@ -0,0 +1,20 @@
+-- name: InsertEmailChangeRevertToken :exec
+INSERT INTO email_change_revert_tokens (
+    user_id,
+    old_email,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4
+);
+
+-- name: GetEmailChangeRevertTokenByHashForUpdate :one
+SELECT * FROM email_change_revert_tokens
+WHERE token_hash = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: InvalidateEmailChangeRevertTokensForUser :exec
+UPDATE email_change_revert_tokens
+SET used_at = now()
+WHERE user_id = $1 AND used_at IS NULL;
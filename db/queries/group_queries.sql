@@ -2,10 +2,10 @@
 SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at" FROM groups;
 
 -- name: GetGroupById :one
-SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at" FROM groups WHERE id = $1;
+SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at", "encrypted_reactions" FROM groups WHERE id = $1;
 
 -- name: GetGroupsForUser :many
-SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, groups.updated_at,
+SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, groups.updated_at, groups.encrypted_reactions,
 json_agg(jsonb_build_object('id', u2.id, 'username', u2.username, 'email', u2.email, 'admin', ug2.admin, 'invited_at', ug2.created_at))::text AS group_users 
 FROM groups
 JOIN user_groups ug ON ug.group_id = groups.id
@@ -27,6 +27,7 @@ SELECT
     g.end_time,
     g.created_at,
     g.updated_at,
+    g.encrypted_reactions,
     (SELECT ug_check.admin FROM user_groups ug_check WHERE ug_check.group_id = g.id AND ug_check.user_id = sqlc.arg('requesting_user_id')) AS admin, -- Admin status of the requesting user for THIS group
     COALESCE(
         (SELECT json_agg(jsonb_build_object('id', u.id, 'username', u.username, 'email', u.email, 'admin', ug.admin, 'invited_at', ug.created_at))::text
@@ -52,9 +53,10 @@ SET
     "description" = coalesce(sqlc.narg('description'), "description"),
     "location" = coalesce(sqlc.narg('location'), "location"),
     "image_url" = coalesce(sqlc.narg('image_url'), "image_url"),
-    "blurhash" = coalesce(sqlc.narg('blurhash'), "blurhash")
+    "blurhash" = coalesce(sqlc.narg('blurhash'), "blurhash"),
+    "encrypted_reactions" = coalesce(sqlc.narg('encrypted_reactions'), "encrypted_reactions")
 WHERE id = $1
-RETURNING "id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "created_at", "updated_at";
+RETURNING "id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "created_at", "updated_at", "encrypted_reactions";
 
 -- name: DeleteGroup :one
 DELETE FROM groups
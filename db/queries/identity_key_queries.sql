@@ -0,0 +1,26 @@
+-- name: GetUserIdentityKey :one
+SELECT * FROM user_identity_keys
+WHERE user_id = $1;
+
+-- name: InsertUserIdentityKey :one
+-- Sets the identity key on first use. Returns no rows if the user already has one.
+INSERT INTO user_identity_keys (
+    user_id,
+    public_key
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (user_id) DO NOTHING
+RETURNING *;
+
+-- name: ReplaceUserIdentityKey :one
+INSERT INTO user_identity_keys (
+    user_id,
+    public_key
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (user_id) DO UPDATE SET
+    public_key = EXCLUDED.public_key,
+    updated_at = now()
+RETURNING *;
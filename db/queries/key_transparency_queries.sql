@@ -0,0 +1,68 @@
+-- name: LockKeyTransparencyLog :exec
+-- Serializes sequencing across server instances for the rest of the transaction.
+SELECT pg_advisory_xact_lock(hashtext('key_transparency_log'));
+
+-- name: GetPendingKeyTransparencyEntries :many
+SELECT * FROM key_transparency_entries
+WHERE leaf_index IS NULL
+ORDER BY id
+LIMIT $1;
+
+-- name: SequenceKeyTransparencyEntry :exec
+UPDATE key_transparency_entries
+SET
+    leaf_index = sqlc.arg(leaf_index)::bigint,
+    leaf_data = sqlc.arg(leaf_data),
+    leaf_hash = sqlc.arg(leaf_hash)
+WHERE id = sqlc.arg(id) AND leaf_index IS NULL;
+
+-- name: GetKeyTransparencyLeafHashes :many
+SELECT leaf_hash FROM key_transparency_entries
+WHERE leaf_index >= sqlc.arg(start_index)::bigint AND leaf_index < sqlc.arg(end_index)::bigint
+ORDER BY leaf_index;
+
+-- name: InsertKeyTransparencySubtrees :exec
+INSERT INTO key_transparency_subtrees (level, start_index, hash)
+SELECT * FROM unnest(
+    sqlc.arg(levels)::smallint[],
+    sqlc.arg(start_indexes)::bigint[],
+    sqlc.arg(hashes)::bytea[]
+);
+
+-- name: GetKeyTransparencySubtrees :many
+SELECT * FROM key_transparency_subtrees
+WHERE (level, start_index) IN (
+    SELECT * FROM unnest(sqlc.arg(levels)::smallint[], sqlc.arg(start_indexes)::bigint[])
+);
+
+-- name: GetCurrentKeyTransparencyLeavesForUser :many
+-- The latest sequenced entry for each of the user's devices within the first
+-- tree_size leaves, skipping devices whose latest entry is a delete.
+SELECT leaf_index, leaf_data FROM (
+    SELECT DISTINCT ON (device_identifier) operation, leaf_index, leaf_data
+    FROM key_transparency_entries
+    WHERE user_id = sqlc.arg(user_id) AND leaf_index < sqlc.arg(tree_size)::bigint
+    ORDER BY device_identifier, leaf_index DESC
+) latest
+WHERE operation <> 'delete'
+ORDER BY leaf_index;
+
+-- name: InsertKeyTransparencyTreeHead :one
+INSERT INTO key_transparency_tree_heads (
+    tree_size,
+    root_hash,
+    timestamp_ms,
+    signature
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetLatestKeyTransparencyTreeHead :one
+SELECT * FROM key_transparency_tree_heads
+ORDER BY tree_size DESC
+LIMIT 1;
+
+-- name: GetKeyTransparencyTreeHead :one
+SELECT * FROM key_transparency_tree_heads
+WHERE tree_size = $1;
@@ -0,0 +1,46 @@
+-- name: LockMessage :one
+-- Serializes edits, deletes and reactions of one message.
+SELECT id, user_id, group_id, created_at, updated_at, deleted_at, message_type FROM messages
+WHERE id = $1
+FOR UPDATE;
+
+-- name: ArchiveMessageVersion :one
+-- Copies the message's current version into message_edits.
+INSERT INTO message_edits (
+    message_id,
+    ciphertext,
+    msg_nonce,
+    sender_key_id,
+    sender_device_id,
+    mls_epoch,
+    created_at
+)
+SELECT id, ciphertext, msg_nonce, sender_key_id, sender_device_id, mls_epoch, updated_at
+FROM messages
+WHERE id = $1
+RETURNING id;
+
+-- name: ArchiveMessageEnvelopes :exec
+INSERT INTO message_edit_envelopes (edit_id, user_id, device_id, eph_pub_key, key_nonce, sealed_key)
+SELECT sqlc.arg(edit_id), user_id, device_id, eph_pub_key, key_nonce, sealed_key
+FROM message_envelopes
+WHERE message_id = sqlc.arg(message_id);
+
+-- name: DeleteMessageEdits :exec
+DELETE FROM message_edits
+WHERE message_id = $1;
+
+-- name: DeleteMessageEnvelopes :exec
+DELETE FROM message_envelopes
+WHERE message_id = $1;
+
+-- name: UpdateMessageContent :one
+UPDATE messages
+SET ciphertext = $2,
+    msg_nonce = $3,
+    sender_key_id = $4,
+    sender_device_id = $5,
+    mls_epoch = $6,
+    updated_at = now()
+WHERE id = $1
+RETURNING updated_at;
@@ -6,10 +6,24 @@ INSERT INTO messages (
     ciphertext,
     message_type,
     msg_nonce,
-    key_envelopes
+    sender_key_id,
+    sender_device_id,
+    mls_epoch
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7
-) RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce, key_envelopes;
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+) RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce;
+
+-- name: InsertMessageEnvelope :exec
+INSERT INTO message_envelopes (
+    message_id,
+    user_id,
+    device_id,
+    eph_pub_key,
+    key_nonce,
+    sealed_key
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+);
 
 -- name: GetMessageById :one
 SELECT
@@ -20,52 +34,175 @@ SELECT
     updated_at,
     ciphertext,
     message_type,
-    msg_nonce,
-    key_envelopes
+    msg_nonce
 FROM messages
 WHERE id = $1;
 
--- name: GetMessagesForGroup :many
+-- name: GetMessagesForGroupBefore :many
+-- Pages backwards through a group's history from the cursor, or from the
+-- newest message without one. Members only see messages sent after they
+-- joined.
+SELECT
+    m.id,
+    m.group_id,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
+    m.updated_at,
+    m.deleted_at,
+    m.ciphertext,
+    m.message_type,
+    m.msg_nonce,
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = sqlc.arg(user_id)
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = sqlc.arg(device_id) AND me.user_id = sqlc.arg(user_id)
+WHERE m.group_id = sqlc.arg(group_id)
+AND m.created_at > ug.created_at
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (m.created_at, m.id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+)
+ORDER BY m.created_at DESC, m.id DESC
+LIMIT sqlc.arg(max_messages);
+
+-- name: GetMessagesForGroupAfter :many
+-- Pages forwards through a group's history from the cursor. Members only see
+-- messages sent after they joined.
 SELECT
     m.id,
-    m.user_id,
-    u.username,
     m.group_id,
-    m.created_at,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
     m.updated_at,
+    m.deleted_at,
     m.ciphertext,
     m.message_type,
     m.msg_nonce,
-    m.key_envelopes
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
 FROM messages m
-JOIN users u ON m.user_id = u.id
-WHERE m.group_id = $1;
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = sqlc.arg(user_id)
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = sqlc.arg(device_id) AND me.user_id = sqlc.arg(user_id)
+WHERE m.group_id = sqlc.arg(group_id)
+AND m.created_at > ug.created_at
+AND (m.created_at, m.id) > (sqlc.arg(after_created_at)::timestamp, sqlc.arg(after_id)::uuid)
+ORDER BY m.created_at, m.id
+LIMIT sqlc.arg(max_messages);
 
 -- name: GetRelevantMessages :many
+-- Pages through the messages of the user's groups in (created_at, id) order,
+-- starting after the cursor when one is given. Members only see messages sent
+-- after they joined.
 SELECT
     m.id,
     m.group_id,
     m.user_id AS sender_id,
     m.created_at AS "timestamp",
+    m.updated_at,
+    m.deleted_at,
     m.ciphertext,
     m.message_type,
     m.msg_nonce,
-    m.key_envelopes
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
 FROM messages m
 JOIN user_groups ug ON ug.group_id = m.group_id
-JOIN users u_member ON ug.user_id = u_member.id 
-JOIN users u_sender ON m.user_id = u_sender.id
-JOIN groups g ON m.group_id = g.id
-WHERE u_member.id = $1
+JOIN users u_member ON ug.user_id = u_member.id
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = sqlc.arg(device_id) AND me.user_id = sqlc.arg(user_id)
+WHERE u_member.id = sqlc.arg(user_id)
 AND m.created_at > ug.created_at
-;
+AND (sqlc.narg(group_id)::uuid IS NULL OR m.group_id = sqlc.narg(group_id)::uuid)
+AND (
+    sqlc.narg(after_created_at)::timestamp IS NULL
+    OR (m.created_at, m.id) > (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_id)::uuid)
+)
+ORDER BY m.created_at, m.id
+LIMIT sqlc.arg(max_messages);
 
--- name: DeleteMessage :one
--- Deletes a message by its ID.
--- Returns the deleted message's core fields (E2EE fields might be large to return).
-DELETE FROM messages
+-- name: TombstoneMessage :one
+-- Deletes a message for everyone. The row stays as a tombstone that keeps its
+-- id, group, sender and timestamp but no content; envelopes and earlier
+-- versions are deleted separately.
+UPDATE messages
+SET ciphertext = ''::bytea,
+    msg_nonce = ''::bytea,
+    sender_key_id = NULL,
+    sender_device_id = NULL,
+    mls_epoch = NULL,
+    updated_at = now(),
+    deleted_at = now()
 WHERE id = $1
-RETURNING id, user_id, group_id, created_at;
+RETURNING deleted_at;
+
+-- name: GetMessageTombstones :many
+-- Messages up to the sync cursor that were deleted after the changes
+-- watermark, in (deleted_at, id) order, so incremental syncs also purge
+-- messages they delivered earlier.
+SELECT
+    m.id,
+    m.group_id,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
+    m.message_type,
+    m.deleted_at
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = sqlc.arg(user_id)
+WHERE (m.deleted_at, m.id) > (sqlc.arg(changed_after)::timestamp, sqlc.arg(changed_after_id)::uuid)
+AND m.created_at > ug.created_at
+AND (sqlc.narg(group_id)::uuid IS NULL OR m.group_id = sqlc.narg(group_id)::uuid)
+AND (m.created_at, m.id) <= (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY m.deleted_at, m.id
+LIMIT sqlc.arg(max_changes);
+
+-- name: GetEditedMessages :many
+-- Messages up to the sync cursor that were edited after the changes
+-- watermark, in (updated_at, id) order, so incremental syncs also pick up new
+-- versions of messages they delivered earlier.
+SELECT
+    m.id,
+    m.group_id,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
+    m.updated_at,
+    m.deleted_at,
+    m.ciphertext,
+    m.message_type,
+    m.msg_nonce,
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = sqlc.arg(user_id)
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = sqlc.arg(device_id) AND me.user_id = sqlc.arg(user_id)
+WHERE (m.updated_at, m.id) > (sqlc.arg(changed_after)::timestamp, sqlc.arg(changed_after_id)::uuid)
+AND m.updated_at > m.created_at
+AND m.deleted_at IS NULL
+AND m.created_at > ug.created_at
+AND (sqlc.narg(group_id)::uuid IS NULL OR m.group_id = sqlc.narg(group_id)::uuid)
+AND (m.created_at, m.id) <= (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY m.updated_at, m.id
+LIMIT sqlc.arg(max_changes);
+
+-- name: GetCurrentTimestamp :one
+-- The database clock, which stamps updated_at and deleted_at; a full sync
+-- starts its changes watermark here.
+SELECT now()::timestamp AS now;
 
 -- name: GetAllMessages :many
 -- Retrieves all messages. Use with caution on large datasets.
@@ -78,8 +215,7 @@ SELECT
     updated_at,
     ciphertext,
     message_type,
-    msg_nonce,
-    key_envelopes
+    msg_nonce
 FROM messages
 ORDER BY created_at DESC;
 
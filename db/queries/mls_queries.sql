@@ -0,0 +1,84 @@
+-- name: EnableMLSGroup :execrows
+INSERT INTO mls_groups (group_id) VALUES ($1)
+ON CONFLICT (group_id) DO NOTHING;
+
+-- name: GetMLSGroup :one
+SELECT * FROM mls_groups
+WHERE group_id = $1;
+
+-- name: LockMLSGroupEpoch :one
+-- Serializes commits to a group for the rest of the transaction.
+SELECT epoch FROM mls_groups
+WHERE group_id = $1
+FOR UPDATE;
+
+-- name: AdvanceMLSGroupEpoch :exec
+UPDATE mls_groups
+SET epoch = epoch + 1, updated_at = now()
+WHERE group_id = $1;
+
+-- name: InsertMLSCommit :one
+INSERT INTO mls_commits (
+    group_id,
+    epoch,
+    sender_id,
+    sender_device_id,
+    commit_message
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetMLSCommitsSince :many
+SELECT * FROM mls_commits
+WHERE group_id = sqlc.arg(group_id) AND epoch >= sqlc.arg(since_epoch)
+ORDER BY epoch
+LIMIT sqlc.arg(max_commits);
+
+-- name: InsertMLSWelcome :exec
+INSERT INTO mls_welcomes (
+    group_id,
+    epoch,
+    recipient_user_id,
+    recipient_device_id,
+    welcome_message
+) VALUES (
+    $1, $2, $3, $4, $5
+);
+
+-- name: GetMLSWelcomesForDevice :many
+-- Pending Welcomes for a device, limited to groups its user is still in.
+SELECT w.id, w.group_id, w.epoch, w.recipient_user_id, w.recipient_device_id, w.welcome_message, w.created_at
+FROM mls_welcomes w
+JOIN user_groups ug ON ug.group_id = w.group_id AND ug.user_id = w.recipient_user_id
+WHERE w.recipient_user_id = $1 AND w.recipient_device_id = $2
+ORDER BY w.created_at;
+
+-- name: DeleteMLSWelcome :execrows
+DELETE FROM mls_welcomes
+WHERE id = $1 AND recipient_user_id = $2 AND recipient_device_id = $3;
+
+-- name: InsertMLSKeyPackage :exec
+INSERT INTO mls_key_packages (
+    user_id,
+    device_identifier,
+    key_package
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: CountMLSKeyPackages :one
+SELECT count(*) FROM mls_key_packages
+WHERE user_id = $1 AND device_identifier = $2;
+
+-- name: ClaimMLSKeyPackage :one
+-- Hands out the device's oldest KeyPackage exactly once; concurrent claims
+-- skip packages another transaction is already taking.
+DELETE FROM mls_key_packages
+WHERE id = (
+    SELECT id FROM mls_key_packages
+    WHERE user_id = $1 AND device_identifier = $2
+    ORDER BY created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING key_package;
@@ -0,0 +1,67 @@
+-- name: InsertOIDCLoginState :one
+INSERT INTO oidc_login_states (
+    state_hash,
+    nonce,
+    code_verifier,
+    device_identifier,
+    public_key,
+    device_key_signature,
+    identity_key,
+    link_user_id,
+    link_session_id,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+)
+RETURNING *;
+
+-- name: GetOIDCLoginStateByHashForUpdate :one
+SELECT * FROM oidc_login_states
+WHERE state_hash = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: MarkOIDCLoginStateUsed :exec
+UPDATE oidc_login_states
+SET used_at = now()
+WHERE id = $1;
+
+-- name: GetUserIdentityByIssuerSubject :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: GetUserIdentitiesForUser :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: InsertUserIdentity :one
+INSERT INTO user_identities (
+    user_id,
+    issuer,
+    subject,
+    email,
+    last_login_at
+) VALUES (
+    $1, $2, $3, $4, now()
+)
+RETURNING *;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET
+    email = $2,
+    last_login_at = now()
+WHERE id = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteUserIdentitiesForUser :exec
+DELETE FROM user_identities
+WHERE user_id = $1;
+
+-- name: CountUserIdentities :one
+SELECT count(*) FROM user_identities
+WHERE user_id = $1;
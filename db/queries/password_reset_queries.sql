@@ -0,0 +1,26 @@
+-- name: InsertPasswordResetToken :one
+INSERT INTO password_reset_tokens (
+    user_id,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetPasswordResetTokenByHashForUpdate :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: MarkPasswordResetTokenUsed :exec
+UPDATE password_reset_tokens
+SET used_at = now()
+WHERE id = $1;
+
+-- name: InvalidatePasswordResetTokensForUser :exec
+-- Burns any outstanding tokens so only the most recent email works.
+UPDATE password_reset_tokens
+SET used_at = now()
+WHERE user_id = $1 AND used_at IS NULL;
@@ -0,0 +1,42 @@
+-- name: InsertPersonalAccessToken :one
+INSERT INTO personal_access_tokens (
+    user_id,
+    name,
+    token_hash,
+    token_prefix,
+    scopes,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = $1
+LIMIT 1;
+
+-- name: GetPersonalAccessTokensForUser :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: CountActivePersonalAccessTokens :one
+SELECT count(*) FROM personal_access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now();
+
+-- name: TouchPersonalAccessToken :exec
+-- Only writes when the last recorded use is more than a minute old, so busy scripts don't update the row on every request.
+UPDATE personal_access_tokens
+SET last_used_at = now()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute');
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = now()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokePersonalAccessTokensForUser :exec
+UPDATE personal_access_tokens
+SET revoked_at = now()
+WHERE user_id = $1 AND revoked_at IS NULL;
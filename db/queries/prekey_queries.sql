@@ -0,0 +1,52 @@
+-- name: UpsertSignedPrekey :exec
+INSERT INTO device_signed_prekeys (
+    user_id,
+    device_identifier,
+    key_id,
+    public_key,
+    signature
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+ON CONFLICT (user_id, device_identifier) DO UPDATE
+SET key_id = EXCLUDED.key_id,
+    public_key = EXCLUDED.public_key,
+    signature = EXCLUDED.signature,
+    created_at = now();
+
+-- name: GetSignedPrekey :one
+SELECT * FROM device_signed_prekeys
+WHERE user_id = $1 AND device_identifier = $2;
+
+-- name: GetSignedPrekeysForUser :many
+SELECT * FROM device_signed_prekeys
+WHERE user_id = $1;
+
+-- name: InsertOneTimePrekey :execrows
+-- Returns 0 if the device already has an unclaimed prekey with this ID.
+INSERT INTO device_one_time_prekeys (
+    user_id,
+    device_identifier,
+    key_id,
+    public_key
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (user_id, device_identifier, key_id) DO NOTHING;
+
+-- name: CountOneTimePrekeys :one
+SELECT count(*) FROM device_one_time_prekeys
+WHERE user_id = $1 AND device_identifier = $2;
+
+-- name: ClaimOneTimePrekey :one
+-- Hands out the device's oldest one-time prekey exactly once; concurrent
+-- claims skip prekeys another transaction is already taking.
+DELETE FROM device_one_time_prekeys
+WHERE (user_id, device_identifier, key_id) = (
+    SELECT user_id, device_identifier, key_id FROM device_one_time_prekeys
+    WHERE user_id = $1 AND device_identifier = $2
+    ORDER BY created_at, key_id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING key_id, public_key;
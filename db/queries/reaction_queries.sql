@@ -0,0 +1,36 @@
+-- name: InsertMessageReaction :execrows
+-- Returns 0 if the user already reacted to the message with this reaction.
+INSERT INTO message_reactions (
+    message_id,
+    user_id,
+    reaction,
+    encrypted
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (message_id, user_id, reaction) DO NOTHING;
+
+-- name: DeleteMessageReaction :one
+DELETE FROM message_reactions
+WHERE message_id = $1 AND user_id = $2 AND reaction = $3
+RETURNING encrypted;
+
+-- name: DeleteMessageReactions :exec
+DELETE FROM message_reactions
+WHERE message_id = $1;
+
+-- name: CountUserMessageReactions :one
+SELECT count(*) FROM message_reactions
+WHERE message_id = $1 AND user_id = $2;
+
+-- name: GetReactionsForMessages :many
+-- Aggregates the reactions to a page of messages, oldest reaction first.
+SELECT
+    message_id,
+    reaction,
+    encrypted,
+    array_agg(user_id ORDER BY created_at, user_id)::uuid[] AS user_ids
+FROM message_reactions
+WHERE message_id = ANY(sqlc.arg(message_ids)::uuid[])
+GROUP BY message_id, reaction, encrypted
+ORDER BY message_id, min(created_at), reaction;
@@ -0,0 +1,60 @@
+-- name: InsertSenderKey :exec
+-- Registers a sender key; re-uploads for the same key are no-ops, callers
+-- check ownership with GetSenderKey.
+INSERT INTO sender_keys (
+    id,
+    group_id,
+    sender_id,
+    sender_device_id
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: GetSenderKey :one
+SELECT * FROM sender_keys
+WHERE id = $1;
+
+-- name: UpsertSenderKeyDistribution :exec
+INSERT INTO sender_key_distributions (
+    key_id,
+    recipient_user_id,
+    recipient_device_id,
+    eph_pub_key,
+    key_nonce,
+    sealed_key
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (key_id, recipient_user_id, recipient_device_id) DO UPDATE SET
+    eph_pub_key = EXCLUDED.eph_pub_key,
+    key_nonce = EXCLUDED.key_nonce,
+    sealed_key = EXCLUDED.sealed_key,
+    created_at = now();
+
+-- name: GetSenderKeyRecipients :many
+-- Every device a sender key was ever distributed to, including devices that
+-- have since left the group.
+SELECT recipient_user_id, recipient_device_id
+FROM sender_key_distributions
+WHERE key_id = $1;
+
+-- name: GetSenderKeyDistributionsForDevice :many
+-- Distribution messages addressed to a device, limited to groups its user is
+-- still in and optionally to one group.
+SELECT
+    skd.key_id,
+    sk.group_id,
+    sk.sender_id,
+    sk.sender_device_id,
+    skd.eph_pub_key,
+    skd.key_nonce,
+    skd.sealed_key,
+    skd.created_at
+FROM sender_key_distributions skd
+JOIN sender_keys sk ON sk.id = skd.key_id
+JOIN user_groups ug ON ug.group_id = sk.group_id AND ug.user_id = skd.recipient_user_id
+WHERE skd.recipient_user_id = $1
+AND skd.recipient_device_id = $2
+AND (sqlc.narg(group_id)::uuid IS NULL OR sk.group_id = sqlc.narg(group_id))
+ORDER BY skd.created_at;
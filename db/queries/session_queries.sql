@@ -0,0 +1,63 @@
+-- name: InsertSession :one
+INSERT INTO sessions (
+    user_id,
+    family_id,
+    refresh_token_hash,
+    device_identifier,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetSessionByTokenHashForUpdate :one
+SELECT * FROM sessions
+WHERE refresh_token_hash = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: MarkSessionRotated :exec
+UPDATE sessions
+SET rotated_at = now()
+WHERE id = $1;
+
+-- name: RevokeSessionFamily :exec
+UPDATE sessions
+SET revoked_at = now()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAllSessionsForUser :many
+UPDATE sessions
+SET revoked_at = now()
+WHERE user_id = $1 AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: GetSessionFamilyDeviceIdentifier :one
+SELECT device_identifier FROM sessions
+WHERE family_id = $1
+LIMIT 1;
+
+-- name: GetSessionFamilyStartedAt :one
+-- When the login that started the family happened; refreshes keep the family.
+SELECT created_at FROM sessions
+WHERE family_id = $1
+ORDER BY created_at ASC
+LIMIT 1;
+
+-- name: RevokeSessionsForDevice :many
+UPDATE sessions
+SET revoked_at = now()
+WHERE user_id = $1 AND device_identifier = $2 AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: RevokeSessionsForOtherDevices :many
+UPDATE sessions
+SET revoked_at = now()
+WHERE user_id = $1 AND device_identifier <> $2 AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: RevokeOtherSessionsForUser :many
+UPDATE sessions
+SET revoked_at = now()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+RETURNING family_id;
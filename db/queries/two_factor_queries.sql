@@ -0,0 +1,88 @@
+-- name: UpsertPendingTOTP :one
+-- Starts (or restarts) enrollment; an already enabled secret is left alone and no row is returned.
+INSERT INTO user_totp (
+    user_id,
+    secret
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    secret = EXCLUDED.secret,
+    last_used_step = 0,
+    created_at = now()
+WHERE user_totp.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: GetUserTOTPForUpdate :one
+SELECT * FROM user_totp
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: EnableUserTOTP :exec
+UPDATE user_totp
+SET
+    enabled_at = now(),
+    last_used_step = $2
+WHERE user_id = $1;
+
+-- name: UpdateTOTPLastUsedStep :exec
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: InsertRecoveryCode :exec
+INSERT INTO totp_recovery_codes (
+    user_id,
+    code_hash
+) VALUES (
+    $1, $2
+);
+
+-- name: DeleteRecoveryCodesForUser :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: InsertMFAChallenge :one
+INSERT INTO mfa_challenges (
+    user_id,
+    token_hash,
+    device_identifier,
+    public_key,
+    device_key_signature,
+    identity_key,
+    expires_at,
+    reset_identity_key
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8
+)
+RETURNING *;
+
+-- name: GetMFAChallengeByHashForUpdate :one
+SELECT * FROM mfa_challenges
+WHERE token_hash = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: IncrementMFAChallengeFailures :exec
+UPDATE mfa_challenges
+SET failed_attempts = failed_attempts + 1
+WHERE id = $1;
+
+-- name: MarkMFAChallengeUsed :exec
+UPDATE mfa_challenges
+SET used_at = now()
+WHERE id = $1;
@@ -29,4 +29,10 @@ RETURNING "id", "user_id", "group_id", "admin", "created_at", "updated_at";
 
 -- name: DeleteUserGroup :one
 DELETE FROM user_groups
-WHERE user_id = $1 AND group_id = $2 RETURNING "id", "user_id", "group_id", "admin", "created_at", "updated_at";
\ No newline at end of file
+WHERE user_id = $1 AND group_id = $2 RETURNING "id", "user_id", "group_id", "admin", "created_at", "updated_at";
+-- name: UsersShareGroup :one
+SELECT EXISTS (
+    SELECT 1 FROM user_groups a
+    JOIN user_groups b ON a.group_id = b.group_id
+    WHERE a.user_id = sqlc.arg(user_id) AND b.user_id = sqlc.arg(other_user_id)
+);
@@ -18,7 +18,8 @@ JOIN groups ON groups.id = user_groups.group_id
 WHERE groups.id = $1;
 
 -- name: GetUsersByEmails :many
-SELECT id, username, email, created_at, updated_at FROM users WHERE email = ANY(sqlc.arg('emails')::text[]);
+-- Only verified addresses can be matched, so nobody can claim someone else's invites.
+SELECT id, username, email, created_at, updated_at FROM users WHERE email = ANY(sqlc.arg('emails')::text[]) AND email_verified_at IS NOT NULL;
 
 -- name: GetUsersByIDs :many
 SELECT id, username, email, created_at, updated_at FROM users WHERE id = ANY(sqlc.arg('ids')::UUID[]);
@@ -71,17 +72,48 @@ relevant_users AS (
 )
 SELECT
     ru.user_id,
+    coalesce(encode(uik.public_key, 'base64'), '')::text AS identity_key,
     jsonb_agg(
         jsonb_build_object(
             'device_identifier', dk.device_identifier,
-            'public_key', encode(dk.public_key, 'base64')
+            'public_key', encode(dk.public_key, 'base64'),
+            'signature', encode(dk.signature, 'base64')
         ) ORDER BY dk.created_at DESC
     ) AS device_keys
 FROM
     relevant_users ru
 JOIN
     device_keys dk ON ru.user_id = dk.user_id
+LEFT JOIN
+    user_identity_keys uik ON ru.user_id = uik.user_id
 GROUP BY
-    ru.user_id
+    ru.user_id, uik.public_key
 HAVING
     count(dk.id) > 0; 
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    "password" = $2,
+    "updated_at" = now()
+WHERE id = $1;
+
+-- name: GetUserEmailVerifiedAt :one
+SELECT "email_verified_at" FROM users WHERE id = $1;
+
+-- name: MarkUserEmailVerified :execrows
+UPDATE users
+SET
+    "email_verified_at" = now(),
+    "updated_at" = now()
+WHERE id = $1 AND LOWER(email) = LOWER(sqlc.arg('email'));
+
+-- name: ChangeUserEmail :one
+-- Moves the account to an address its owner has just proven they control.
+UPDATE users
+SET
+    "email" = $2,
+    "email_verified_at" = now(),
+    "updated_at" = now()
+WHERE id = $1
+RETURNING "id", "username", "email", "created_at", "updated_at";
@@ -0,0 +1,68 @@
+-- name: InsertWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (
+    challenge_hash,
+    ceremony,
+    user_id,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetWebAuthnChallengeByHashForUpdate :one
+SELECT * FROM webauthn_challenges
+WHERE challenge_hash = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: MarkWebAuthnChallengeUsed :exec
+UPDATE webauthn_challenges
+SET used_at = now()
+WHERE id = $1;
+
+-- name: InsertWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+    user_id,
+    credential_id,
+    public_key,
+    sign_count,
+    transports,
+    name
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetWebAuthnCredentialByCredentialIDForUpdate :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1
+LIMIT 1
+FOR UPDATE;
+
+-- name: GetWebAuthnCredentialsForUser :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: UpdateWebAuthnCredentialUsage :exec
+UPDATE webauthn_credentials
+SET
+    sign_count = $2,
+    last_used_at = now()
+WHERE id = $1;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteWebAuthnCredentialsForUser :exec
+DELETE FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: CountSignInMethods :one
+-- Password, linked identities and passkeys; used to stop users removing the last way into their account.
+SELECT (
+    (SELECT count(*) FROM users WHERE users.id = $1 AND users.password IS NOT NULL) +
+    (SELECT count(*) FROM user_identities WHERE user_identities.user_id = $1) +
+    (SELECT count(*) FROM webauthn_credentials WHERE webauthn_credentials.user_id = $1)
+)::bigint AS sign_in_methods;
@@ -1,5 +1,6 @@
 import { useState } from "react";
-import { Text, TextInput, View, Pressable } from "react-native";
+import { Alert, Text, TextInput, View, Pressable } from "react-native";
+import axios from "axios";
 import { useAuthUtils } from "../context/AuthUtilsContext";
 import Button from "../Global/Button/Button";
 
@@ -11,13 +12,21 @@ export default function LoginForm() {
   const [isLoading, setIsLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
-  const handleLogin = async () => {
+  const handleLogin = async (resetIdentityKey: boolean = false) => {
     if (email && password) {
       setIsLoading(true);
       setError(null);
       try {
-        await login(email, password);
+        await login(email, password, resetIdentityKey);
       } catch (err) {
+        if (
+          axios.isAxiosError(err) &&
+          err.response?.status === 409 &&
+          err.response.data?.identity_key_reset_required
+        ) {
+          confirmIdentityKeyReset();
+          return;
+        }
         setError("Login failed. Please check your credentials and try again.");
         console.error("Error logging in: ", err);
       } finally {
@@ -26,6 +35,23 @@ export default function LoginForm() {
     }
   };
 
+  // This install doesn't hold the account's identity key, e.g. after a
+  // reinstall or on a new phone once the old one is gone.
+  const confirmIdentityKeyReset = () => {
+    Alert.alert(
+      "Reset your identity key?",
+      "This device doesn't have your account's identity key. Resetting it signs out all of your other devices, and your contacts will see that your keys changed.",
+      [
+        { text: "Cancel", style: "cancel" },
+        {
+          text: "Reset",
+          style: "destructive",
+          onPress: () => handleLogin(true),
+        },
+      ]
+    );
+  };
+
   return (
     <View className="w-full">
       {error && (
@@ -61,13 +87,13 @@ export default function LoginForm() {
             className="bg-gray-700 text-white border border-gray-600 rounded-lg px-4 py-3 w-full"
             onChangeText={setPassword}
             value={password}
-            onSubmitEditing={handleLogin}
+            onSubmitEditing={() => handleLogin()}
           />
         </View>
       </View>
 
       <Button
-        onPress={handleLogin}
+        onPress={() => handleLogin()}
         text={isLoading ? "Signing In..." : "Sign In"}
         size="lg"
         variant="primary"
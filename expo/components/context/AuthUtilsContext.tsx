@@ -13,7 +13,11 @@ import * as encryptionService from "@/services/encryptionService";
 
 interface AuthUtilsContextType {
   whoami: (forceRefresh?: boolean) => Promise<WhoAmIResult>;
-  login: (email: string, password: string) => Promise<void>;
+  login: (
+    email: string,
+    password: string,
+    resetIdentityKey?: boolean
+  ) => Promise<void>;
   logout: () => Promise<void>;
   signup: (username: string, email: string, password: string) => Promise<void>;
 }
@@ -97,12 +101,23 @@ export const AuthUtilsProvider = (props: { children: React.ReactNode }) => {
     [globalDeviceId, setDeviceId, user, setUser, connected, establishConnection]
   );
 
+  // resetIdentityKey replaces the account's identity key with this install's
+  // when they differ, removing every other device. The server asks for it with
+  // identity_key_reset_required after a device with the old key was lost.
   const login = useCallback(
-    async (email: string, password: string): Promise<void> => {
+    async (
+      email: string,
+      password: string,
+      resetIdentityKey: boolean = false
+    ): Promise<void> => {
       try {
         const { deviceId, publicKey } =
           await deviceService.ensureDeviceIdentity();
         const base64PublicKey = encryptionService.uint8ArrayToBase64(publicKey);
+        const signedKey = await deviceService.signedDeviceKeyUpload(
+          deviceId,
+          publicKey
+        );
 
         const response = await axios.post(
           `${process.env.EXPO_PUBLIC_HOST}/auth/login`,
@@ -111,10 +126,13 @@ export const AuthUtilsProvider = (props: { children: React.ReactNode }) => {
             password: password,
             device_identifier: deviceId,
             public_key: base64PublicKey,
+            ...signedKey,
+            reset_identity_key: resetIdentityKey,
           }
         );
         const { data } = response;
         await save("jwt", data.token);
+        await save("refresh_token", data.refresh_token);
         setDeviceId(deviceId);
 
         const { deviceId: currentDeviceId } = await whoami(true);
@@ -138,6 +156,10 @@ export const AuthUtilsProvider = (props: { children: React.ReactNode }) => {
         const { deviceId, publicKey } =
           await deviceService.ensureDeviceIdentity();
         const base64PublicKey = encryptionService.uint8ArrayToBase64(publicKey);
+        const signedKey = await deviceService.signedDeviceKeyUpload(
+          deviceId,
+          publicKey
+        );
 
         const response = await axios.post(
           `${process.env.EXPO_PUBLIC_HOST}/auth/signup`,
@@ -147,10 +169,12 @@ export const AuthUtilsProvider = (props: { children: React.ReactNode }) => {
             password: password,
             device_identifier: deviceId,
             public_key: base64PublicKey,
+            ...signedKey,
           }
         );
         const { data } = response;
         await save("jwt", data.token);
+        await save("refresh_token", data.refresh_token);
         setDeviceId(deviceId);
 
         await whoami(true);
@@ -166,7 +190,15 @@ export const AuthUtilsProvider = (props: { children: React.ReactNode }) => {
 
   const logout = useCallback(async () => {
     try {
+      await http
+        .post(`${process.env.EXPO_PUBLIC_HOST}/auth/logout`)
+        .catch((error) => {
+          if (!(error instanceof CanceledError)) {
+            console.error("Error revoking session on logout:", error);
+          }
+        });
       await clear("jwt");
+      await clear("refresh_token");
       setUser(undefined);
       setDeviceId(undefined);
       if (connected) {
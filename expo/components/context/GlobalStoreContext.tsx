@@ -10,8 +10,11 @@ import React, {
 } from "react";
 import http from "@/util/custom-axios";
 import * as encryptionService from "@/services/encryptionService";
+import * as deviceService from "@/services/deviceService";
+import sodium from "react-native-libsodium";
 import { CanceledError } from "axios";
 interface DeviceKey {
+  userId: string;
   deviceId: string;
   publicKey: Uint8Array;
 }
@@ -20,13 +23,41 @@ type RelevantDeviceKeysMap = Record<string, DeviceKey[]>;
 interface ServerDeviceKeyInfo {
   device_identifier: string;
   public_key: string;
+  signature: string | null;
 }
 
 interface ServerUserWithDeviceKeys {
   user_id: string;
+  identity_key?: string;
   device_keys: ServerDeviceKeyInfo[];
 }
 
+// Drops device keys whose signature doesn't check out against the user's
+// identity key. Keys from before signing was required have no signature and
+// are kept.
+const verifiedDeviceKeys = (userWithKeys: ServerUserWithDeviceKeys) =>
+  userWithKeys.device_keys.filter((keyInfo) => {
+    if (!keyInfo.signature) {
+      return true;
+    }
+    const valid =
+      !!userWithKeys.identity_key &&
+      sodium.crypto_sign_verify_detached(
+        encryptionService.base64ToUint8Array(keyInfo.signature),
+        deviceService.deviceKeySignedMessage(
+          keyInfo.device_identifier,
+          encryptionService.base64ToUint8Array(keyInfo.public_key)
+        ),
+        encryptionService.base64ToUint8Array(userWithKeys.identity_key)
+      );
+    if (!valid) {
+      console.warn(
+        `Ignoring device ${keyInfo.device_identifier} of user ${userWithKeys.user_id}: bad identity signature.`
+      );
+    }
+    return valid;
+  });
+
 type Action =
   | { type: "SET_USER"; payload: User | undefined }
   | { type: "SET_DEVICE_ID"; payload: string | undefined }
@@ -149,13 +180,15 @@ export const GlobalStoreProvider = (props: { children: React.ReactNode }) => {
 
       const processedKeys: RelevantDeviceKeysMap = {};
 
+      await sodium.ready;
       for (const userWithKeys of serverData) {
-        processedKeys[userWithKeys.user_id] = userWithKeys.device_keys.map(
-          (keyInfo) => ({
-            deviceId: keyInfo.device_identifier,
-            publicKey: encryptionService.base64ToUint8Array(keyInfo.public_key),
-          })
-        );
+        processedKeys[userWithKeys.user_id] = verifiedDeviceKeys(
+          userWithKeys
+        ).map((keyInfo) => ({
+          userId: userWithKeys.user_id,
+          deviceId: keyInfo.device_identifier,
+          publicKey: encryptionService.base64ToUint8Array(keyInfo.public_key),
+        }));
       }
 
       dispatch({
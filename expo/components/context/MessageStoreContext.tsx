@@ -1,4 +1,4 @@
-import { DbMessage, RawMessage } from "@/types/types";
+import { DbMessage, MessagePage, RawMessage } from "@/types/types";
 import React, {
   createContext,
   useContext,
@@ -156,13 +156,30 @@ export const MessageStoreProvider: React.FC<{ children: React.ReactNode }> = ({
       dispatch({ type: "SET_LOADING", payload: true });
 
       try {
-        const response = await http.get<RawMessage[]>(
-          `${process.env.EXPO_PUBLIC_HOST}/ws/relevant-messages`
-        );
-        const rawMessages: RawMessage[] = response.data;
+        const rawMessages: RawMessage[] = [];
+        let since: string | null = null;
+        let changesSince: string | null = null;
+        let hasMore = true;
+        while (hasMore) {
+          const response: { data: MessagePage } = await http.get<MessagePage>(
+            `${process.env.EXPO_PUBLIC_HOST}/ws/relevant-messages`,
+            {
+              params: since
+                ? { since, changes_since: changesSince ?? undefined }
+                : undefined,
+            }
+          );
+          rawMessages.push(...response.data.messages);
+          since = response.data.next_cursor;
+          changesSince = response.data.changes_cursor;
+          hasMore = response.data.has_more;
+        }
         const processedMessages: DbMessage[] = [];
 
         for (const rawMsg of rawMessages) {
+          if (rawMsg.deletedAt) {
+            continue;
+          }
           const processed = encryptionService.processAndDecodeIncomingMessage(
             rawMsg,
             preferredDeviceId,
@@ -13,8 +13,7 @@ import React, {
   useRef,
   useState,
 } from "react";
-import http from "@/util/custom-axios";
-import { get } from "@/util/custom-store";
+import http, { getValidToken } from "@/util/custom-axios";
 import { CanceledError } from "axios";
 
 interface WebSocketContextType {
@@ -132,7 +131,7 @@ export const WebSocketProvider: React.FC<{ children: React.ReactNode }> = ({
     let currentAttemptPreventRetries = false;
 
     return new Promise(async (resolve, reject) => {
-      const token = await get("jwt");
+      const token = await getValidToken();
       if (!token) {
         if (!promiseSettled) {
           promiseSettled = true;
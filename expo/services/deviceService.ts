@@ -7,6 +7,9 @@ import sodium from "react-native-libsodium";
 const DEVICE_ID_KEY = "deviceIdentifier";
 const PUBLIC_KEY_KEY = "devicePublicKey";
 const PRIVATE_KEY_SECURE_KEY = "devicePrivateKey_v2";
+const IDENTITY_PUBLIC_KEY_KEY = "identityPublicKey";
+const IDENTITY_PRIVATE_KEY_SECURE_KEY = "identityPrivateKey_v1";
+const DEVICE_KEY_SIGNATURE_CONTEXT = "chat-app device key v1";
 
 interface DeviceIdentity {
   deviceId: string;
@@ -83,6 +86,95 @@ export const getOrGenerateDeviceKeyPair = async (): Promise<{
   return { publicKey, privateKey };
 };
 
+/**
+ * Returns the user's long-term Ed25519 identity key pair, generating one on
+ * first use. It signs this device's key so peers can tell it belongs to the
+ * account.
+ */
+export const getOrGenerateIdentityKeyPair = async (): Promise<{
+  publicKey: Uint8Array;
+  privateKey: Uint8Array;
+}> => {
+  await sodium.ready;
+  let storedPublicKeyBase64: string | undefined;
+  try {
+    storedPublicKeyBase64 = await customStore.get(IDENTITY_PUBLIC_KEY_KEY);
+  } catch (e) {
+  }
+  const storedPrivateKeyBase64 = await SecureStore.getItemAsync(
+    IDENTITY_PRIVATE_KEY_SECURE_KEY
+  );
+
+  if (storedPublicKeyBase64 && storedPrivateKeyBase64) {
+    const publicKey = encryptionService.base64ToUint8Array(
+      storedPublicKeyBase64
+    );
+    const privateKey = encryptionService.base64ToUint8Array(
+      storedPrivateKeyBase64
+    );
+    if (
+      publicKey.length === sodium.crypto_sign_PUBLICKEYBYTES &&
+      privateKey.length === sodium.crypto_sign_SECRETKEYBYTES
+    ) {
+      return { publicKey, privateKey };
+    }
+    console.warn(
+      "Stored identity keys seem invalid (length mismatch). Regenerating."
+    );
+  }
+
+  const { publicKey, privateKey } = sodium.crypto_sign_keypair();
+  await customStore.save(
+    IDENTITY_PUBLIC_KEY_KEY,
+    encryptionService.uint8ArrayToBase64(publicKey)
+  );
+  await SecureStore.setItemAsync(
+    IDENTITY_PRIVATE_KEY_SECURE_KEY,
+    encryptionService.uint8ArrayToBase64(privateKey)
+  );
+  return { publicKey, privateKey };
+};
+
+/**
+ * The bytes an identity key signs to vouch for a device key. Must match
+ * DeviceKeySignedMessage on the server.
+ */
+export const deviceKeySignedMessage = (
+  deviceId: string,
+  devicePublicKey: Uint8Array
+): Uint8Array => {
+  const context = new TextEncoder().encode(DEVICE_KEY_SIGNATURE_CONTEXT);
+  const id = new TextEncoder().encode(deviceId);
+  const message = new Uint8Array(
+    context.length + 3 + id.length + devicePublicKey.length
+  );
+  message.set(context, 0);
+  message[context.length] = 0;
+  message[context.length + 1] = (id.length >> 8) & 0xff;
+  message[context.length + 2] = id.length & 0xff;
+  message.set(id, context.length + 3);
+  message.set(devicePublicKey, context.length + 3 + id.length);
+  return message;
+};
+
+/**
+ * Fields to send with signup/login so the server accepts this device's key.
+ */
+export const signedDeviceKeyUpload = async (
+  deviceId: string,
+  devicePublicKey: Uint8Array
+): Promise<{ identity_key: string; device_key_signature: string }> => {
+  const identity = await getOrGenerateIdentityKeyPair();
+  const signature = sodium.crypto_sign_detached(
+    deviceKeySignedMessage(deviceId, devicePublicKey),
+    identity.privateKey
+  );
+  return {
+    identity_key: encryptionService.uint8ArrayToBase64(identity.publicKey),
+    device_key_signature: encryptionService.uint8ArrayToBase64(signature),
+  };
+};
+
 export const ensureDeviceIdentity = async (): Promise<DeviceIdentity> => {
   const deviceId = await getOrGenerateDeviceIdentifier();
   const { publicKey, privateKey } = await getOrGenerateDeviceKeyPair();
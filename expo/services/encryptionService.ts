@@ -3,6 +3,7 @@ import {
   DbMessage,
   MessageType,
   ImageMessageContent,
+  RecipientDevicePublicKey,
 } from "../types/types";
 import sodium from "react-native-libsodium";
 import { Base64 } from "js-base64";
@@ -148,7 +149,7 @@ export const processAndDecodeIncomingMessage = (
  *
  * @param plaintext The message content to encrypt.
  * @param groupId The ID of the group this message belongs to.
- * @param recipientDevicePublicKeys An array of objects, each containing a recipient's deviceId and their long-term publicKey (Uint8Array).
+ * @param recipientDevicePublicKeys An array of objects, each containing a recipient's userId, deviceId and their long-term publicKey (Uint8Array).
  * @param senderLongTermPrivateKey The sender's long-term private key (Uint8Array).
  * @returns A promise that resolves to the RawMessage object (with Base64 strings).
  */
@@ -156,7 +157,7 @@ export const encryptAndPrepareMessageForSending = async (
   messageId: string,
   plaintext: string,
   groupId: string,
-  recipientDevicePublicKeys: { deviceId: string; publicKey: Uint8Array }[],
+  recipientDevicePublicKeys: RecipientDevicePublicKey[],
   messageType: MessageType
 ): Promise<RawMessage | null> => {
   return encryptionLimiter.execute(async () => {
@@ -192,6 +193,7 @@ export const encryptAndPrepareMessageForSending = async (
         );
 
         envelopes.push({
+          userId: recipient.userId,
           deviceId: recipient.deviceId,
           ephPubKey: uint8ArrayToBase64(senderEphemeralKeyPair.publicKey),
           keyNonce: uint8ArrayToBase64(keyNonceUint8Array),
@@ -13,6 +13,7 @@ export type User = {
 };
 
 export interface RecipientDevicePublicKey {
+  userId: string;
   deviceId: string;
   publicKey: Uint8Array;
 }
@@ -34,6 +35,7 @@ export type Group = {
   location?: string | null;
   image_url?: string | null;
   blurhash?: string | null;
+  encrypted_reactions?: boolean; // New reactions must be encrypted payloads
   last_read_timestamp?: string | null;
   last_message_timestamp?: string | null;
 };
@@ -108,11 +110,40 @@ export type RawMessage = {
   messageType: MessageType;
   msgNonce: string; // Nonce used for encrypting the message content (Base64 encoded)
   envelopes: Array<{
+    userId: string; // Recipient user; device identifiers are only unique per user
     deviceId: string; // Recipient's device identifier
     ephPubKey: string; // Sender's ephemeral public key for this box (Base64 encoded)
     keyNonce: string; // Nonce for this box (Base64 encoded)
     sealedKey: string; // The symKey sealed for this recipient (Base64 encoded)
   }>;
+  deletedAt?: string; // Set on tombstones, which carry no ciphertext or envelopes
+  reactions?: ReactionSummary[];
+};
+
+/**
+ * A reaction to a message and who reacted with it. Encrypted reactions are
+ * Base64 payloads to decrypt before display.
+ */
+export type ReactionSummary = {
+  reaction: string;
+  encrypted: boolean;
+  user_ids: string[];
+  count: number;
+};
+
+/**
+ * One page of `/ws/relevant-messages`. `next_cursor` is passed back as `since`
+ * and `changes_cursor` as `changes_since` to continue; `has_more` says whether
+ * another page is ready right away. `edits` and `tombstones` list messages
+ * before `since` that were edited or deleted after `changes_since`.
+ */
+export type MessagePage = {
+  messages: RawMessage[];
+  edits: RawMessage[];
+  tombstones: RawMessage[];
+  next_cursor: string | null;
+  changes_cursor: string | null;
+  has_more: boolean;
 };
 
 export type ImageMessageContent = {
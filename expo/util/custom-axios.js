@@ -1,5 +1,5 @@
 import axios from "axios";
-import { get, clear } from "./custom-store";
+import { get, save, clear } from "./custom-store";
 import { jwtDecode } from "jwt-decode";
 
 const http = axios.create();
@@ -21,20 +21,58 @@ function isTokenExpired(token) {
   }
 }
 
+let refreshInFlight = null;
+
+// Exchanges the stored refresh token for a new access/refresh pair. Concurrent
+// callers share one request because refresh tokens are single-use.
+async function refreshTokens() {
+  const refreshToken = await get("refresh_token");
+  if (!refreshToken) {
+    return undefined;
+  }
+
+  try {
+    const { data } = await axios.post(
+      `${process.env.EXPO_PUBLIC_HOST}/auth/refresh`,
+      { refresh_token: refreshToken }
+    );
+    await save("jwt", data.token);
+    await save("refresh_token", data.refresh_token);
+    return data.token;
+  } catch (error) {
+    console.log("Failed to refresh session:", error?.response?.status);
+    // Only a 401 means the session is gone. Network errors and server hiccups
+    // keep the tokens so the next request can try again.
+    if (error?.response?.status === 401) {
+      await clear("jwt");
+      await clear("refresh_token");
+    }
+    return undefined;
+  }
+}
+
+export async function getValidToken() {
+  const token = await get("jwt");
+  if (token && !isTokenExpired(token)) {
+    return token;
+  }
+
+  if (!refreshInFlight) {
+    refreshInFlight = refreshTokens().finally(() => {
+      refreshInFlight = null;
+    });
+  }
+  return refreshInFlight;
+}
+
 http.interceptors.request.use(async (config) => {
   const controller = new AbortController();
-  const token = await get("jwt");
+  const token = await getValidToken();
 
   if (token) {
-    if (isTokenExpired(token)) {
-      console.log("JWT is expired on client-side. Aborting request.");
-      await clear("jwt");
-      controller.abort();
-    } else {
-      config.headers["Authorization"] = `Bearer ${token}`;
-    }
+    config.headers["Authorization"] = `Bearer ${token}`;
   } else {
-    console.log("No JWT found. Aborting request.");
+    console.log("No valid JWT found. Aborting request.");
     controller.abort();
   }
 
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"chat-app-server/db"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Scopes a personal access token can be granted. Login sessions have all of
+// them; routes that don't declare one are closed to access tokens entirely.
+const (
+	ScopeUsersRead    = "users:read"
+	ScopeGroupsRead   = "groups:read"
+	ScopeGroupsWrite  = "groups:write"
+	ScopeMessagesRead = "messages:read"
+	ScopeImagesRead   = "images:read"
+	ScopeImagesWrite  = "images:write"
+)
+
+var validScopes = []string{
+	ScopeUsersRead,
+	ScopeGroupsRead,
+	ScopeGroupsWrite,
+	ScopeMessagesRead,
+	ScopeImagesRead,
+	ScopeImagesWrite,
+}
+
+const (
+	personalAccessTokenPrefix     = "pat_"
+	personalAccessTokenPrefixLen  = len(personalAccessTokenPrefix) + 8
+	defaultAccessTokenExpiryDays  = 90
+	maxActivePersonalAccessTokens = 25
+)
+
+func isPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// generatePersonalAccessToken returns a pat_-prefixed token for the user and
+// the hash that is stored.
+func generatePersonalAccessToken() (string, []byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := personalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashOpaqueToken(token), nil
+}
+
+func toPersonalAccessToken(token db.PersonalAccessToken) PersonalAccessToken {
+	view := PersonalAccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.TokenPrefix,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt.Time,
+		CreatedAt: token.CreatedAt.Time,
+	}
+	if token.LastUsedAt.Valid {
+		view.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return view
+}
+
+// TokenAuthMiddleware accepts either a login access token or a personal
+// access token that was granted scope.
+func (h *AuthHandler) TokenAuthMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		if !isPersonalAccessToken(tokenString) {
+			if authenticateJWT(c, h.revocations, tokenString) {
+				c.Next()
+			}
+			return
+		}
+
+		ctx := c.Request.Context()
+		token, err := h.db.GetPersonalAccessTokenByHash(ctx, hashOpaqueToken(tokenString))
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				log.Printf("Error loading personal access token: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token."})
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token."})
+			}
+			c.Abort()
+			return
+		}
+
+		if token.RevokedAt.Valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked."})
+			c.Abort()
+			return
+		}
+		if time.Now().UTC().After(token.ExpiresAt.Time) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has expired."})
+			c.Abort()
+			return
+		}
+		if !slices.Contains(token.Scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Token is missing the %s scope.", scope)})
+			c.Abort()
+			return
+		}
+
+		if err := h.db.TouchPersonalAccessToken(ctx, token.ID); err != nil {
+			log.Printf("Error recording use of personal access token %s: %v", token.ID, err)
+		}
+
+		c.Set("userID", token.UserID)
+		c.Set("personalAccessTokenID", token.ID)
+		c.Next()
+	}
+}
+
+// CreatePersonalAccessToken issues a long-lived token for scripts. The raw
+// token is only returned here.
+func (h *AuthHandler) CreatePersonalAccessToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !slices.Contains(validScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown scope %q", scope), "valid_scopes": validScopes})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	expiresInDays := req.ExpiresInDays
+	if expiresInDays == 0 {
+		expiresInDays = defaultAccessTokenExpiryDays
+	}
+
+	active, err := h.db.CountActivePersonalAccessTokens(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Error counting personal access tokens for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	if active >= maxActivePersonalAccessTokens {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("You can have at most %d active tokens", maxActivePersonalAccessTokens)})
+		return
+	}
+
+	rawToken, tokenHash, err := generatePersonalAccessToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	token, err := h.db.InsertPersonalAccessToken(ctx, db.InsertPersonalAccessTokenParams{
+		UserID:      claims.UserID,
+		Name:        strings.TrimSpace(req.Name),
+		TokenHash:   tokenHash,
+		TokenPrefix: rawToken[:personalAccessTokenPrefixLen],
+		Scopes:      scopes,
+		ExpiresAt:   pgtype.Timestamp{Time: time.Now().UTC().AddDate(0, 0, expiresInDays), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error storing personal access token for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	log.Printf("Personal access token %s created for user %s with scopes %v", token.ID, claims.UserID, scopes)
+	c.JSON(http.StatusCreated, gin.H{"token": rawToken, "access_token": toPersonalAccessToken(token)})
+}
+
+func (h *AuthHandler) GetPersonalAccessTokens(c *gin.Context) {
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	tokens, err := h.db.GetPersonalAccessTokensForUser(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error loading personal access tokens for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+
+	views := make([]PersonalAccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		views = append(views, toPersonalAccessToken(token))
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+func (h *AuthHandler) RevokePersonalAccessToken(c *gin.Context) {
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("tokenID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	revoked, err := h.db.RevokePersonalAccessToken(c.Request.Context(), db.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Error revoking personal access token %s for user %s: %v", tokenID, claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	log.Printf("Personal access token %s revoked for user %s", tokenID, claims.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
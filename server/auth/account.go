@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/mailer"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// emailChangeRevertTTL is how long the old address can undo an email change.
+const emailChangeRevertTTL = 7 * 24 * time.Hour
+
+// ChangePassword sets a new password after checking the current one. Every
+// session except the one making the request is revoked. Accounts without a
+// password set their first one here from a recent login.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	currentFamilyID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session in token"})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for password change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	if err := qtx.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		ID:       user.ID,
+		Password: pgtype.Text{String: string(hash), Valid: true},
+	}); err != nil {
+		log.Printf("Error updating password for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// A reset link requested before the change must not undo it.
+	if err := qtx.InvalidatePasswordResetTokensForUser(ctx, user.ID); err != nil {
+		log.Printf("Error invalidating password reset tokens for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Tokens a compromised account handed out must stop working too.
+	if err := qtx.RevokePersonalAccessTokensForUser(ctx, user.ID); err != nil {
+		log.Printf("Error revoking personal access tokens after password change for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	revokedFamilies, err := qtx.RevokeOtherSessionsForUser(ctx, db.RevokeOtherSessionsForUserParams{
+		UserID:   user.ID,
+		FamilyID: currentFamilyID,
+	})
+	if err != nil {
+		log.Printf("Error revoking other sessions after password change for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit password change for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := h.revocations.RevokeSessions(ctx, user.ID, revokedFamilies); err != nil {
+		log.Printf("Warning: password change for user %s succeeded but other sessions' access tokens could not be revoked: %v", user.ID, err)
+	}
+
+	h.sendAsync(user.ID, passwordChangedEmail(user.Email))
+
+	log.Printf("Password changed for user %s, revoked %d other session(s)", user.ID, len(revokedFamilies))
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// ChangeEmail starts moving the account to a new address after checking the
+// password. The account keeps its current address until the new one is
+// confirmed through VerifyEmail. The current address is told about the
+// request and gets a token that undoes it.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	newEmail := strings.TrimSpace(req.NewEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the same as the current one"})
+		return
+	}
+
+	// Checked again when the change is confirmed.
+	if _, err := h.db.GetUserByEmail(ctx, newEmail); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error checking new email for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	revertToken, revertTokenHash, err := generateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating email change revert token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for email change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	verification, err := h.startEmailVerification(ctx, qtx, user.ID, newEmail)
+	if err != nil {
+		log.Printf("Error creating email verification token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	if err := qtx.InsertEmailChangeRevertToken(ctx, db.InsertEmailChangeRevertTokenParams{
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		TokenHash: revertTokenHash,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(emailChangeRevertTTL), Valid: true},
+	}); err != nil {
+		log.Printf("Error storing email change revert token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit email change for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	h.sendAsync(user.ID, verification)
+	h.sendAsync(user.ID, emailChangeRequestedEmail(user.Email, newEmail, revertToken))
+
+	log.Printf("Email change requested for user %s", user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Check your new address for a verification email. Your email changes once it's verified.",
+		"pending_email": newEmail,
+	})
+}
+
+// RevertEmailChange is used from the old address when someone else changed
+// the account's email. It restores that address and cancels any pending
+// change, then locks the account: the password, passkeys, linked identities
+// and two-factor authentication are removed, outstanding password reset
+// tokens are voided and every session and personal access token is revoked,
+// so getting back in takes a password reset sent to the restored address.
+func (h *AuthHandler) RevertEmailChange(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req RevertEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for email change revert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	revert, err := qtx.GetEmailChangeRevertTokenByHashForUpdate(ctx, hashOpaqueToken(req.Token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		} else {
+			log.Printf("Error loading email change revert token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		}
+		return
+	}
+
+	if revert.UsedAt.Valid || time.Now().UTC().After(revert.ExpiresAt.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if _, err := qtx.ChangeUserEmail(ctx, db.ChangeUserEmailParams{ID: revert.UserID, Email: revert.OldEmail}); err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The previous address now belongs to another account"})
+			return
+		}
+		log.Printf("Error restoring email for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.InvalidateEmailVerificationTokensForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error cancelling pending email change for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.InvalidateEmailChangeRevertTokensForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error consuming email change revert tokens for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{ID: revert.UserID}); err != nil {
+		log.Printf("Error clearing password for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.InvalidatePasswordResetTokensForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error invalidating password reset tokens for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.DeleteWebAuthnCredentialsForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error removing passkeys for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.DeleteUserIdentitiesForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error unlinking identities for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.DeleteUserTOTP(ctx, revert.UserID); err != nil {
+		log.Printf("Error removing two-factor authentication for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodesForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error removing recovery codes for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	revokedFamilies, err := qtx.RevokeAllSessionsForUser(ctx, revert.UserID)
+	if err != nil {
+		log.Printf("Error revoking sessions after email change revert for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := qtx.RevokePersonalAccessTokensForUser(ctx, revert.UserID); err != nil {
+		log.Printf("Error revoking personal access tokens after email change revert for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit email change revert for user %s: %v", revert.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		return
+	}
+
+	if err := h.revocations.RevokeSessions(ctx, revert.UserID, revokedFamilies); err != nil {
+		log.Printf("Warning: email change revert for user %s succeeded but access tokens could not be revoked: %v", revert.UserID, err)
+	}
+
+	log.Printf("Email change reverted and account locked for user %s", revert.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Email change undone. Reset your password to sign in again."})
+}
+
+func passwordChangedEmail(to string) mailer.Message {
+	body := "The password for your account was just changed and your other devices were signed out.\n\n" +
+		"If this wasn't you, reset your password right away.\n"
+	return mailer.Message{To: to, Subject: "Your password was changed", Body: body}
+}
+
+func emailChangeRequestedEmail(to string, newEmail string, revertToken string) mailer.Message {
+	body := fmt.Sprintf(
+		"Someone asked to change the email address on your account to %s. "+
+			"This address stays on the account until the new one is verified.\n\n"+
+			"If this wasn't you, undo the change with this code:\n\n%s\n\n"+
+			"This also signs out every device and removes your password, passkeys, linked sign-in providers and two-factor authentication, so you'll need to reset your password and set them up again. "+
+			"The code works for %d days, even after the new address is verified.\n",
+		newEmail, revertToken, int(emailChangeRevertTTL.Hours()/24),
+	)
+	if revertURL := os.Getenv("EMAIL_REVERT_URL"); revertURL != "" {
+		body += fmt.Sprintf("\nOr open: %s?token=%s\n", revertURL, revertToken)
+	}
+	return mailer.Message{To: to, Subject: "Your email address is being changed", Body: body}
+}
@@ -10,69 +10,118 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+func JWTAuthMiddleware(revocations *RevocationStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "Authorization header required"},
-			)
-			c.Abort()
+		tokenString, ok := bearerToken(c)
+		if !ok {
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.JSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "Authorization header format must be Bearer {token}"},
-			)
+		if isPersonalAccessToken(tokenString) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens can't be used for this endpoint."})
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-		if tokenString == "" {
-			c.JSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "Bearer token is missing"},
-			)
-			c.Abort()
-			return
+		if authenticateJWT(c, revocations, tokenString) {
+			c.Next()
 		}
+	}
+}
 
-		userID, err := ValidateToken(tokenString)
+// bearerToken extracts the token from the Authorization header, aborting with
+// 401 when it is missing or malformed.
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(
+			http.StatusUnauthorized,
+			gin.H{"error": "Authorization header required"},
+		)
+		c.Abort()
+		return "", false
+	}
 
-		if err != nil {
-			var statusCode int
-			var clientMessage string
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		c.JSON(
+			http.StatusUnauthorized,
+			gin.H{"error": "Authorization header format must be Bearer {token}"},
+		)
+		c.Abort()
+		return "", false
+	}
 
-			if errors.Is(err, jwt.ErrTokenMalformed) {
-				statusCode = http.StatusUnauthorized
-				clientMessage = "Invalid token format."
-			} else if errors.Is(err, jwt.ErrTokenExpired) {
-				statusCode = http.StatusUnauthorized
-				clientMessage = "Token has expired."
-			} else if errors.Is(err, jwt.ErrTokenNotValidYet) {
-				statusCode = http.StatusUnauthorized
-				clientMessage = "Token not yet valid."
-			} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
-				statusCode = http.StatusUnauthorized
-				clientMessage = "Invalid token signature."
-			} else {
-				statusCode = http.StatusUnauthorized
-				clientMessage = "Invalid token."
-				log.Printf("Token validation failed with unexpected error: %v", err)
-			}
+	tokenString := parts[1]
+	if tokenString == "" {
+		c.JSON(
+			http.StatusUnauthorized,
+			gin.H{"error": "Bearer token is missing"},
+		)
+		c.Abort()
+		return "", false
+	}
+	return tokenString, true
+}
 
-			c.JSON(statusCode, gin.H{"error": clientMessage})
-			c.Abort()
-			return
+// authenticateJWT validates a login access token and stores its claims on the
+// context, aborting the request if it is invalid or revoked.
+func authenticateJWT(c *gin.Context, revocations *RevocationStore, tokenString string) bool {
+	claims, err := ParseToken(tokenString)
+
+	if err != nil {
+		var statusCode int
+		var clientMessage string
+
+		if errors.Is(err, jwt.ErrTokenMalformed) {
+			statusCode = http.StatusUnauthorized
+			clientMessage = "Invalid token format."
+		} else if errors.Is(err, jwt.ErrTokenExpired) {
+			statusCode = http.StatusUnauthorized
+			clientMessage = "Token has expired."
+		} else if errors.Is(err, jwt.ErrTokenNotValidYet) {
+			statusCode = http.StatusUnauthorized
+			clientMessage = "Token not yet valid."
+		} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			statusCode = http.StatusUnauthorized
+			clientMessage = "Invalid token signature."
+		} else {
+			statusCode = http.StatusUnauthorized
+			clientMessage = "Invalid token."
+			log.Printf("Token validation failed with unexpected error: %v", err)
 		}
 
-		c.Set("userID", userID)
+		c.JSON(statusCode, gin.H{"error": clientMessage})
+		c.Abort()
+		return false
+	}
+
+	revoked, err := revocations.IsRevoked(c.Request.Context(), claims)
+	if err != nil {
+		log.Printf("Error checking token revocation for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token."})
+		c.Abort()
+		return false
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked."})
+		c.Abort()
+		return false
+	}
 
-		c.Next()
+	c.Set("userID", claims.UserID)
+	c.Set("claims", claims)
+	return true
+}
+
+func GetClaims(c *gin.Context) (*Claims, error) {
+	value, exists := c.Get("claims")
+	if !exists {
+		return nil, errors.New("token claims not found")
+	}
+	claims, ok := value.(*Claims)
+	if !ok {
+		return nil, errors.New("token claims have unexpected type")
 	}
+	return claims, nil
 }
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Vectors from RFC 8949 Appendix A.
+	tests := []struct {
+		name string
+		hex  string
+		want any
+	}{
+		{"zero", "00", int64(0)},
+		{"small int", "17", int64(23)},
+		{"one byte int", "1818", int64(24)},
+		{"two byte int", "1903e8", int64(1000)},
+		{"four byte int", "1a000f4240", int64(1000000)},
+		{"eight byte int", "1b000000e8d4a51000", int64(1000000000000)},
+		{"negative one", "20", int64(-1)},
+		{"negative", "3863", int64(-100)},
+		{"negative two byte", "3903e7", int64(-1000)},
+		{"empty bytes", "40", []byte{}},
+		{"bytes", "4401020304", []byte{1, 2, 3, 4}},
+		{"empty text", "60", ""},
+		{"text", "6449455446", "IETF"},
+		{"utf8 text", "62c3bc", "ü"},
+		{"empty array", "80", []any{}},
+		{"array", "83010203", []any{int64(1), int64(2), int64(3)}},
+		{"nested array", "8301820203820405", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"empty map", "a0", map[any]any{}},
+		{"int map", "a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"text map", "a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"false", "f4", false},
+		{"true", "f5", true},
+		{"null", "f6", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, n, err := decodeCBOR(data)
+			if err != nil {
+				t.Fatalf("decodeCBOR(%s) error: %v", tt.hex, err)
+			}
+			if n != len(data) {
+				t.Errorf("decodeCBOR(%s) used %d bytes, want %d", tt.hex, n, len(data))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR(%s) = %#v, want %#v", tt.hex, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORReturnsFirstItemLength(t *testing.T) {
+	got, n, err := decodeCBOR([]byte{0x42, 0xaa, 0xbb, 0x01, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || !bytes.Equal(got.([]byte), []byte{0xaa, 0xbb}) {
+		t.Errorf("decodeCBOR = %x, %d; want aabb, 3", got, n)
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"truncated argument", "1903"},
+		{"truncated bytes", "4401"},
+		{"truncated text", "6261"},
+		{"truncated array", "830102"},
+		{"truncated map", "a2010203"},
+		{"huge array length", "9bffffffffffffffff"},
+		{"huge map length", "bbffffffffffffffff"},
+		{"huge byte string length", "5bffffffffffffffff"},
+		{"uint overflow", "1bffffffffffffffff"},
+		{"negative overflow", "3bffffffffffffffff"},
+		{"indefinite bytes", "5f42010243030405ff"},
+		{"indefinite array", "9f01ff"},
+		{"reserved additional info", "1c"},
+		{"tag", "c074323031332d30332d32315432303a30343a30305a"},
+		{"half float", "f93c00"},
+		{"undefined", "f7"},
+		{"bytes map key", "a1400102"},
+		{"array map key", "a18001"},
+		{"too deep", "818181818181818181818181818181818181818100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, err := decodeCBOR(data); err == nil {
+				t.Errorf("decodeCBOR(%s) = %#v, want error", tt.hex, got)
+			}
+		})
+	}
+}
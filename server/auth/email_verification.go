@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/mailer"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// startEmailVerification replaces any outstanding verification token for the
+// user with a new one for the given address and returns the email to send.
+func (h *AuthHandler) startEmailVerification(
+	ctx context.Context,
+	queries *db.Queries,
+	userID uuid.UUID,
+	email string,
+) (mailer.Message, error) {
+	token, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	if err := queries.InvalidateEmailVerificationTokensForUser(ctx, userID); err != nil {
+		return mailer.Message{}, err
+	}
+
+	_, err = queries.InsertEmailVerificationToken(ctx, db.InsertEmailVerificationTokenParams{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: tokenHash,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(emailVerificationTTL), Valid: true},
+	})
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	return verificationEmail(email, token), nil
+}
+
+func (h *AuthHandler) sendAsync(userID uuid.UUID, msg mailer.Message) {
+	go func() {
+		if err := h.mailer.Send(h.ctx, msg); err != nil {
+			log.Printf("Error sending %q email for user %s: %v", msg.Subject, userID, err)
+		}
+	}()
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for email verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	verification, err := qtx.GetEmailVerificationTokenByHashForUpdate(ctx, hashOpaqueToken(req.Token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		} else {
+			log.Printf("Error loading email verification token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		}
+		return
+	}
+
+	if verification.UsedAt.Valid || time.Now().UTC().After(verification.ExpiresAt.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	updated, err := qtx.MarkUserEmailVerified(ctx, db.MarkUserEmailVerifiedParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		log.Printf("Error marking email verified for user %s: %v", verification.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	emailChanged := updated == 0
+	if emailChanged {
+		// Only the latest token is unused, so one for another address confirms
+		// the pending change from ChangeEmail.
+		if _, err := qtx.ChangeUserEmail(ctx, db.ChangeUserEmailParams{
+			ID:    verification.UserID,
+			Email: verification.Email,
+		}); err != nil {
+			if isUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+				return
+			}
+			log.Printf("Error changing email for user %s: %v", verification.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+	}
+
+	if err := qtx.MarkEmailVerificationTokenUsed(ctx, verification.ID); err != nil {
+		log.Printf("Error consuming email verification token for user %s: %v", verification.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit email verification for user %s: %v", verification.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	if emailChanged {
+		log.Printf("Email changed for user %s", verification.UserID)
+		c.JSON(http.StatusOK, gin.H{"message": "Email changed", "email": verification.Email})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+func (h *AuthHandler) ResendEmailVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	user, err := h.db.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	verifiedAt, err := h.db.GetUserEmailVerifiedAt(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading verification status for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	if verifiedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	msg, err := h.startEmailVerification(ctx, h.db, user.ID, user.Email)
+	if err != nil {
+		log.Printf("Error creating email verification for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	h.sendAsync(user.ID, msg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+func verificationEmail(to string, token string) mailer.Message {
+	body := fmt.Sprintf(
+		"Confirm this address to finish setting up your account.\n\n"+
+			"Your verification code is:\n\n%s\n\n"+
+			"It expires in %d hours. Until the address is verified, group admins can't invite you by email.\n",
+		token, int(emailVerificationTTL.Hours()),
+	)
+	if verifyURL := os.Getenv("EMAIL_VERIFICATION_URL"); verifyURL != "" {
+		body += fmt.Sprintf("\nOr open: %s?token=%s\n", verifyURL, token)
+	}
+	return mailer.Message{To: to, Subject: "Verify your email address", Body: body}
+}
@@ -2,60 +2,254 @@ package auth
 
 import (
 	"chat-app-server/db"
+	"chat-app-server/mailer"
 	"context"
+	"crypto/ed25519"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	db   *db.Queries
-	ctx  context.Context
-	conn *pgxpool.Pool
+	db          *db.Queries
+	ctx         context.Context
+	conn        *pgxpool.Pool
+	revocations *RevocationStore
+	mailer      mailer.Mailer
+	limiter     *RateLimiter
+	oidc        *OIDCProvider
+	webauthn    *WebAuthnConfig
+
+	deviceKeysChanged DeviceKeysChangedFunc
 }
 
-func NewAuthHandler(db *db.Queries, ctx context.Context, conn *pgxpool.Pool) *AuthHandler {
+// DeviceKeysChangedFunc tells the user's group peers that their device keys
+// changed. It is provided by the websocket hub.
+type DeviceKeysChangedFunc func(ctx context.Context, userID uuid.UUID, removedDeviceIdentifiers []string) error
+
+func NewAuthHandler(
+	db *db.Queries,
+	ctx context.Context,
+	conn *pgxpool.Pool,
+	revocations *RevocationStore,
+	mailer mailer.Mailer,
+	limiter *RateLimiter,
+	oidc *OIDCProvider,
+	webauthn *WebAuthnConfig,
+) *AuthHandler {
 	return &AuthHandler{
-		db:   db,
-		ctx:  ctx,
-		conn: conn,
+		db:          db,
+		ctx:         ctx,
+		conn:        conn,
+		revocations: revocations,
+		mailer:      mailer,
+		limiter:     limiter,
+		oidc:        oidc,
+		webauthn:    webauthn,
 	}
 }
 
+func (h *AuthHandler) SetDeviceKeysChangedFunc(fn DeviceKeysChangedFunc) {
+	h.deviceKeysChanged = fn
+}
+
+// registerOrUpdateDeviceKey stores a device key after checking its signature
+// against the user's identity key. The first device to register sets the
+// identity key; after that a different identity_key is rejected with
+// ErrIdentityKeyMismatch and has to go through an identity key reset instead.
+// Errors wrapping ErrInvalidDeviceKey are the client's fault.
 func (h *AuthHandler) registerOrUpdateDeviceKey(
 	ctx context.Context,
 	userID uuid.UUID,
-	deviceIdentifier string,
-	base64PublicKey string,
+	device DeviceKeyUpload,
 ) error {
-	publicKeyBytes, err := base64.StdEncoding.DecodeString(base64PublicKey)
+	var identityKey ed25519.PublicKey
+	newIdentityKey := false
+	stored, err := h.db.GetUserIdentityKey(ctx, userID)
+	switch {
+	case err == nil:
+		identityKey = stored.PublicKey
+		if device.IdentityKey != "" && device.IdentityKey != base64.StdEncoding.EncodeToString(identityKey) {
+			return ErrIdentityKeyMismatch
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		if device.IdentityKey == "" {
+			return fmt.Errorf("%w: identity_key is required for the account's first device", ErrInvalidDeviceKey)
+		}
+		if identityKey, err = DecodeIdentityKey(device.IdentityKey); err != nil {
+			return err
+		}
+		newIdentityKey = true
+	default:
+		log.Printf("Error loading identity key for user %s: %v", userID, err)
+		return err
+	}
+
+	publicKeyBytes, signature, err := verifyDeviceKeyUpload(identityKey, device)
 	if err != nil {
-		log.Printf("Error decoding public key for user %s, device %s: %v", userID, deviceIdentifier, err)
+		log.Printf("Rejected device key for user %s, device %s: %v", userID, device.DeviceIdentifier, err)
 		return err
 	}
 
+	if newIdentityKey {
+		_, err := h.db.InsertUserIdentityKey(ctx, db.InsertUserIdentityKeyParams{
+			UserID:    userID,
+			PublicKey: identityKey,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Another login set the identity key first; check against that one.
+			return h.registerOrUpdateDeviceKey(ctx, userID, device)
+		}
+		if err != nil {
+			log.Printf("Error storing identity key for user %s: %v", userID, err)
+			return err
+		}
+		log.Printf("Identity key set for user %s", userID)
+	}
+
 	_, err = h.db.RegisterDeviceKey(ctx, db.RegisterDeviceKeyParams{
 		UserID:           userID,
-		DeviceIdentifier: deviceIdentifier,
+		DeviceIdentifier: device.DeviceIdentifier,
 		PublicKey:        publicKeyBytes,
+		Signature:        signature,
 	})
 	if err != nil {
-		log.Printf("Error registering/updating device key for user %s, device %s: %v", userID, deviceIdentifier, err)
+		log.Printf("Error registering/updating device key for user %s, device %s: %v", userID, device.DeviceIdentifier, err)
 		return err
 	}
-	log.Printf("Device key registered/updated for user %s, device %s", userID, deviceIdentifier)
+	log.Printf("Device key registered/updated for user %s, device %s", userID, device.DeviceIdentifier)
 	return nil
 }
 
+// ReplaceIdentityKey sets the user's identity key and removes every device but
+// keepDevice, whose key must already be signed by the new identity key. It
+// returns the removed devices and the session families the caller has to
+// denylist once the transaction commits.
+func ReplaceIdentityKey(
+	ctx context.Context,
+	qtx *db.Queries,
+	userID uuid.UUID,
+	identityKey ed25519.PublicKey,
+	keepDevice string,
+) ([]string, []uuid.UUID, error) {
+	if _, err := qtx.ReplaceUserIdentityKey(ctx, db.ReplaceUserIdentityKeyParams{
+		UserID:    userID,
+		PublicKey: identityKey,
+	}); err != nil {
+		return nil, nil, fmt.Errorf("replacing identity key: %w", err)
+	}
+
+	removed, err := qtx.DeleteOtherDeviceKeysForUser(ctx, db.DeleteOtherDeviceKeysForUserParams{
+		UserID:           userID,
+		DeviceIdentifier: keepDevice,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("deleting other device keys: %w", err)
+	}
+
+	familyIDs, err := qtx.RevokeSessionsForOtherDevices(ctx, db.RevokeSessionsForOtherDevicesParams{
+		UserID:           userID,
+		DeviceIdentifier: keepDevice,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("revoking other device sessions: %w", err)
+	}
+
+	if removed == nil {
+		removed = []string{}
+	}
+	return removed, familyIDs, nil
+}
+
+// resetIdentityKeyAtLogin is how a user who lost every device holding their
+// identity private key gets back in: once the password and second factor
+// have passed, the login's identity key replaces the account's and the
+// logging-in device becomes the only one.
+func (h *AuthHandler) resetIdentityKeyAtLogin(ctx context.Context, userID uuid.UUID, device DeviceKeyUpload) error {
+	identityKey, err := DecodeIdentityKey(device.IdentityKey)
+	if err != nil {
+		return err
+	}
+	publicKeyBytes, signature, err := verifyDeviceKeyUpload(identityKey, device)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	if _, err := qtx.RegisterDeviceKey(ctx, db.RegisterDeviceKeyParams{
+		UserID:           userID,
+		DeviceIdentifier: device.DeviceIdentifier,
+		PublicKey:        publicKeyBytes,
+		Signature:        signature,
+	}); err != nil {
+		return fmt.Errorf("registering device key: %w", err)
+	}
+
+	removed, familyIDs, err := ReplaceIdentityKey(ctx, qtx, userID, identityKey, device.DeviceIdentifier)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("User %s reset their identity key at login, removing %d other device(s)", userID, len(removed))
+	if err := h.revocations.RevokeSessions(ctx, userID, familyIDs); err != nil {
+		log.Printf("Error denylisting sessions of removed devices for user %s: %v", userID, err)
+	}
+	if h.deviceKeysChanged != nil {
+		if err := h.deviceKeysChanged(ctx, userID, removed); err != nil {
+			log.Printf("Error publishing device key change for user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// issueSession stores a new refresh token in the given family and returns the
+// raw token for the client.
+func (h *AuthHandler) issueSession(
+	ctx context.Context,
+	queries *db.Queries,
+	userID uuid.UUID,
+	deviceIdentifier string,
+	familyID uuid.UUID,
+) (string, error) {
+	refreshToken, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = queries.InsertSession(ctx, db.InsertSessionParams{
+		UserID:           userID,
+		FamilyID:         familyID,
+		RefreshTokenHash: tokenHash,
+		DeviceIdentifier: deviceIdentifier,
+		ExpiresAt:        pgtype.Timestamp{Time: time.Now().UTC().Add(refreshTokenTTL), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
 func (h *AuthHandler) Signup(c *gin.Context) {
 	ctx := c.Request.Context()
 	var req SignupRequest
@@ -64,6 +258,21 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
+	if h.throttle(c, "signup_ip", c.ClientIP(), signupIPLimit) {
+		return
+	}
+
+	// Check the device key up front so a bad upload doesn't leave behind an
+	// account without a usable device.
+	identityKey, err := DecodeIdentityKey(req.IdentityKey)
+	if err == nil {
+		_, _, err = verifyDeviceKeyUpload(identityKey, req.DeviceKeyUpload)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	pwd := []byte(req.Password)
 	hash, err := bcrypt.GenerateFromPassword(pwd, 12)
 	if err != nil {
@@ -78,28 +287,32 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	if err := h.registerOrUpdateDeviceKey(ctx, user.ID, req.DeviceIdentifier, req.PublicKey); err != nil {
+	if msg, err := h.startEmailVerification(ctx, h.db, user.ID, user.Email); err != nil {
+		log.Printf("Warning: User %s signed up, but email verification could not be started: %v", user.ID, err)
+	} else {
+		h.sendAsync(user.ID, msg)
+	}
+
+	if err := h.registerOrUpdateDeviceKey(ctx, user.ID, req.DeviceKeyUpload); err != nil {
 		log.Printf("Warning: User %s signed up, but device key registration failed: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup succeeded but failed to register device."})
 		return
 	}
 
-	claims := Claims{
-		UserID: user.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		},
+	sessionID := uuid.New()
+	tokenString, err := GenerateAccessToken(user.ID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	refreshToken, err := h.issueSession(ctx, h.db, user.ID, req.DeviceIdentifier, sessionID)
 	if err != nil {
+		log.Printf("Error creating session for user %s after signup: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refresh_token": refreshToken})
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -110,6 +323,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	if h.throttle(c, "login_ip", c.ClientIP(), loginIPLimit) || h.accountLockedOut(c, req.Email) {
+		return
+	}
+
 	user, err := h.db.GetUserByEmailInternal(ctx, req.Email)
 	if err != nil {
 		dummyHash := []byte("$2a$12$ZHc6p51/1IsM/4/hz/sUvezdkXuT1IF75EF5nyKyRTu7XyGDd0PM2")
@@ -117,6 +334,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(req.Password))
 
 		log.Printf("Login attempt for non-existent or problematic email %s (timing mitigation active): %v", req.Email, err)
+		h.recordLoginFailure(c, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login failed: Invalid credentials"})
 		return
 	}
@@ -131,29 +349,224 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	err = bcrypt.CompareHashAndPassword(pwd, []byte(req.Password))
 	if err != nil {
 		log.Printf("Login attempt failed for email %s: incorrect password.", req.Email)
+		h.recordLoginFailure(c, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login failed: Invalid credentials"})
 		return
 	}
 
-	if err := h.registerOrUpdateDeviceKey(ctx, user.ID, req.DeviceIdentifier, req.PublicKey); err != nil {
-		log.Printf("Warning: User %s logged in, but device key registration/update failed: %v", user.ID, err)
+	// Failures are only cleared once the whole login has gone through, so a
+	// correct password doesn't buy more guesses at the second factor.
+	if h.finishFirstFactor(c, user.ID, user.Username, req.DeviceKeyUpload, req.ResetIdentityKey) {
+		h.clearLoginFailures(c, user.ID, req.Email)
+	}
+}
+
+// finishFirstFactor is called once the user has proven who they are with a
+// password or identity provider. Accounts with 2FA get an mfa pending token,
+// everyone else is logged in. resetIdentityKey is only ever set by password
+// logins. It reports whether the user is now logged in.
+func (h *AuthHandler) finishFirstFactor(
+	c *gin.Context,
+	userID uuid.UUID,
+	username string,
+	device DeviceKeyUpload,
+	resetIdentityKey bool,
+) bool {
+	ctx := c.Request.Context()
+	totp, err := h.db.GetUserTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error loading two-factor settings for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return false
+	}
+	if err == nil && totp.EnabledAt.Valid {
+		mfaToken, err := h.startMFAChallenge(ctx, userID, device, resetIdentityKey)
+		if err != nil {
+			log.Printf("Error creating mfa challenge for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return false
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": mfaToken})
+		return false
+	}
+
+	return h.completeLogin(c, userID, username, device, resetIdentityKey)
+}
+
+// completeLogin registers the device key and responds with a new session once
+// every login factor has been checked. A device signed by another identity key
+// than the account's is refused with identity_key_reset_required unless the
+// login asked for resetIdentityKey. It reports whether a session was issued.
+func (h *AuthHandler) completeLogin(
+	c *gin.Context,
+	userID uuid.UUID,
+	username string,
+	device DeviceKeyUpload,
+	resetIdentityKey bool,
+) bool {
+	ctx := c.Request.Context()
+	err := h.registerOrUpdateDeviceKey(ctx, userID, device)
+	if errors.Is(err, ErrIdentityKeyMismatch) {
+		if !resetIdentityKey {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "identity_key_reset_required": true})
+			return false
+		}
+		err = h.resetIdentityKeyAtLogin(ctx, userID, device)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidDeviceKey) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		log.Printf("Warning: User %s logged in, but device key registration/update failed: %v", userID, err)
+	}
+
+	sessionID := uuid.New()
+	tokenString, err := GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		log.Printf("Error signing token for user %s after login: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return false
+	}
+
+	refreshToken, err := h.issueSession(ctx, h.db, userID, device.DeviceIdentifier, sessionID)
+	if err != nil {
+		log.Printf("Error creating session for user %s after login: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return false
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refresh_token": refreshToken, "user_id": userID, "username": username})
+	return true
+}
+
+// Refresh exchanges a refresh token for a new access/refresh pair. Each refresh
+// token is single-use: presenting one that was already rotated means it leaked,
+// so the whole session family is revoked.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for token refresh: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	session, err := qtx.GetSessionByTokenHashForUpdate(ctx, hashOpaqueToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		} else {
+			log.Printf("Error loading session for refresh: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		}
+		return
+	}
+
+	if session.RevokedAt.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	if session.RotatedAt.Valid {
+		if err := qtx.RevokeSessionFamily(ctx, session.FamilyID); err != nil {
+			log.Printf("Error revoking session family %s after refresh token reuse: %v", session.FamilyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			log.Printf("Failed to commit session family revocation %s: %v", session.FamilyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+		// Access tokens minted from the stolen refresh token stay valid until they
+		// expire unless the family is denylisted too.
+		if err := h.revocations.RevokeSessions(ctx, session.UserID, []uuid.UUID{session.FamilyID}); err != nil {
+			log.Printf("Error denylisting session family %s after refresh token reuse: %v", session.FamilyID, err)
+		}
+		log.Printf("Refresh token reuse detected for user %s, revoked session family %s", session.UserID, session.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	if time.Now().UTC().After(session.ExpiresAt.Time) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired"})
+		return
 	}
 
-	claims := Claims{
-		UserID: user.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		},
+	if err := qtx.MarkSessionRotated(ctx, session.ID); err != nil {
+		log.Printf("Error rotating session %s: %v", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	refreshToken, err := h.issueSession(ctx, qtx, session.UserID, session.DeviceIdentifier, session.FamilyID)
 	if err != nil {
-		log.Printf("Error signing token for user %s after login: %v", user.ID, err)
+		log.Printf("Error issuing rotated session for user %s: %v", session.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	tokenString, err := GenerateAccessToken(session.UserID, session.FamilyID)
+	if err != nil {
+		log.Printf("Error signing token for user %s during refresh: %v", session.UserID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString, "user_id": user.ID, "username": user.Username})
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit token refresh for user %s: %v", session.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	if err := h.db.UpdateDeviceKeyLastSeen(ctx, db.UpdateDeviceKeyLastSeenParams{
+		UserID:           session.UserID,
+		DeviceIdentifier: session.DeviceIdentifier,
+	}); err != nil {
+		log.Printf("Error updating last seen for user %s device %s: %v", session.UserID, session.DeviceIdentifier, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refresh_token": refreshToken})
+}
+
+// Logout ends the caller's session: the refresh token family is revoked in the
+// database and the current access token is denylisted until it expires.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	if claims.SessionID != "" {
+		familyID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session in token"})
+			return
+		}
+		if err := h.db.RevokeSessionFamily(ctx, familyID); err != nil {
+			log.Printf("Error revoking session family %s on logout for user %s: %v", familyID, claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	if err := h.revocations.RevokeToken(ctx, claims); err != nil {
+		log.Printf("Error revoking access token on logout for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// deviceKeySignatureContext domain-separates device key signatures from
+// anything else an identity key might be used to sign.
+const deviceKeySignatureContext = "chat-app device key v1"
+
+// signedPrekeySignatureContext does the same for X3DH signed prekeys.
+const signedPrekeySignatureContext = "chat-app signed prekey v1"
+
+// ErrInvalidDeviceKey wraps every reason a device key upload is rejected. The
+// wrapped message is safe to show to the client.
+var ErrInvalidDeviceKey = errors.New("invalid device key")
+
+// ErrIdentityKeyMismatch means a device key was signed by an identity key
+// other than the account's. It wraps ErrInvalidDeviceKey.
+var ErrIdentityKeyMismatch = fmt.Errorf("%w: identity_key does not match the account's identity key", ErrInvalidDeviceKey)
+
+// DeviceKeySignedMessage is what a user's identity key signs to vouch for one
+// of their devices: the context string, a zero byte, the big-endian uint16
+// length of the device identifier, the identifier and the raw device public
+// key. Clients build the same bytes to check signatures from
+// GetRelevantDeviceKeys.
+func DeviceKeySignedMessage(deviceIdentifier string, devicePublicKey []byte) []byte {
+	message := make([]byte, 0, len(deviceKeySignatureContext)+3+len(deviceIdentifier)+len(devicePublicKey))
+	message = append(message, deviceKeySignatureContext...)
+	message = append(message, 0)
+	message = binary.BigEndian.AppendUint16(message, uint16(len(deviceIdentifier)))
+	message = append(message, deviceIdentifier...)
+	return append(message, devicePublicKey...)
+}
+
+// DecodeIdentityKey parses a base64 Ed25519 identity public key.
+func DecodeIdentityKey(base64IdentityKey string) (ed25519.PublicKey, error) {
+	identityKey, err := base64.StdEncoding.DecodeString(base64IdentityKey)
+	if err != nil || len(identityKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: identity_key must be a base64 Ed25519 public key", ErrInvalidDeviceKey)
+	}
+	return ed25519.PublicKey(identityKey), nil
+}
+
+// VerifyDeviceKeySignature checks a base64 signature over the device key and
+// returns the decoded signature for storage.
+func VerifyDeviceKeySignature(
+	identityKey ed25519.PublicKey,
+	deviceIdentifier string,
+	devicePublicKey []byte,
+	base64Signature string,
+) ([]byte, error) {
+	if len(deviceIdentifier) > 0xffff {
+		return nil, fmt.Errorf("%w: device_identifier is too long", ErrInvalidDeviceKey)
+	}
+	signature, err := base64.StdEncoding.DecodeString(base64Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: device_key_signature must be a base64 Ed25519 signature", ErrInvalidDeviceKey)
+	}
+	if !ed25519.Verify(identityKey, DeviceKeySignedMessage(deviceIdentifier, devicePublicKey), signature) {
+		return nil, fmt.Errorf("%w: device_key_signature does not verify against the identity key", ErrInvalidDeviceKey)
+	}
+	return signature, nil
+}
+
+// SignedPrekeySignedMessage is what a user's identity key signs to vouch for a
+// device's signed prekey: the context string, a zero byte, the big-endian
+// uint16 length of the device identifier, the identifier, the big-endian
+// uint64 key ID and the raw prekey public key.
+func SignedPrekeySignedMessage(deviceIdentifier string, keyID int64, prekeyPublicKey []byte) []byte {
+	message := make([]byte, 0, len(signedPrekeySignatureContext)+11+len(deviceIdentifier)+len(prekeyPublicKey))
+	message = append(message, signedPrekeySignatureContext...)
+	message = append(message, 0)
+	message = binary.BigEndian.AppendUint16(message, uint16(len(deviceIdentifier)))
+	message = append(message, deviceIdentifier...)
+	message = binary.BigEndian.AppendUint64(message, uint64(keyID))
+	return append(message, prekeyPublicKey...)
+}
+
+// VerifySignedPrekeySignature checks a base64 signature over a signed prekey
+// and returns the decoded signature for storage.
+func VerifySignedPrekeySignature(
+	identityKey ed25519.PublicKey,
+	deviceIdentifier string,
+	keyID int64,
+	prekeyPublicKey []byte,
+	base64Signature string,
+) ([]byte, error) {
+	if len(deviceIdentifier) > 0xffff {
+		return nil, fmt.Errorf("%w: device_identifier is too long", ErrInvalidDeviceKey)
+	}
+	signature, err := base64.StdEncoding.DecodeString(base64Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: signature must be a base64 Ed25519 signature", ErrInvalidDeviceKey)
+	}
+	if !ed25519.Verify(identityKey, SignedPrekeySignedMessage(deviceIdentifier, keyID, prekeyPublicKey), signature) {
+		return nil, fmt.Errorf("%w: signed prekey signature does not verify against the identity key", ErrInvalidDeviceKey)
+	}
+	return signature, nil
+}
+
+// verifyDeviceKeyUpload checks an uploaded device key against identityKey and
+// returns the raw device public key and signature.
+func verifyDeviceKeyUpload(identityKey ed25519.PublicKey, device DeviceKeyUpload) ([]byte, []byte, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(device.PublicKey)
+	if err != nil || len(publicKey) == 0 {
+		return nil, nil, fmt.Errorf("%w: public_key must be base64", ErrInvalidDeviceKey)
+	}
+	signature, err := VerifyDeviceKeySignature(identityKey, device.DeviceIdentifier, publicKey, device.DeviceKeySignature)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey, signature, nil
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// verificationKey is a public key accepted for tokens whose kid header matches.
+type verificationKey struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// KeySet holds the private key access tokens are signed with and every public
+// key tokens may still be verified against. Rotating means adding a new key,
+// switching JWT_SIGNING_KID to it, and dropping the old key once tokens signed
+// with it have expired.
+type KeySet struct {
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    crypto.Signer
+	verification  map[string]verificationKey
+}
+
+var keys *KeySet
+
+// InitKeysFromEnv loads PEM keys named <kid>.pem from JWT_KEYS_DIR and signs
+// with the one named by JWT_SIGNING_KID. JWT_KEYS_DIR is required unless
+// JWT_EPHEMERAL_KEYS=1 opts in to a throwaway Ed25519 key, which is only
+// suitable for a single dev instance.
+func InitKeysFromEnv() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if os.Getenv("JWT_EPHEMERAL_KEYS") != "1" {
+			return fmt.Errorf("JWT_KEYS_DIR must be set (or JWT_EPHEMERAL_KEYS=1 for local development)")
+		}
+		log.Println("Warning: JWT_EPHEMERAL_KEYS set, signing tokens with an ephemeral key. Tokens will not survive restarts.")
+		ks, err := newEphemeralKeySet()
+		if err != nil {
+			return err
+		}
+		keys = ks
+		return nil
+	}
+
+	ks, err := LoadKeySet(dir, os.Getenv("JWT_SIGNING_KID"))
+	if err != nil {
+		return err
+	}
+	keys = ks
+	log.Printf("Loaded %d JWT verification key(s), signing with kid %q", len(ks.verification), ks.signingKID)
+	return nil
+}
+
+func LoadKeySet(dir string, signingKID string) (*KeySet, error) {
+	if signingKID == "" {
+		return nil, fmt.Errorf("JWT_SIGNING_KID must be set when JWT_KEYS_DIR is used")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{verification: make(map[string]verificationKey)}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT key %s: %w", kid, err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("JWT key %s is not PEM encoded", kid)
+		}
+
+		var public crypto.PublicKey
+		switch block.Type {
+		case "PRIVATE KEY":
+			private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing JWT private key %s: %w", kid, err)
+			}
+			signer, ok := private.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("JWT private key %s has unsupported type %T", kid, private)
+			}
+			public = signer.Public()
+			if kid == signingKID {
+				ks.signingKey = signer
+			}
+		case "PUBLIC KEY":
+			public, err = x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing JWT public key %s: %w", kid, err)
+			}
+		default:
+			return nil, fmt.Errorf("JWT key %s has unsupported PEM type %q", kid, block.Type)
+		}
+
+		method, err := signingMethodFor(public)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", kid, err)
+		}
+		ks.verification[kid] = verificationKey{kid: kid, method: method, public: public}
+	}
+
+	if ks.signingKey == nil {
+		return nil, fmt.Errorf("no private key found for JWT_SIGNING_KID %q in %s", signingKID, dir)
+	}
+	ks.signingKID = signingKID
+	ks.signingMethod = ks.verification[signingKID].method
+	return ks, nil
+}
+
+func newEphemeralKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid := "ephemeral"
+	return &KeySet{
+		signingKID:    kid,
+		signingMethod: jwt.SigningMethodEdDSA,
+		signingKey:    private,
+		verification: map[string]verificationKey{
+			kid: {kid: kid, method: jwt.SigningMethodEdDSA, public: public},
+		},
+	}, nil
+}
+
+func signingMethodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public.(type) {
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use Ed25519 or RSA", public)
+	}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingMethod, claims)
+	token.Header["kid"] = ks.signingKID
+	return token.SignedString(ks.signingKey)
+}
+
+// keyFunc selects the verification key by the token's kid header and makes
+// sure the token's algorithm matches that key.
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+func (ks *KeySet) jwks() []jwk {
+	kids := make([]string, 0, len(ks.verification))
+	for kid := range ks.verification {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := make([]jwk, 0, len(kids))
+	for _, kid := range kids {
+		key := ks.verification[kid]
+		entry := jwk{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			entry.Kty = "OKP"
+			entry.Crv = "Ed25519"
+			entry.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			entry.Kty = "RSA"
+			entry.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			entry.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		set = append(set, entry)
+	}
+	return set
+}
+
+// JWKS publishes the verification keys so other services can check our
+// access tokens without a shared secret.
+func JWKS(c *gin.Context) {
+	if keys == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "JWT keys not configured on server"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys.jwks()})
+}
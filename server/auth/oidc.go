@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcHTTPTimeout    = 10 * time.Second
+	oidcMetadataTTL    = time.Hour
+	oidcJWKSRefreshGap = time.Minute
+)
+
+// OIDCProvider is a relying-party client for a single OpenID Connect issuer
+// using the authorization code flow with PKCE. Discovery metadata and signing
+// keys are fetched lazily and cached.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	httpClient   *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	metadataAt    time.Time
+	signingKeys   map[string]crypto.PublicKey
+	jwksFetchedAt time.Time
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity is what we take from a verified ID token.
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// NewOIDCProviderFromEnv configures the provider from OIDC_ISSUER,
+// OIDC_CLIENT_ID, OIDC_CLIENT_SECRET (optional for public clients),
+// OIDC_REDIRECT_URL and OIDC_PROVIDER_NAME. It returns nil when OIDC_ISSUER is
+// not set, which disables OIDC sign-in.
+func NewOIDCProviderFromEnv() (*OIDCProvider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if clientID == "" || redirectURL == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL must be set when OIDC_ISSUER is used")
+	}
+
+	name := os.Getenv("OIDC_PROVIDER_NAME")
+	if name == "" {
+		name = "Single sign-on"
+	}
+
+	return &OIDCProvider{
+		Name:         name,
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		redirectURL:  redirectURL,
+		scopes:       []string{"openid", "email", "profile"},
+		httpClient:   &http.Client{Timeout: oidcHTTPTimeout},
+	}, nil
+}
+
+// pkceChallenge derives the S256 code challenge for a verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL returns where to send the user's browser.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the
+// verified ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*OIDCIdentity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("decoding token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("token response did not include an id_token")
+	}
+
+	return p.verifyIDToken(ctx, tokenResp.IDToken, nonce)
+}
+
+// oidcBool accepts both JSON booleans and the "true"/"false" strings some
+// providers send for email_verified.
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type idTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     oidcBool `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+	jwt.RegisteredClaims
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawToken string, nonce string) (*OIDCIdentity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.signingKey(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("invalid id_token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid id_token: missing sub")
+	}
+
+	return &OIDCIdentity{
+		Issuer:            p.Issuer,
+		Subject:           claims.Subject,
+		Email:             strings.TrimSpace(claims.Email),
+		EmailVerified:     bool(claims.EmailVerified),
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil && time.Since(p.metadataAt) < oidcMetadataTTL {
+		return p.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", metadata.Issuer, p.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing required endpoints")
+	}
+	p.metadata = &metadata
+	p.metadataAt = time.Now()
+	return p.metadata, nil
+}
+
+// signingKey returns the provider key for kid, refetching the JWKS (at most
+// once a minute) when the key is unknown so provider rotations are picked up.
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.jwksFetchedAt) < oidcJWKSRefreshGap {
+		return nil, fmt.Errorf("unknown provider signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	p.jwksFetchedAt = time.Now()
+	if err := p.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching provider JWKS: %w", err)
+	}
+
+	signingKeys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, raw := range set.Keys {
+		keyID, key, err := parseJWK(raw)
+		if err != nil {
+			log.Printf("Skipping provider JWK: %v", err)
+			continue
+		}
+		signingKeys[keyID] = key
+	}
+	p.signingKeys = signingKeys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown provider signing key %q", kid)
+}
+
+// lookupKey finds kid in the cached keys. Tokens without a kid are accepted
+// only when the provider publishes exactly one key.
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.signingKeys) == 1 {
+		for _, key := range p.signingKeys {
+			return key, true
+		}
+	}
+	key, ok := p.signingKeys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// parseJWK converts an RSA, EC or Ed25519 signing key from JWK form.
+func parseJWK(raw json.RawMessage) (string, crypto.PublicKey, error) {
+	var key struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return "", nil, err
+	}
+	if key.Use != "" && key.Use != "sig" {
+		return "", nil, fmt.Errorf("key %q is not a signing key", key.Kid)
+	}
+
+	decode := base64.RawURLEncoding.DecodeString
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return "", nil, fmt.Errorf("key %q: invalid modulus", key.Kid)
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return "", nil, fmt.Errorf("key %q: invalid exponent", key.Kid)
+		}
+		return key.Kid, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("key %q: unsupported curve %q", key.Kid, key.Crv)
+		}
+		x, errX := decode(key.X)
+		y, errY := decode(key.Y)
+		if errX != nil || errY != nil {
+			return "", nil, fmt.Errorf("key %q: invalid coordinates", key.Kid)
+		}
+		return key.Kid, &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if key.Crv != "Ed25519" {
+			return "", nil, fmt.Errorf("key %q: unsupported curve %q", key.Kid, key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return "", nil, fmt.Errorf("key %q: invalid Ed25519 key", key.Kid)
+		}
+		return key.Kid, ed25519.PublicKey(x), nil
+	default:
+		return "", nil, fmt.Errorf("key %q: unsupported key type %q", key.Kid, key.Kty)
+	}
+}
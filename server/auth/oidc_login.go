@@ -0,0 +1,538 @@
+package auth
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/mailer"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	oidcLoginStateTTL = 10 * time.Minute
+	maxUsernameLength = 255
+)
+
+func toLinkedIdentity(identity db.UserIdentity) LinkedIdentity {
+	linked := LinkedIdentity{
+		ID:        identity.ID,
+		Issuer:    identity.Issuer,
+		Email:     identity.Email.String,
+		CreatedAt: identity.CreatedAt.Time,
+	}
+	if identity.LastLoginAt.Valid {
+		linked.LastLoginAt = &identity.LastLoginAt.Time
+	}
+	return linked
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (h *AuthHandler) oidcEnabled(c *gin.Context) bool {
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return false
+	}
+	return true
+}
+
+// OIDCConfig tells the app whether to offer single sign-on and what to call it.
+func (h *AuthHandler) OIDCConfig(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "name": h.oidc.Name, "issuer": h.oidc.Issuer})
+}
+
+// beginOIDC stores a login state with fresh PKCE and nonce values and returns
+// the provider URL the app should open. Links record the user and the session
+// family that started them.
+func (h *AuthHandler) beginOIDC(
+	ctx context.Context,
+	device *DeviceKeyUpload,
+	linkUserID *uuid.UUID,
+	linkSessionID *uuid.UUID,
+) (string, error) {
+	state, stateHash, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, _, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, _, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := h.oidc.AuthorizationURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", err
+	}
+
+	params := db.InsertOIDCLoginStateParams{
+		StateHash:     stateHash,
+		Nonce:         nonce,
+		CodeVerifier:  codeVerifier,
+		LinkUserID:    linkUserID,
+		LinkSessionID: linkSessionID,
+		ExpiresAt:     pgtype.Timestamp{Time: time.Now().UTC().Add(oidcLoginStateTTL), Valid: true},
+	}
+	if device != nil {
+		params.DeviceIdentifier = pgtype.Text{String: device.DeviceIdentifier, Valid: true}
+		params.PublicKey = pgtype.Text{String: device.PublicKey, Valid: true}
+		params.DeviceKeySignature = pgtype.Text{String: device.DeviceKeySignature, Valid: true}
+		params.IdentityKey = pgtype.Text{String: device.IdentityKey, Valid: device.IdentityKey != ""}
+	}
+	_, err = h.db.InsertOIDCLoginState(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// StartOIDCLogin begins a sign-in through the identity provider. The device
+// key is held with the state and registered once the callback succeeds.
+func (h *AuthHandler) StartOIDCLogin(c *gin.Context) {
+	if !h.oidcEnabled(c) {
+		return
+	}
+	var req OIDCStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if h.throttle(c, "login_ip", c.ClientIP(), loginIPLimit) {
+		return
+	}
+
+	authURL, err := h.beginOIDC(c.Request.Context(), &req.DeviceKeyUpload, nil, nil)
+	if err != nil {
+		log.Printf("Error starting OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not reach the identity provider"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// StartOIDCLink begins linking a provider identity to the signed-in account.
+// Only the session that starts the link can complete it, so a leaked
+// authorization URL can't attach someone else's identity to the account.
+func (h *AuthHandler) StartOIDCLink(c *gin.Context) {
+	if !h.oidcEnabled(c) {
+		return
+	}
+	var req PasswordConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session in token"})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	authURL, err := h.beginOIDC(c.Request.Context(), nil, &user.ID, &sessionID)
+	if err != nil {
+		log.Printf("Error starting OIDC link for user %s: %v", user.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not reach the identity provider"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// CompleteOIDC redeems the code the provider redirected back with. Depending
+// on the stored state it either logs the user in or links the identity to the
+// account that started the flow. Completing a link needs the access token of
+// the session that started it.
+func (h *AuthHandler) CompleteOIDC(c *gin.Context) {
+	if !h.oidcEnabled(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if h.throttle(c, "login_ip", c.ClientIP(), loginIPLimit) {
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for OIDC callback: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	state, err := qtx.GetOIDCLoginStateByHashForUpdate(ctx, hashOpaqueToken(req.State))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in request"})
+		} else {
+			log.Printf("Error loading OIDC login state: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	if state.UsedAt.Valid || time.Now().UTC().After(state.ExpiresAt.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in request"})
+		return
+	}
+
+	// Consume the state before talking to the provider so it can't be replayed.
+	if err := qtx.MarkOIDCLoginStateUsed(ctx, state.ID); err != nil {
+		log.Printf("Error consuming OIDC login state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit OIDC login state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if state.LinkUserID != nil && !h.oidcLinkSessionMatches(c, state) {
+		return
+	}
+
+	identity, err := h.oidc.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in with the identity provider failed"})
+		return
+	}
+
+	if state.LinkUserID != nil {
+		h.linkOIDCIdentity(c, *state.LinkUserID, identity)
+		return
+	}
+
+	userID, username, ok := h.resolveOIDCUser(c, identity)
+	if !ok {
+		return
+	}
+	log.Printf("User %s signed in via OIDC issuer %s", userID, identity.Issuer)
+	h.finishFirstFactor(c, userID, username, DeviceKeyUpload{
+		DeviceIdentifier:   state.DeviceIdentifier.String,
+		PublicKey:          state.PublicKey.String,
+		DeviceKeySignature: state.DeviceKeySignature.String,
+		IdentityKey:        state.IdentityKey.String,
+	}, false)
+}
+
+// oidcLinkSessionMatches authenticates the callback of a link and checks it
+// comes from the session that started it, writing the error response when it
+// doesn't.
+func (h *AuthHandler) oidcLinkSessionMatches(c *gin.Context, state db.OidcLoginState) bool {
+	tokenString, ok := bearerToken(c)
+	if !ok || !authenticateJWT(c, h.revocations, tokenString) {
+		return false
+	}
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return false
+	}
+	if claims.UserID != *state.LinkUserID || state.LinkSessionID == nil || claims.SessionID != state.LinkSessionID.String() {
+		log.Printf("Rejected OIDC link callback for user %s from another session", *state.LinkUserID)
+		c.JSON(http.StatusForbidden, gin.H{"error": "This link was started from another session"})
+		return false
+	}
+	return true
+}
+
+// resolveOIDCUser finds the account for a provider identity. Unknown
+// identities are linked to an existing account with the same email only when
+// both the provider and we have verified that address; otherwise the user has
+// to sign in with their password and link from settings. If no account uses
+// the email a new, passwordless one is created.
+func (h *AuthHandler) resolveOIDCUser(c *gin.Context, identity *OIDCIdentity) (uuid.UUID, string, bool) {
+	ctx := c.Request.Context()
+	email := pgtype.Text{String: identity.Email, Valid: identity.Email != ""}
+
+	linked, err := h.db.GetUserIdentityByIssuerSubject(ctx, db.GetUserIdentityByIssuerSubjectParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		if err := h.db.TouchUserIdentity(ctx, db.TouchUserIdentityParams{ID: linked.ID, Email: email}); err != nil {
+			log.Printf("Error updating identity %s for user %s: %v", linked.ID, linked.UserID, err)
+		}
+		user, err := h.db.GetUserById(ctx, linked.UserID)
+		if err != nil {
+			log.Printf("Error loading user %s for linked identity: %v", linked.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return uuid.Nil, "", false
+		}
+		return user.ID, user.Username, true
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error looking up linked identity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return uuid.Nil, "", false
+	}
+
+	if identity.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The identity provider did not share an email address"})
+		return uuid.Nil, "", false
+	}
+
+	existing, err := h.db.GetUserByEmailInternal(ctx, identity.Email)
+	if err == nil {
+		verifiedAt, err := h.db.GetUserEmailVerifiedAt(ctx, existing.ID)
+		if err != nil {
+			log.Printf("Error loading email verification for user %s: %v", existing.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return uuid.Nil, "", false
+		}
+		if !identity.EmailVerified || !verifiedAt.Valid {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "An account with this email already exists. Sign in with your password and link single sign-on from settings.",
+				"link_required": true,
+			})
+			return uuid.Nil, "", false
+		}
+
+		if _, err := h.db.InsertUserIdentity(ctx, db.InsertUserIdentityParams{
+			UserID:  existing.ID,
+			Issuer:  identity.Issuer,
+			Subject: identity.Subject,
+			Email:   email,
+		}); err != nil {
+			if isUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "This identity was linked by another request, try again"})
+				return uuid.Nil, "", false
+			}
+			log.Printf("Error linking identity to user %s: %v", existing.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return uuid.Nil, "", false
+		}
+		log.Printf("Linked OIDC identity from %s to existing user %s by verified email", identity.Issuer, existing.ID)
+		return existing.ID, existing.Username, true
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error looking up user by email for OIDC login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return uuid.Nil, "", false
+	}
+
+	return h.createOIDCUser(c, identity)
+}
+
+func (h *AuthHandler) createOIDCUser(c *gin.Context, identity *OIDCIdentity) (uuid.UUID, string, bool) {
+	ctx := c.Request.Context()
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for OIDC signup: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
+		return uuid.Nil, "", false
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	user, err := qtx.InsertUser(ctx, db.InsertUserParams{
+		Username: oidcUsername(identity),
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+			return uuid.Nil, "", false
+		}
+		log.Printf("Error inserting user during OIDC signup: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
+		return uuid.Nil, "", false
+	}
+
+	if _, err := qtx.InsertUserIdentity(ctx, db.InsertUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   pgtype.Text{String: identity.Email, Valid: true},
+	}); err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity was linked by another request, try again"})
+			return uuid.Nil, "", false
+		}
+		log.Printf("Error linking identity for new user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
+		return uuid.Nil, "", false
+	}
+
+	var verification *mailer.Message
+	if identity.EmailVerified {
+		if _, err := qtx.MarkUserEmailVerified(ctx, db.MarkUserEmailVerifiedParams{ID: user.ID, Email: user.Email}); err != nil {
+			log.Printf("Error marking provider-verified email for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
+			return uuid.Nil, "", false
+		}
+	} else {
+		msg, err := h.startEmailVerification(ctx, qtx, user.ID, user.Email)
+		if err != nil {
+			log.Printf("Error starting email verification for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
+			return uuid.Nil, "", false
+		}
+		verification = &msg
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit OIDC signup for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
+		return uuid.Nil, "", false
+	}
+
+	if verification != nil {
+		h.sendAsync(user.ID, *verification)
+	}
+	log.Printf("Created user %s from OIDC issuer %s", user.ID, identity.Issuer)
+	return user.ID, user.Username, true
+}
+
+// oidcUsername picks a display name from the provider's profile claims.
+func oidcUsername(identity *OIDCIdentity) string {
+	username := strings.TrimSpace(identity.PreferredUsername)
+	if username == "" {
+		username = strings.TrimSpace(identity.Name)
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+	return username
+}
+
+func (h *AuthHandler) linkOIDCIdentity(c *gin.Context, userID uuid.UUID, identity *OIDCIdentity) {
+	ctx := c.Request.Context()
+
+	existing, err := h.db.GetUserIdentityByIssuerSubject(ctx, db.GetUserIdentityByIssuerSubjectParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		if existing.UserID != userID {
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to another account"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Identity already linked", "identity": toLinkedIdentity(existing)})
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error looking up linked identity for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	linked, err := h.db.InsertUserIdentity(ctx, db.InsertUserIdentityParams{
+		UserID:  userID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   pgtype.Text{String: identity.Email, Valid: identity.Email != ""},
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to another account"})
+			return
+		}
+		log.Printf("Error linking identity to user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	log.Printf("Linked OIDC identity from %s to user %s", identity.Issuer, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked", "identity": toLinkedIdentity(linked)})
+}
+
+func (h *AuthHandler) GetLinkedIdentities(c *gin.Context) {
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	identities, err := h.db.GetUserIdentitiesForUser(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error loading linked identities for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load linked identities"})
+		return
+	}
+
+	linked := make([]LinkedIdentity, 0, len(identities))
+	for _, identity := range identities {
+		linked = append(linked, toLinkedIdentity(identity))
+	}
+	c.JSON(http.StatusOK, linked)
+}
+
+// UnlinkIdentity removes a linked identity, unless it is the only way left to
+// sign in to the account.
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	identityID, err := uuid.Parse(c.Param("identityID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	if !h.canRemoveSignInMethod(c, claims.UserID) {
+		return
+	}
+
+	deleted, err := h.db.DeleteUserIdentity(ctx, db.DeleteUserIdentityParams{ID: identityID, UserID: claims.UserID})
+	if err != nil {
+		log.Printf("Error unlinking identity %s for user %s: %v", identityID, claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+
+	log.Printf("Unlinked identity %s from user %s", identityID, claims.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
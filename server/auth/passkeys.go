@@ -0,0 +1,482 @@
+package auth
+
+import (
+	"bytes"
+	"chat-app-server/db"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	passkeyChallengeTTL = 5 * time.Minute
+
+	ceremonyRegistration   = "registration"
+	ceremonyAuthentication = "authentication"
+)
+
+func toPasskey(credential db.WebauthnCredential) Passkey {
+	passkey := Passkey{
+		ID:         credential.ID,
+		Transports: credential.Transports,
+		CreatedAt:  credential.CreatedAt.Time,
+	}
+	if passkey.Transports == nil {
+		passkey.Transports = []string{}
+	}
+	if credential.Name.Valid {
+		passkey.Name = &credential.Name.String
+	}
+	if credential.LastUsedAt.Valid {
+		passkey.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return passkey
+}
+
+func credentialDescriptor(credential db.WebauthnCredential) gin.H {
+	descriptor := gin.H{
+		"type": "public-key",
+		"id":   base64.RawURLEncoding.EncodeToString(credential.CredentialID),
+	}
+	if len(credential.Transports) > 0 {
+		descriptor["transports"] = credential.Transports
+	}
+	return descriptor
+}
+
+func (h *AuthHandler) passkeysEnabled(c *gin.Context) bool {
+	if h.webauthn == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkeys are not configured"})
+		return false
+	}
+	return true
+}
+
+// newPasskeyChallenge stores a single-use challenge for one ceremony and
+// returns it base64url encoded.
+func (h *AuthHandler) newPasskeyChallenge(ctx context.Context, ceremony string, userID *uuid.UUID) (string, error) {
+	challenge, challengeHash, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = h.db.InsertWebAuthnChallenge(ctx, db.InsertWebAuthnChallengeParams{
+		ChallengeHash: challengeHash,
+		Ceremony:      ceremony,
+		UserID:        userID,
+		ExpiresAt:     pgtype.Timestamp{Time: time.Now().UTC().Add(passkeyChallengeTTL), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumePasskeyChallenge locks and marks used the challenge the client data
+// was signed over, rejecting it if it belongs to another ceremony or user.
+func consumePasskeyChallenge(ctx context.Context, qtx *db.Queries, challenge string, ceremony string, userID *uuid.UUID) (bool, error) {
+	row, err := qtx.GetWebAuthnChallengeByHashForUpdate(ctx, hashOpaqueToken(challenge))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if row.Ceremony != ceremony || row.UsedAt.Valid || time.Now().UTC().After(row.ExpiresAt.Time) {
+		return false, nil
+	}
+	if userID != nil && (row.UserID == nil || *row.UserID != *userID) {
+		return false, nil
+	}
+	return true, qtx.MarkWebAuthnChallengeUsed(ctx, row.ID)
+}
+
+// BeginPasskeyRegistration returns WebAuthn creation options for adding a
+// passkey to the signed-in account. A passkey signs in without a second
+// factor, so the user confirms their password, and their authenticator code
+// when 2FA is on, first. The challenge is bound to the user, which carries the
+// confirmation over to FinishPasskeyRegistration.
+func (h *AuthHandler) BeginPasskeyRegistration(c *gin.Context) {
+	if !h.passkeysEnabled(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	var req BeginPasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+	if !ConfirmSecondFactor(c, h.db, h.conn, user.ID, req.Code) {
+		return
+	}
+
+	existing, err := h.db.GetWebAuthnCredentialsForUser(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading passkeys for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+	exclude := make([]gin.H, 0, len(existing))
+	for _, credential := range existing {
+		exclude = append(exclude, credentialDescriptor(credential))
+	}
+
+	challenge, err := h.newPasskeyChallenge(ctx, ceremonyRegistration, &user.ID)
+	if err != nil {
+		log.Printf("Error creating passkey registration challenge for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge": challenge,
+		"rp":        gin.H{"id": h.webauthn.RPID, "name": h.webauthn.RPName},
+		"user": gin.H{
+			"id":          base64.RawURLEncoding.EncodeToString(user.ID[:]),
+			"name":        user.Email,
+			"displayName": user.Username,
+		},
+		"pubKeyCredParams": []gin.H{
+			{"type": "public-key", "alg": coseAlgES256},
+			{"type": "public-key", "alg": coseAlgEdDSA},
+			{"type": "public-key", "alg": coseAlgRS256},
+		},
+		"timeout":     passkeyChallengeTTL.Milliseconds(),
+		"attestation": "none",
+		"authenticatorSelection": gin.H{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   "required",
+		},
+		"excludeCredentials": exclude,
+	})
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores
+// the new credential.
+func (h *AuthHandler) FinishPasskeyRegistration(c *gin.Context) {
+	if !h.passkeysEnabled(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	var req FinishPasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	rawID, errRawID := decodeBase64URL(req.Credential.RawID)
+	clientDataJSON, errClientData := decodeBase64URL(req.Credential.Response.ClientDataJSON)
+	attestationObject, errAttestation := decodeBase64URL(req.Credential.Response.AttestationObject)
+	if errRawID != nil || errClientData != nil || errAttestation != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Credential fields must be base64url encoded"})
+		return
+	}
+
+	challenge, err := h.webauthn.parseClientData(clientDataJSON, "webauthn.create")
+	if err != nil {
+		log.Printf("Rejected passkey registration for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey registration"})
+		return
+	}
+
+	authData, err := h.webauthn.parseAttestationObject(attestationObject)
+	if err != nil {
+		log.Printf("Rejected passkey registration for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey registration"})
+		return
+	}
+	if !bytes.Equal(authData.credentialID, rawID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey registration"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	ok, err := consumePasskeyChallenge(ctx, qtx, challenge, ceremonyRegistration, &claims.UserID)
+	if err != nil {
+		log.Printf("Error consuming passkey challenge for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	credential, err := qtx.InsertWebAuthnCredential(ctx, db.InsertWebAuthnCredentialParams{
+		UserID:       claims.UserID,
+		CredentialID: authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    int64(authData.signCount),
+		Transports:   req.Credential.Response.Transports,
+		Name:         pgtype.Text{String: name, Valid: name != ""},
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This passkey is already registered"})
+			return
+		}
+		log.Printf("Error storing passkey for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit passkey registration for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	log.Printf("Passkey %s registered for user %s", credential.ID, claims.UserID)
+	c.JSON(http.StatusCreated, toPasskey(credential))
+}
+
+// BeginPasskeyLogin returns WebAuthn request options. No account is named up
+// front; the authenticator offers its discoverable credentials for our RP ID.
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
+	if !h.passkeysEnabled(c) {
+		return
+	}
+	if h.throttle(c, "login_ip", c.ClientIP(), loginIPLimit) {
+		return
+	}
+
+	challenge, err := h.newPasskeyChallenge(c.Request.Context(), ceremonyAuthentication, nil)
+	if err != nil {
+		log.Printf("Error creating passkey login challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge":        challenge,
+		"rpId":             h.webauthn.RPID,
+		"timeout":          passkeyChallengeTTL.Milliseconds(),
+		"userVerification": "required",
+		"allowCredentials": []gin.H{},
+	})
+}
+
+// FinishPasskeyLogin verifies an assertion and logs the user in. A passkey
+// with user verification already covers two factors, and registering it took
+// the password and any authenticator code, so TOTP isn't asked for.
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	if !h.passkeysEnabled(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if h.throttle(c, "login_ip", c.ClientIP(), loginIPLimit) {
+		return
+	}
+
+	response := req.Credential.Response
+	rawID, errRawID := decodeBase64URL(req.Credential.RawID)
+	clientDataJSON, errClientData := decodeBase64URL(response.ClientDataJSON)
+	authenticatorData, errAuthData := decodeBase64URL(response.AuthenticatorData)
+	signature, errSignature := decodeBase64URL(response.Signature)
+	userHandle, errUserHandle := decodeBase64URL(response.UserHandle)
+	if errRawID != nil || errClientData != nil || errAuthData != nil || errSignature != nil || errUserHandle != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Credential fields must be base64url encoded"})
+		return
+	}
+
+	challenge, err := h.webauthn.parseClientData(clientDataJSON, "webauthn.get")
+	if err != nil {
+		log.Printf("Rejected passkey login: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	authData, err := h.webauthn.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		log.Printf("Rejected passkey login: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for passkey login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	ok, err := consumePasskeyChallenge(ctx, qtx, challenge, ceremonyAuthentication, nil)
+	if err != nil {
+		log.Printf("Error consuming passkey login challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	credential, err := qtx.GetWebAuthnCredentialByCredentialIDForUpdate(ctx, rawID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey not recognized"})
+		} else {
+			log.Printf("Error loading passkey: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, credential.UserID[:]) {
+		log.Printf("Rejected passkey login for user %s: user handle mismatch", credential.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	if err := verifyAssertionSignature(credential.PublicKey, authenticatorData, clientDataJSON, signature); err != nil {
+		log.Printf("Rejected passkey login for user %s: %v", credential.UserID, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	// Authenticators that keep a counter must increase it on every use;
+	// anything else means the credential may have been cloned.
+	signCount := int64(authData.signCount)
+	if (signCount != 0 || credential.SignCount != 0) && signCount <= credential.SignCount {
+		log.Printf("Rejected passkey %s for user %s: signature counter went from %d to %d", credential.ID, credential.UserID, credential.SignCount, signCount)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	if err := qtx.UpdateWebAuthnCredentialUsage(ctx, db.UpdateWebAuthnCredentialUsageParams{
+		ID:        credential.ID,
+		SignCount: signCount,
+	}); err != nil {
+		log.Printf("Error recording passkey use for user %s: %v", credential.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit passkey login for user %s: %v", credential.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	user, err := h.db.GetUserById(ctx, credential.UserID)
+	if err != nil {
+		log.Printf("Error loading user %s after passkey login: %v", credential.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	log.Printf("User %s logged in with passkey %s", user.ID, credential.ID)
+	h.completeLogin(c, user.ID, user.Username, req.DeviceKeyUpload, false)
+}
+
+func (h *AuthHandler) GetPasskeys(c *gin.Context) {
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	credentials, err := h.db.GetWebAuthnCredentialsForUser(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error loading passkeys for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+
+	passkeys := make([]Passkey, 0, len(credentials))
+	for _, credential := range credentials {
+		passkeys = append(passkeys, toPasskey(credential))
+	}
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// DeletePasskey removes a passkey, unless it is the only way left to sign in
+// to the account.
+func (h *AuthHandler) DeletePasskey(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	passkeyID, err := uuid.Parse(c.Param("passkeyID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if !h.canRemoveSignInMethod(c, claims.UserID) {
+		return
+	}
+
+	deleted, err := h.db.DeleteWebAuthnCredential(ctx, db.DeleteWebAuthnCredentialParams{ID: passkeyID, UserID: claims.UserID})
+	if err != nil {
+		log.Printf("Error deleting passkey %s for user %s: %v", passkeyID, claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	log.Printf("Passkey %s deleted for user %s", passkeyID, claims.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// canRemoveSignInMethod responds with 409 when the account has only one way
+// to sign in left (password, linked identity or passkey).
+func (h *AuthHandler) canRemoveSignInMethod(c *gin.Context, userID uuid.UUID) bool {
+	methods, err := h.db.CountSignInMethods(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error counting sign-in methods for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check sign-in methods"})
+		return false
+	}
+	if methods <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This is the only way to sign in to your account and can't be removed"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/mailer"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetTTL = time.Hour
+
+// RequestPasswordReset emails a single-use reset token. It responds the same
+// way whether or not the email belongs to an account. Requests are limited
+// per IP and per address, whether or not it has an account, so the endpoint
+// can't be used to flood someone's inbox.
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if h.throttle(c, "password_reset_ip", c.ClientIP(), passwordResetIPLimit) ||
+		h.throttle(c, "password_reset_email", strings.ToLower(strings.TrimSpace(req.Email)), passwordResetEmailLimit) {
+		return
+	}
+
+	response := gin.H{"message": "If an account exists for that email, a reset link has been sent."}
+
+	user, err := h.db.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating password reset token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for password reset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	if err := qtx.InvalidatePasswordResetTokensForUser(ctx, user.ID); err != nil {
+		log.Printf("Error invalidating previous reset tokens for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+
+	_, err = qtx.InsertPasswordResetToken(ctx, db.InsertPasswordResetTokenParams{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(passwordResetTTL), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error storing password reset token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit password reset token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+
+	// Send in the background so a slow mail server doesn't hold up the
+	// response.
+	h.sendAsync(user.ID, passwordResetEmail(user.Email, token))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmPasswordReset consumes a reset token, sets the new password and
+// revokes every existing session for the account.
+func (h *AuthHandler) ConfirmPasswordReset(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for password reset confirmation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	resetToken, err := qtx.GetPasswordResetTokenByHashForUpdate(ctx, hashOpaqueToken(req.Token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		} else {
+			log.Printf("Error loading password reset token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		}
+		return
+	}
+
+	if resetToken.UsedAt.Valid || time.Now().UTC().After(resetToken.ExpiresAt.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	if err := qtx.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		ID:       resetToken.UserID,
+		Password: pgtype.Text{String: string(hash), Valid: true},
+	}); err != nil {
+		log.Printf("Error updating password for user %s: %v", resetToken.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := qtx.MarkPasswordResetTokenUsed(ctx, resetToken.ID); err != nil {
+		log.Printf("Error consuming password reset token for user %s: %v", resetToken.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	revokedFamilies, err := qtx.RevokeAllSessionsForUser(ctx, resetToken.UserID)
+	if err != nil {
+		log.Printf("Error revoking sessions after password reset for user %s: %v", resetToken.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := qtx.RevokePersonalAccessTokensForUser(ctx, resetToken.UserID); err != nil {
+		log.Printf("Error revoking personal access tokens after password reset for user %s: %v", resetToken.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit password reset for user %s: %v", resetToken.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := h.revocations.RevokeSessions(ctx, resetToken.UserID, revokedFamilies); err != nil {
+		log.Printf("Warning: password reset for user %s succeeded but access tokens could not be revoked: %v", resetToken.UserID, err)
+	}
+
+	log.Printf("Password reset completed for user %s", resetToken.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+func passwordResetEmail(to string, token string) mailer.Message {
+	body := fmt.Sprintf(
+		"Someone asked to reset the password for your account.\n\n"+
+			"Your reset code is:\n\n%s\n\n"+
+			"It expires in %d minutes and can only be used once. If you didn't ask for this, you can ignore this email.\n",
+		token, int(passwordResetTTL.Minutes()),
+	)
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" {
+		body += fmt.Sprintf("\nOr open: %s?token=%s\n", resetURL, token)
+	}
+	return mailer.Message{To: to, Subject: "Reset your password", Body: body}
+}
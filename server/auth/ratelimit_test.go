@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// testLimiter returns a limiter on the Redis at REDIS_URL and a key unique to
+// the test, skipping the test when no Redis is configured.
+func testLimiter(t *testing.T) (*RateLimiter, string) {
+	t.Helper()
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL not set")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		t.Fatalf("parsing REDIS_URL: %v", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis unavailable: %v", err)
+	}
+
+	limiter := NewRateLimiter(client)
+	key := "test:" + uuid.NewString()
+	t.Cleanup(func() {
+		ctx := context.Background()
+		client.Del(ctx, redisRateLimitPrefix+key)
+		limiter.Reset(ctx, key)
+		client.Close()
+	})
+	return limiter, key
+}
+
+func TestAllowSlidingWindow(t *testing.T) {
+	limiter, key := testLimiter(t)
+	ctx := context.Background()
+	limit := RateLimit{Limit: 3, Window: 500 * time.Millisecond}
+
+	for i := 0; i < limit.Limit; i++ {
+		retry, err := limiter.Allow(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if retry != 0 {
+			t.Fatalf("event %d was limited for %s", i+1, retry)
+		}
+	}
+
+	retry, err := limiter.Allow(ctx, key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry <= 0 || retry > limit.Window {
+		t.Fatalf("event over the limit: retry after %s, want within (0, %s]", retry, limit.Window)
+	}
+
+	// Rejected events don't count, so the window frees up once the first
+	// accepted events expire.
+	time.Sleep(retry + 50*time.Millisecond)
+	if retry, err := limiter.Allow(ctx, key, limit); err != nil || retry != 0 {
+		t.Fatalf("event after the window = %s, %v; want allowed", retry, err)
+	}
+}
+
+func TestRecordFailureLockoutDoubles(t *testing.T) {
+	limiter, key := testLimiter(t)
+	ctx := context.Background()
+	limit := RateLimit{Limit: 2, Window: time.Minute}
+
+	for _, want := range []time.Duration{baseLockout, 2 * baseLockout, 4 * baseLockout} {
+		for i := 0; i < limit.Limit; i++ {
+			lockout, err := limiter.RecordFailure(ctx, key, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lockout != 0 {
+				t.Fatalf("failure %d within the limit locked out for %s", i+1, lockout)
+			}
+		}
+		lockout, err := limiter.RecordFailure(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lockout != want {
+			t.Fatalf("lockout = %s, want %s", lockout, want)
+		}
+		remaining, err := limiter.LockoutRemaining(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining <= 0 || remaining > want {
+			t.Fatalf("LockoutRemaining = %s, want within (0, %s]", remaining, want)
+		}
+	}
+
+	if err := limiter.Reset(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if remaining, err := limiter.LockoutRemaining(ctx, key); err != nil || remaining != 0 {
+		t.Fatalf("LockoutRemaining after Reset = %s, %v; want 0", remaining, err)
+	}
+	for i := 0; i < limit.Limit; i++ {
+		limiter.RecordFailure(ctx, key, limit)
+	}
+	if lockout, err := limiter.RecordFailure(ctx, key, limit); err != nil || lockout != baseLockout {
+		t.Fatalf("lockout after Reset = %s, %v; want %s", lockout, err, baseLockout)
+	}
+}
+
+func TestRespondTooManyRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Hour, "3600"},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		respondTooManyRequests(c, tt.retryAfter)
+
+		if recorder.Code != http.StatusTooManyRequests {
+			t.Errorf("status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+		}
+		if got := recorder.Header().Get("Retry-After"); got != tt.want {
+			t.Errorf("Retry-After for %s = %q, want %q", tt.retryAfter, got, tt.want)
+		}
+		var body struct {
+			RetryAfter json.Number `json:"retry_after"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if string(body.RetryAfter) != tt.want {
+			t.Errorf("retry_after for %s = %s, want %s", tt.retryAfter, body.RetryAfter, tt.want)
+		}
+	}
+}
+
+func TestAccountLimitKey(t *testing.T) {
+	if got, want := accountLimitKey("  Alice@Example.COM "), "account:alice@example.com"; got != want {
+		t.Errorf("accountLimitKey = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisRevokedTokenPrefix   = "revoked_token:"
+	redisRevokedSessionPrefix = "revoked_session:"
+	redisRevokedUserPrefix    = "revoked_user:"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// DisconnectFunc closes any live connection a user authenticated with the
+// given token or session; when both are empty every connection of the user is
+// closed. It is provided by the websocket hub.
+type DisconnectFunc func(ctx context.Context, userID uuid.UUID, tokenID string, sessionID string) error
+
+// RevocationStore is a Redis denylist of access tokens (by jti), session
+// families (by sid) and whole users (by issue time) that must be rejected
+// before they naturally expire.
+type RevocationStore struct {
+	redisClient *redis.Client
+	disconnect  DisconnectFunc
+}
+
+func NewRevocationStore(redisClient *redis.Client) *RevocationStore {
+	return &RevocationStore{redisClient: redisClient}
+}
+
+func (s *RevocationStore) SetDisconnectFunc(fn DisconnectFunc) {
+	s.disconnect = fn
+}
+
+// RevokeToken denylists the token and its session family for as long as any
+// access token from them could still be valid, then disconnects live sockets.
+func (s *RevocationStore) RevokeToken(ctx context.Context, claims *Claims) error {
+	pipe := s.redisClient.Pipeline()
+	if claims.ID != "" {
+		ttl := accessTokenTTL
+		if claims.ExpiresAt != nil {
+			ttl = time.Until(claims.ExpiresAt.Time)
+		}
+		if ttl > 0 {
+			pipe.Set(ctx, redisRevokedTokenPrefix+claims.ID, 1, ttl)
+		}
+	}
+	if claims.SessionID != "" {
+		pipe.Set(ctx, redisRevokedSessionPrefix+claims.SessionID, 1, accessTokenTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if s.disconnect != nil {
+		if err := s.disconnect(ctx, claims.UserID, claims.ID, claims.SessionID); err != nil {
+			log.Printf("Error disconnecting live client for user %s after token revocation: %v", claims.UserID, err)
+		}
+	}
+	return nil
+}
+
+// RevokeUser rejects every access token issued to the user up to now and
+// disconnects their live sockets. The cutoff only has the one-second
+// precision of iat, so it's meant for accounts that get no new tokens, i.e.
+// deleted ones; revoke a live account's session families with RevokeSessions
+// instead.
+func (s *RevocationStore) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	cutoff := time.Now().Unix()
+	if err := s.redisClient.Set(ctx, redisRevokedUserPrefix+userID.String(), cutoff, accessTokenTTL).Err(); err != nil {
+		return err
+	}
+
+	if s.disconnect != nil {
+		if err := s.disconnect(ctx, userID, "", ""); err != nil {
+			log.Printf("Error disconnecting live client for user %s after revoking all tokens: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// RevokeSessions denylists the given session families, e.g. after a device is
+// removed, and disconnects sockets opened with them.
+func (s *RevocationStore) RevokeSessions(ctx context.Context, userID uuid.UUID, familyIDs []uuid.UUID) error {
+	if len(familyIDs) == 0 {
+		return nil
+	}
+
+	pipe := s.redisClient.Pipeline()
+	for _, familyID := range familyIDs {
+		pipe.Set(ctx, redisRevokedSessionPrefix+familyID.String(), 1, accessTokenTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if s.disconnect != nil {
+		for _, familyID := range familyIDs {
+			if err := s.disconnect(ctx, userID, "", familyID.String()); err != nil {
+				log.Printf("Error disconnecting live client for user %s after session revocation: %v", userID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	keys := make([]string, 0, 2)
+	if claims.ID != "" {
+		keys = append(keys, redisRevokedTokenPrefix+claims.ID)
+	}
+	if claims.SessionID != "" {
+		keys = append(keys, redisRevokedSessionPrefix+claims.SessionID)
+	}
+
+	pipe := s.redisClient.Pipeline()
+	var existsCmd *redis.IntCmd
+	if len(keys) > 0 {
+		existsCmd = pipe.Exists(ctx, keys...)
+	}
+	cutoffCmd := pipe.Get(ctx, redisRevokedUserPrefix+claims.UserID.String())
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return false, err
+	}
+
+	if existsCmd != nil && existsCmd.Val() > 0 {
+		return true, nil
+	}
+
+	cutoffStr, err := cutoffCmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cutoff, err := strconv.ParseInt(cutoffStr, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+	return claims.IssuedAt.Time.Unix() <= cutoff, nil
+}
@@ -1,76 +1,105 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// GenerateAccessToken signs a short-lived token for the given session family.
+// The jti lets a single token be revoked before it expires.
+func GenerateAccessToken(userID uuid.UUID, sessionID uuid.UUID) (string, error) {
+	if keys == nil {
+		return "", fmt.Errorf("JWT keys not configured on server")
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	return keys.sign(claims)
+}
 
+// generateOpaqueToken returns a random token for the client and the hash that
+// is stored server side (refresh tokens, password reset tokens).
+func generateOpaqueToken() (string, []byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashOpaqueToken(token), nil
+}
+
+func hashOpaqueToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// ValidateToken verifies the token against the key named by its kid header and
+// returns the user it was issued to.
 func ValidateToken(tokenString string) (uuid.UUID, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+func ParseToken(tokenString string) (*Claims, error) {
 	if tokenString == "" {
-		return uuid.Nil, fmt.Errorf("authorization token required")
+		return nil, fmt.Errorf("authorization token required")
 	}
-	if len(jwtSecret) == 0 {
-		log.Println("Warning: JWT_SECRET environment variable not set.")
-		return uuid.Nil, fmt.Errorf("JWT secret not configured on server")
+	if keys == nil {
+		log.Println("Warning: JWT keys have not been initialized.")
+		return nil, fmt.Errorf("JWT keys not configured on server")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc)
 
 	if err != nil {
 		log.Printf("Token parsing error: %v", err)
 		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return uuid.Nil, fmt.Errorf("malformed token")
+			return nil, fmt.Errorf("malformed token")
 		} else if errors.Is(err, jwt.ErrTokenExpired) {
-			return uuid.Nil, fmt.Errorf("token is expired")
+			return nil, fmt.Errorf("token is expired")
 		} else if errors.Is(err, jwt.ErrTokenNotValidYet) {
-			return uuid.Nil, fmt.Errorf("token not yet valid")
+			return nil, fmt.Errorf("token not yet valid")
 		} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
-			return uuid.Nil, fmt.Errorf("token signature is invalid")
+			return nil, fmt.Errorf("token signature is invalid")
 		} else {
-			return uuid.Nil, fmt.Errorf("couldn't handle token: %w", err)
+			return nil, fmt.Errorf("couldn't handle token: %w", err)
 		}
 	}
 	if !token.Valid {
 		log.Printf("Token marked as invalid, though no specific error matched: %v", err)
-		return uuid.Nil, fmt.Errorf("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return uuid.Nil, fmt.Errorf("invalid token claims format")
-	}
-
-	userIDClaim, exists := claims["userID"]
-	if !exists {
-		return uuid.Nil, fmt.Errorf("userID claim missing in token")
-	}
-
-	userIDStr, ok := userIDClaim.(string)
-	if !ok {
-		return uuid.Nil, fmt.Errorf("userID claim is not a string")
-	}
-
-	userID, err := uuid.Parse(userIDStr)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to parse userID as UUID: %w", err)
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	if userID == uuid.Nil {
-		return uuid.Nil, fmt.Errorf("parsed userID is a Nil UUID")
+	if claims.UserID == uuid.Nil {
+		return nil, fmt.Errorf("userID claim missing in token")
 	}
 
-	log.Printf("Token validated successfully for userID: %s", userID)
-	return userID, nil
+	log.Printf("Token validated successfully for userID: %s", claims.UserID)
+	return claims, nil
 }
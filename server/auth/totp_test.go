@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed used by the RFC 4226 and RFC 6238 test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC4226(t *testing.T) {
+	// RFC 4226 Appendix D: HOTP values for counters 0-9.
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := totpCode(rfcSecret, int64(counter)); got != code {
+			t.Errorf("totpCode(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 Appendix B (SHA-1). The RFC lists 8-digit codes; a 6-digit code
+	// is the same value mod 10^6, i.e. its last six digits.
+	tests := []struct {
+		unix int64
+		rfc  string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0).UTC()
+		want := tt.rfc[len(tt.rfc)-totpDigits:]
+		if got := totpCode(rfcSecret, totpStep(now)); got != want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfcSecret)
+	now := time.Unix(1111111111, 0).UTC()
+	current := totpStep(now)
+	codeAt := func(step int64) string { return totpCode(rfcSecret, step) }
+
+	tests := []struct {
+		name         string
+		code         string
+		lastUsedStep int64
+		wantStep     int64
+		wantOK       bool
+	}{
+		{"current step", codeAt(current), 0, current, true},
+		{"previous step within skew", codeAt(current - 1), 0, current - 1, true},
+		{"next step within skew", codeAt(current + 1), 0, current + 1, true},
+		{"two steps old", codeAt(current - 2), 0, 0, false},
+		{"two steps ahead", codeAt(current + 2), 0, 0, false},
+		{"surrounding whitespace", " " + codeAt(current) + "\n", 0, current, true},
+		{"replayed step", codeAt(current), current, 0, false},
+		{"step before the last used one", codeAt(current - 1), current - 1, 0, false},
+		{"later step after a used one", codeAt(current), current - 1, current, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"too short", codeAt(current)[:5], 0, 0, false},
+		{"too long", codeAt(current) + "0", 0, 0, false},
+		{"empty", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := verifyTOTP(secret, tt.code, tt.lastUsedStep, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("verifyTOTP(%q, last used %d) = %d, %v; want %d, %v", tt.code, tt.lastUsedStep, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPRejectsInvalidSecret(t *testing.T) {
+	if _, ok := verifyTOTP("not base32!", "123456", 0, time.Now()); ok {
+		t.Error("verifyTOTP accepted a code for an undecodable secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not unpadded base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret has %d bytes, want 20", len(key))
+	}
+
+	now := time.Now()
+	if _, ok := verifyTOTP(secret, totpCode(key, totpStep(now)), 0, now); !ok {
+		t.Error("verifyTOTP rejected the current code for a generated secret")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(totpURI("alice@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("URI = %s, want otpauth://totp/...", uri)
+	}
+	if got, want := strings.TrimPrefix(uri.Path, "/"), totpIssuer+":alice@example.com"; got != want {
+		t.Errorf("label = %q, want %q", got, want)
+	}
+	if got := uri.Query().Get("secret"); got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("secret = %q", got)
+	}
+	if got := uri.Query().Get("issuer"); got != totpIssuer {
+		t.Errorf("issuer = %q, want %q", got, totpIssuer)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodes || len(hashes) != recoveryCodes {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodes)
+	}
+
+	seen := make(map[string]bool, len(codes))
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate recovery code %s", code)
+		}
+		seen[code] = true
+
+		// Users may type codes in lower case, without dashes or with spaces.
+		for _, typed := range []string{code, strings.ToLower(code), strings.ReplaceAll(code, "-", ""), strings.ReplaceAll(code, "-", " ")} {
+			if string(hashRecoveryCode(typed)) != string(hashes[i]) {
+				t.Errorf("hashRecoveryCode(%q) doesn't match the stored hash of %s", typed, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package auth
+
+import (
+	"chat-app-server/db"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	maxMFAChallengeAttempts = 5
+
+	// recentLoginWindow is how long after logging in an account without a
+	// password can make the changes that would otherwise ask for one.
+	recentLoginWindow = 10 * time.Minute
+)
+
+// currentUserWithPassword loads the authenticated user and confirms it's
+// them with ConfirmPassword, writing the error response when either fails.
+func (h *AuthHandler) currentUserWithPassword(c *gin.Context, password string) (db.GetUserByIdInternalRow, bool) {
+	claims, err := GetClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return db.GetUserByIdInternalRow{}, false
+	}
+
+	user, err := h.db.GetUserByIdInternal(c.Request.Context(), claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return db.GetUserByIdInternalRow{}, false
+	}
+
+	if !ConfirmPassword(c, h.db, user, password) {
+		return db.GetUserByIdInternalRow{}, false
+	}
+	return user, true
+}
+
+// ConfirmPassword checks the password the caller supplied. Accounts without
+// one, i.e. those that only sign in through an identity provider or passkey,
+// instead need a session that was logged into within recentLoginWindow. It
+// writes the error response and returns false when the check fails.
+func ConfirmPassword(c *gin.Context, queries *db.Queries, user db.GetUserByIdInternalRow, password string) bool {
+	if user.Password.Valid {
+		if !passwordMatches(user, password) {
+			log.Printf("Password confirmation failed for user %s", user.ID)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+			return false
+		}
+		return true
+	}
+
+	if !recentlyLoggedIn(c, queries) {
+		log.Printf("Confirmation for passwordless user %s rejected: login is not recent", user.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign in again to confirm this change", "reauth_required": true})
+		return false
+	}
+	return true
+}
+
+// recentlyLoggedIn reports whether the request's session family was started by
+// a login within recentLoginWindow. Personal access tokens have no session and
+// never count.
+func recentlyLoggedIn(c *gin.Context, queries *db.Queries) bool {
+	claims, err := GetClaims(c)
+	if err != nil {
+		return false
+	}
+	familyID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return false
+	}
+	startedAt, err := queries.GetSessionFamilyStartedAt(c.Request.Context(), familyID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error loading session family %s: %v", familyID, err)
+		}
+		return false
+	}
+	return time.Since(startedAt.Time) < recentLoginWindow
+}
+
+// passwordMatches reports whether password is the user's password. Accounts
+// without one never match.
+func passwordMatches(user db.GetUserByIdInternalRow, password string) bool {
+	return user.Password.Valid && bcrypt.CompareHashAndPassword([]byte(user.Password.String), []byte(password)) == nil
+}
+
+// ConfirmSecondFactor checks the current authenticator code when the user has
+// two-factor authentication on, recording its step so it can't be replayed. It
+// writes the error response and returns false when the check fails.
+func ConfirmSecondFactor(c *gin.Context, queries *db.Queries, conn *pgxpool.Pool, userID uuid.UUID, code string) bool {
+	ctx := c.Request.Context()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for confirming 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+		return false
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := queries.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTPForUpdate(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true
+	}
+	if err != nil {
+		log.Printf("Error loading TOTP secret for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+		return false
+	}
+	if !totp.EnabledAt.Valid {
+		return true
+	}
+
+	step, ok := verifyTOTP(totp.Secret, code, totp.LastUsedStep, time.Now().UTC())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid authentication code"})
+		return false
+	}
+
+	if err := qtx.UpdateTOTPLastUsedStep(ctx, db.UpdateTOTPLastUsedStepParams{UserID: userID, LastUsedStep: step}); err != nil {
+		log.Printf("Error recording TOTP step for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+		return false
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit TOTP step for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+		return false
+	}
+	return true
+}
+
+// replaceRecoveryCodes discards the user's existing recovery codes and returns
+// a fresh set to show once.
+func replaceRecoveryCodes(ctx context.Context, queries *db.Queries, userID uuid.UUID) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := queries.DeleteRecoveryCodesForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		if err := queries.InsertRecoveryCode(ctx, db.InsertRecoveryCodeParams{UserID: userID, CodeHash: hash}); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// startMFAChallenge records a login that passed the password check and returns
+// the short-lived mfa pending token the client trades in with a second factor.
+// The device key, and any identity key reset, is held back until then.
+func (h *AuthHandler) startMFAChallenge(
+	ctx context.Context,
+	userID uuid.UUID,
+	device DeviceKeyUpload,
+	resetIdentityKey bool,
+) (string, error) {
+	token, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = h.db.InsertMFAChallenge(ctx, db.InsertMFAChallengeParams{
+		UserID:             userID,
+		TokenHash:          tokenHash,
+		DeviceIdentifier:   device.DeviceIdentifier,
+		PublicKey:          device.PublicKey,
+		DeviceKeySignature: device.DeviceKeySignature,
+		IdentityKey:        pgtype.Text{String: device.IdentityKey, Valid: device.IdentityKey != ""},
+		ExpiresAt:          pgtype.Timestamp{Time: time.Now().UTC().Add(mfaChallengeTTL), Valid: true},
+		ResetIdentityKey:   resetIdentityKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SetupTwoFactor generates a new TOTP secret for the user to add to their
+// authenticator app. It is not enforced until confirmed with EnableTwoFactor.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req PasswordConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		return
+	}
+
+	_, err = h.db.UpsertPendingTOTP(ctx, db.UpsertPendingTOTPParams{UserID: user.ID, Secret: secret})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		} else {
+			log.Printf("Error storing pending TOTP secret for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_url": totpURI(user.Email, secret)})
+}
+
+// EnableTwoFactor turns on the pending secret once the user proves their app
+// produces valid codes, and returns one-time recovery codes.
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req EnableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for enabling 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTPForUpdate(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+		} else {
+			log.Printf("Error loading TOTP secret for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		}
+		return
+	}
+
+	if totp.EnabledAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := verifyTOTP(totp.Secret, req.Code, totp.LastUsedStep, time.Now().UTC())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	if err := qtx.EnableUserTOTP(ctx, db.EnableUserTOTPParams{UserID: user.ID, LastUsedStep: step}); err != nil {
+		log.Printf("Error enabling TOTP for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, qtx, user.ID)
+	if err != nil {
+		log.Printf("Error creating recovery codes for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit enabling 2FA for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %s", user.ID)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req PasswordConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for disabling 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	if err := qtx.DeleteUserTOTP(ctx, user.ID); err != nil {
+		log.Printf("Error deleting TOTP secret for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodesForUser(ctx, user.ID); err != nil {
+		log.Printf("Error deleting recovery codes for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit disabling 2FA for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user %s", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req PasswordConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, ok := h.currentUserWithPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	totp, err := h.db.GetUserTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error loading TOTP secret for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+	if err != nil || !totp.EnabledAt.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err := replaceRecoveryCodes(ctx, h.db.WithTx(tx), user.ID)
+	if err != nil {
+		log.Printf("Error regenerating recovery codes for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit recovery codes for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyMFALogin is the second login step: it trades an mfa pending token and
+// a TOTP or recovery code for the real access and refresh tokens. Requests
+// share the login IP limit, and wrong codes count toward the same account
+// lockout as wrong passwords.
+func (h *AuthHandler) VerifyMFALogin(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: provide either code or recovery_code"})
+		return
+	}
+
+	if h.throttle(c, "login_ip", c.ClientIP(), loginIPLimit) {
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for mfa login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	challenge, err := qtx.GetMFAChallengeByHashForUpdate(ctx, hashOpaqueToken(req.MFAToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		} else {
+			log.Printf("Error loading mfa challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	if challenge.UsedAt.Valid ||
+		challenge.FailedAttempts >= maxMFAChallengeAttempts ||
+		time.Now().UTC().After(challenge.ExpiresAt.Time) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := qtx.GetUserById(ctx, challenge.UserID)
+	if err != nil {
+		log.Printf("Error loading user %s for mfa login: %v", challenge.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if h.accountLockedOut(c, user.Email) {
+		return
+	}
+
+	totp, err := qtx.GetUserTOTPForUpdate(ctx, challenge.UserID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error loading TOTP secret for user %s: %v", challenge.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if err != nil || !totp.EnabledAt.Valid {
+		// 2FA was turned off after the password step; make the client start over.
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	verified := false
+	if req.Code != "" {
+		step, ok := verifyTOTP(totp.Secret, req.Code, totp.LastUsedStep, time.Now().UTC())
+		if ok {
+			if err := qtx.UpdateTOTPLastUsedStep(ctx, db.UpdateTOTPLastUsedStepParams{UserID: totp.UserID, LastUsedStep: step}); err != nil {
+				log.Printf("Error recording TOTP step for user %s: %v", totp.UserID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+				return
+			}
+			verified = true
+		}
+	} else {
+		used, err := qtx.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{UserID: totp.UserID, CodeHash: hashRecoveryCode(req.RecoveryCode)})
+		if err != nil {
+			log.Printf("Error consuming recovery code for user %s: %v", totp.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return
+		}
+		if used > 0 {
+			log.Printf("Recovery code used to log in user %s", totp.UserID)
+			verified = true
+		}
+	}
+
+	if !verified {
+		if err := qtx.IncrementMFAChallengeFailures(ctx, challenge.ID); err != nil {
+			log.Printf("Error recording failed mfa attempt for user %s: %v", challenge.UserID, err)
+		} else if err := tx.Commit(ctx); err != nil {
+			log.Printf("Failed to commit failed mfa attempt for user %s: %v", challenge.UserID, err)
+		}
+		log.Printf("Second factor rejected for user %s", challenge.UserID)
+		h.recordLoginFailure(c, user.Email)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	if err := qtx.MarkMFAChallengeUsed(ctx, challenge.ID); err != nil {
+		log.Printf("Error consuming mfa challenge for user %s: %v", challenge.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit mfa login for user %s: %v", challenge.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if h.completeLogin(c, user.ID, user.Username, DeviceKeyUpload{
+		DeviceIdentifier:   challenge.DeviceIdentifier,
+		PublicKey:          challenge.PublicKey,
+		DeviceKeySignature: challenge.DeviceKeySignature,
+		IdentityKey:        challenge.IdentityKey.String,
+	}, challenge.ResetIdentityKey) {
+		h.clearLoginFailures(c, user.ID, user.Email)
+	}
+}
@@ -1,25 +1,180 @@
 package auth
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 type Claims struct {
-	UserID uuid.UUID `json:"userID"`
+	UserID    uuid.UUID `json:"userID"`
+	SessionID string    `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// DeviceKeyUpload is the device key a client registers when it signs in,
+// signed by the user's identity key (see DeviceKeySignedMessage). IdentityKey
+// is only needed until the account has one; signup always sets it.
+type DeviceKeyUpload struct {
+	DeviceIdentifier   string `json:"device_identifier" binding:"required"`
+	PublicKey          string `json:"public_key" binding:"required"`
+	DeviceKeySignature string `json:"device_key_signature" binding:"required"`
+	IdentityKey        string `json:"identity_key"`
+}
+
 type SignupRequest struct {
-	Username         string `json:"username" binding:"required"`
-	Email            string `json:"email" binding:"required,email"`
-	Password         string `json:"password" binding:"required,min=8"`
-	DeviceIdentifier string `json:"device_identifier" binding:"required"`
-	PublicKey        string `json:"public_key" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+	DeviceKeyUpload
 }
 type LoginRequest struct {
-	Email            string `json:"email" binding:"required,email"`
-	Password         string `json:"password" binding:"required"`
-	DeviceIdentifier string `json:"device_identifier" binding:"required"`
-	PublicKey        string `json:"public_key" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	DeviceKeyUpload
+	// ResetIdentityKey replaces the account's identity key with IdentityKey,
+	// removing every other device, when they don't match. It takes effect
+	// only after the second factor.
+	ResetIdentityKey bool `json:"reset_identity_key"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PasswordConfirmationRequest confirms a sensitive change. Password is left
+// out by accounts that don't have one; see ConfirmPassword.
+type PasswordConfirmationRequest struct {
+	Password string `json:"password"`
+}
+
+type BeginPasskeyRegistrationRequest struct {
+	Password string `json:"password"`
+	// Code is the current authenticator code, required when 2FA is on.
+	Code string `json:"code"`
+}
+
+type EnableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFALoginRequest completes a login that returned mfa_required. Exactly one of
+// Code (from the authenticator app) or RecoveryCode must be set.
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// ChangePasswordRequest leaves out CurrentPassword when the account has no
+// password yet.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+type ChangeEmailRequest struct {
+	Password string `json:"password"`
+	NewEmail string `json:"new_email" binding:"required,email"`
+}
+
+type RevertEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type OIDCStartRequest struct {
+	DeviceKeyUpload
+}
+
+// OIDCCallbackRequest carries the code and state the provider redirected the
+// app back with.
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+type LinkedIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	Issuer      string     `json:"issuer"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// PasskeyAttestationResponse and PasskeyAssertionResponse follow the
+// WebAuthn JSON serialization (base64url binary fields, camelCase names) so
+// clients can forward what the platform passkey API returns unchanged.
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports"`
+}
+
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+type PasskeyRegistrationCredential struct {
+	RawID    string                     `json:"rawId" binding:"required"`
+	Type     string                     `json:"type" binding:"required,eq=public-key"`
+	Response PasskeyAttestationResponse `json:"response" binding:"required"`
+}
+
+type PasskeyAssertionCredential struct {
+	RawID    string                   `json:"rawId" binding:"required"`
+	Type     string                   `json:"type" binding:"required,eq=public-key"`
+	Response PasskeyAssertionResponse `json:"response" binding:"required"`
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	Name       string                        `json:"name" binding:"max=100"`
+	Credential PasskeyRegistrationCredential `json:"credential" binding:"required"`
+}
+
+type PasskeyLoginRequest struct {
+	DeviceKeyUpload
+	Credential PasskeyAssertionCredential `json:"credential" binding:"required"`
+}
+
+type Passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       *string    `json:"name"`
+	Transports []string   `json:"transports"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// PersonalAccessToken describes a token without its secret.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
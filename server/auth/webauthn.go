@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Authenticator data flags (WebAuthn §6.1).
+const (
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40
+)
+
+// COSE algorithm identifiers we accept for passkeys.
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// WebAuthnConfig identifies this server as a WebAuthn relying party.
+type WebAuthnConfig struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+// NewWebAuthnConfigFromEnv reads WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME and the
+// comma-separated WEBAUTHN_ORIGINS (defaulting to https://<rp id>). Native
+// apps add their platform origins here, e.g. android:apk-key-hash:<hash>. It
+// returns nil when WEBAUTHN_RP_ID is not set, which disables passkeys.
+func NewWebAuthnConfigFromEnv() *WebAuthnConfig {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		return nil
+	}
+
+	rpName := os.Getenv("WEBAUTHN_RP_NAME")
+	if rpName == "" {
+		rpName = "chat-app"
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		origins = []string{"https://" + rpID}
+	}
+	return &WebAuthnConfig{RPID: rpID, RPName: rpName, Origins: origins}
+}
+
+// decodeBase64URL accepts base64url with or without padding, which is how
+// browsers and native passkey APIs serialize binary fields.
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// parseClientData checks the ceremony type and origin and returns the
+// challenge the authenticator signed over.
+func (cfg *WebAuthnConfig) parseClientData(clientDataJSON []byte, ceremonyType string) (string, error) {
+	var clientData collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return "", fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+	if clientData.Type != ceremonyType {
+		return "", fmt.Errorf("unexpected client data type %q", clientData.Type)
+	}
+	if !slices.Contains(cfg.Origins, clientData.Origin) {
+		return "", fmt.Errorf("origin %q is not allowed", clientData.Origin)
+	}
+	if clientData.Challenge == "" {
+		return "", errors.New("client data has no challenge")
+	}
+	return strings.TrimRight(clientData.Challenge, "="), nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData checks the RP ID hash and that the user was present
+// and verified, and extracts the attested credential when there is one.
+func (cfg *WebAuthnConfig) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(cfg.RPID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, errors.New("authenticator data is for a different relying party")
+	}
+
+	parsed := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if parsed.flags&authDataUserPresent == 0 || parsed.flags&authDataUserVerified == 0 {
+		return nil, errors.New("user presence and verification are required")
+	}
+
+	if parsed.flags&authDataAttested != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		// Skip the 16-byte AAGUID; we don't make trust decisions on authenticator model.
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, errors.New("credential ID truncated")
+		}
+		parsed.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, keyLength, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		parsed.publicKey = rest[:keyLength]
+	}
+	return parsed, nil
+}
+
+// parseAttestationObject returns the authenticator data from a registration.
+// The attestation statement is not verified: we ask for "none" attestation
+// and accept any authenticator the platform lets the user pick.
+func (cfg *WebAuthnConfig) parseAttestationObject(attestationObject []byte) (*authenticatorData, error) {
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	object, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	authData, ok := object["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authData")
+	}
+
+	parsed, err := cfg.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.credentialID == nil {
+		return nil, errors.New("registration did not include a credential")
+	}
+	if _, err := parseCOSEKey(parsed.publicKey); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+type coseKey struct {
+	alg    int64
+	public crypto.PublicKey
+}
+
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid COSE key: %w", err)
+	}
+	fields, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("COSE key is not a map")
+	}
+	kty, _ := fields[int64(1)].(int64)
+	alg, _ := fields[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == coseAlgES256:
+		crv, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		y, _ := fields[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("unsupported EC2 key, only P-256 is accepted")
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return nil, errors.New("EC2 key is not on the curve")
+		}
+		return &coseKey{alg: alg, public: public}, nil
+	case kty == 1 && alg == coseAlgEdDSA:
+		crv, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported OKP key, only Ed25519 is accepted")
+		}
+		return &coseKey{alg: alg, public: ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n, _ := fields[int64(-1)].([]byte)
+		e, _ := fields[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("unsupported RSA key")
+		}
+		return &coseKey{alg: alg, public: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported COSE key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verifyAssertionSignature checks the signature over authenticatorData ||
+// SHA-256(clientDataJSON) with the stored credential key.
+func verifyAssertionSignature(publicKey []byte, authData []byte, clientDataJSON []byte, signature []byte) error {
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	switch public := key.public.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		if !ecdsa.VerifyASN1(public, digest[:], signature) {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(public, signed, signature) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+var testWebAuthn = &WebAuthnConfig{
+	RPID:    "chat.example.com",
+	RPName:  "chat-app",
+	Origins: []string{"https://chat.example.com", "android:apk-key-hash:abc"},
+}
+
+// cborHead encodes a CBOR major type and argument.
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg < 1<<8:
+		return []byte{major<<5 | 24, byte(arg)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap encodes alternating keys and values, each already encoded.
+func cborMap(items ...[]byte) []byte {
+	out := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func coseEC2Key(t *testing.T, public *ecdsa.PublicKey) []byte {
+	t.Helper()
+	ecdhKey, err := public.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := ecdhKey.Bytes() // 0x04 || X || Y
+	return cborMap(
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(coseAlgES256),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(point[1:33]),
+		cborInt(-3), cborBytes(point[33:]),
+	)
+}
+
+func coseOKPKey(public ed25519.PublicKey) []byte {
+	return cborMap(
+		cborInt(1), cborInt(1),
+		cborInt(3), cborInt(coseAlgEdDSA),
+		cborInt(-1), cborInt(6),
+		cborInt(-2), cborBytes(public),
+	)
+}
+
+func coseRSAKey(public *rsa.PublicKey) []byte {
+	return cborMap(
+		cborInt(1), cborInt(3),
+		cborInt(3), cborInt(coseAlgRS256),
+		cborInt(-1), cborBytes(public.N.Bytes()),
+		cborInt(-2), cborBytes([]byte{0x01, 0x00, 0x01}),
+	)
+}
+
+// testAuthData builds authenticator data for rpID, with attested credential
+// data when credentialID is set.
+func testAuthData(rpID string, flags byte, signCount uint32, credentialID []byte, publicKey []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	if credentialID != nil {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(credentialID)))
+		data = append(data, credentialID...)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func testAttestationObject(authData []byte) []byte {
+	return cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+}
+
+func TestParseClientData(t *testing.T) {
+	tests := []struct {
+		name          string
+		clientData    string
+		ceremony      string
+		wantChallenge string
+		wantErr       string
+	}{
+		{
+			name:          "registration",
+			clientData:    `{"type":"webauthn.create","challenge":"Y2hhbGxlbmdl","origin":"https://chat.example.com"}`,
+			ceremony:      "webauthn.create",
+			wantChallenge: "Y2hhbGxlbmdl",
+		},
+		{
+			name:          "padded challenge from a native app",
+			clientData:    `{"type":"webauthn.get","challenge":"YWJjZA==","origin":"android:apk-key-hash:abc"}`,
+			ceremony:      "webauthn.get",
+			wantChallenge: "YWJjZA",
+		},
+		{
+			name:       "wrong ceremony",
+			clientData: `{"type":"webauthn.get","challenge":"Y2hhbGxlbmdl","origin":"https://chat.example.com"}`,
+			ceremony:   "webauthn.create",
+			wantErr:    "unexpected client data type",
+		},
+		{
+			name:       "other origin",
+			clientData: `{"type":"webauthn.get","challenge":"Y2hhbGxlbmdl","origin":"https://evil.example.com"}`,
+			ceremony:   "webauthn.get",
+			wantErr:    "is not allowed",
+		},
+		{
+			name:       "no challenge",
+			clientData: `{"type":"webauthn.get","origin":"https://chat.example.com"}`,
+			ceremony:   "webauthn.get",
+			wantErr:    "no challenge",
+		},
+		{
+			name:       "not JSON",
+			clientData: `webauthn.get`,
+			ceremony:   "webauthn.get",
+			wantErr:    "invalid clientDataJSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, err := testWebAuthn.parseClientData([]byte(tt.clientData), tt.ceremony)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseClientData error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseClientData error: %v", err)
+			}
+			if challenge != tt.wantChallenge {
+				t.Errorf("challenge = %q, want %q", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestParseAuthenticatorData(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := coseEC2Key(t, &private.PublicKey)
+	credentialID := []byte("credential-id")
+	verified := byte(authDataUserPresent | authDataUserVerified)
+
+	tests := []struct {
+		name             string
+		data             []byte
+		wantSignCount    uint32
+		wantCredentialID []byte
+		wantErr          string
+	}{
+		{
+			name:          "assertion",
+			data:          testAuthData(testWebAuthn.RPID, verified, 7, nil, nil),
+			wantSignCount: 7,
+		},
+		{
+			name:             "registration",
+			data:             testAuthData(testWebAuthn.RPID, verified|authDataAttested, 0, credentialID, publicKey),
+			wantCredentialID: credentialID,
+		},
+		{
+			name:    "too short",
+			data:    testAuthData(testWebAuthn.RPID, verified, 0, nil, nil)[:36],
+			wantErr: "too short",
+		},
+		{
+			name:    "other relying party",
+			data:    testAuthData("evil.example.com", verified, 0, nil, nil),
+			wantErr: "different relying party",
+		},
+		{
+			name:    "user not verified",
+			data:    testAuthData(testWebAuthn.RPID, authDataUserPresent, 0, nil, nil),
+			wantErr: "verification are required",
+		},
+		{
+			name:    "user not present",
+			data:    testAuthData(testWebAuthn.RPID, authDataUserVerified, 0, nil, nil),
+			wantErr: "verification are required",
+		},
+		{
+			name:    "attested data too short",
+			data:    append(testAuthData(testWebAuthn.RPID, verified|authDataAttested, 0, nil, nil), make([]byte, 17)...),
+			wantErr: "attested credential data too short",
+		},
+		{
+			name:    "credential ID truncated",
+			data:    testAuthData(testWebAuthn.RPID, verified|authDataAttested, 0, credentialID, nil)[:37+18+4],
+			wantErr: "credential ID truncated",
+		},
+		{
+			name:    "public key truncated",
+			data:    testAuthData(testWebAuthn.RPID, verified|authDataAttested, 0, credentialID, publicKey[:10]),
+			wantErr: "invalid credential public key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := testWebAuthn.parseAuthenticatorData(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAuthenticatorData error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAuthenticatorData error: %v", err)
+			}
+			if parsed.signCount != tt.wantSignCount {
+				t.Errorf("signCount = %d, want %d", parsed.signCount, tt.wantSignCount)
+			}
+			if string(parsed.credentialID) != string(tt.wantCredentialID) {
+				t.Errorf("credentialID = %q, want %q", parsed.credentialID, tt.wantCredentialID)
+			}
+			if tt.wantCredentialID != nil && string(parsed.publicKey) != string(publicKey) {
+				t.Errorf("publicKey = %x, want %x", parsed.publicKey, publicKey)
+			}
+		})
+	}
+}
+
+func TestParseAttestationObject(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := coseEC2Key(t, &private.PublicKey)
+	credentialID := []byte("credential-id")
+	flags := byte(authDataUserPresent | authDataUserVerified | authDataAttested)
+	unsupportedKey := cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(-35))
+
+	tests := []struct {
+		name    string
+		object  []byte
+		wantErr string
+	}{
+		{
+			name:   "none attestation",
+			object: testAttestationObject(testAuthData(testWebAuthn.RPID, flags, 0, credentialID, publicKey)),
+		},
+		{
+			name:    "not CBOR",
+			object:  []byte{0xff},
+			wantErr: "invalid attestation object",
+		},
+		{
+			name:    "not a map",
+			object:  cborBytes([]byte("authData")),
+			wantErr: "not a map",
+		},
+		{
+			name:    "no authData",
+			object:  cborMap(cborText("fmt"), cborText("none")),
+			wantErr: "no authData",
+		},
+		{
+			name:    "no credential",
+			object:  testAttestationObject(testAuthData(testWebAuthn.RPID, flags&^authDataAttested, 0, nil, nil)),
+			wantErr: "did not include a credential",
+		},
+		{
+			name:    "unsupported key",
+			object:  testAttestationObject(testAuthData(testWebAuthn.RPID, flags, 0, credentialID, unsupportedKey)),
+			wantErr: "unsupported COSE key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := testWebAuthn.parseAttestationObject(tt.object)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAttestationObject error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAttestationObject error: %v", err)
+			}
+			if string(parsed.credentialID) != string(credentialID) {
+				t.Errorf("credentialID = %q, want %q", parsed.credentialID, credentialID)
+			}
+		})
+	}
+}
+
+func TestParseCOSEKeyRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"not a map", cborBytes([]byte{1, 2, 3})},
+		{"EC2 point off the curve", cborMap(
+			cborInt(1), cborInt(2),
+			cborInt(3), cborInt(coseAlgES256),
+			cborInt(-1), cborInt(1),
+			cborInt(-2), cborBytes(make([]byte, 32)),
+			cborInt(-3), cborBytes(append(make([]byte, 31), 1)),
+		)},
+		{"EC2 on P-384", cborMap(
+			cborInt(1), cborInt(2),
+			cborInt(3), cborInt(coseAlgES256),
+			cborInt(-1), cborInt(2),
+			cborInt(-2), cborBytes(make([]byte, 32)),
+			cborInt(-3), cborBytes(make([]byte, 32)),
+		)},
+		{"OKP on X25519", cborMap(
+			cborInt(1), cborInt(1),
+			cborInt(3), cborInt(coseAlgEdDSA),
+			cborInt(-1), cborInt(4),
+			cborInt(-2), cborBytes(make([]byte, 32)),
+		)},
+		{"short RSA modulus", cborMap(
+			cborInt(1), cborInt(3),
+			cborInt(3), cborInt(coseAlgRS256),
+			cborInt(-1), cborBytes(make([]byte, 128)),
+			cborInt(-2), cborBytes([]byte{0x01, 0x00, 0x01}),
+		)},
+		{"algorithm for another key type", cborMap(
+			cborInt(1), cborInt(1),
+			cborInt(3), cborInt(coseAlgES256),
+		)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCOSEKey(tt.key); err == nil {
+				t.Error("parseCOSEKey succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionSignature(t *testing.T) {
+	authData := testAuthData(testWebAuthn.RPID, authDataUserPresent|authDataUserVerified, 1, nil, nil)
+	clientDataJSON := []byte(`{"type":"webauthn.get","challenge":"Y2hhbGxlbmdl","origin":"https://chat.example.com"}`)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecPrivate, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSignature := ed25519.Sign(edPrivate, signed)
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaPrivate, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []struct {
+		name      string
+		publicKey []byte
+		signature []byte
+	}{
+		{"ES256", coseEC2Key(t, &ecPrivate.PublicKey), ecSignature},
+		{"EdDSA", coseOKPKey(edPublic), edSignature},
+		{"RS256", coseRSAKey(&rsaPrivate.PublicKey), rsaSignature},
+	}
+
+	for _, key := range keys {
+		t.Run(key.name, func(t *testing.T) {
+			if err := verifyAssertionSignature(key.publicKey, authData, clientDataJSON, key.signature); err != nil {
+				t.Errorf("valid signature rejected: %v", err)
+			}
+
+			otherClientData := []byte(strings.Replace(string(clientDataJSON), "Y2hhbGxlbmdl", "b3RoZXI", 1))
+			if err := verifyAssertionSignature(key.publicKey, authData, otherClientData, key.signature); err == nil {
+				t.Error("signature accepted for different client data")
+			}
+
+			otherAuthData := append([]byte{}, authData...)
+			otherAuthData[36]++ // sign count
+			if err := verifyAssertionSignature(key.publicKey, otherAuthData, clientDataJSON, key.signature); err == nil {
+				t.Error("signature accepted for different authenticator data")
+			}
+
+			tampered := append([]byte{}, key.signature...)
+			tampered[len(tampered)-1] ^= 0x01
+			if err := verifyAssertionSignature(key.publicKey, authData, clientDataJSON, tampered); err == nil {
+				t.Error("tampered signature accepted")
+			}
+		})
+	}
+}
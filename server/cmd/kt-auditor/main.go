@@ -0,0 +1,264 @@
+// Command kt-auditor checks the key transparency log from the outside, the way
+// a client would, and is meant to run on a schedule (e.g. in CI). It
+//
+//   - verifies the latest tree head signature against the pinned log key,
+//   - checks the log only grew since the tree head it saw last time,
+//   - recomputes the root hash from every leaf hash, and
+//   - checks that every device key the server hands the token's user is
+//     included in the tree, and that the log has no current keys the server
+//     leaves out.
+//
+// It exits non-zero on the first failed check. A key registered in the last
+// few seconds may not be sequenced yet; rerun before raising the alarm.
+//
+// Configuration:
+//
+//	KT_AUDITOR_SERVER      server base URL (default http://localhost:8080)
+//	KT_AUDITOR_TOKEN       personal access token with the users:read scope
+//	KT_AUDITOR_PUBLIC_KEY  base64 Ed25519 log key to pin; fetched from the server when unset
+//	KT_AUDITOR_STATE       file holding the last verified tree head (default kt-auditor-state.json)
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"chat-app-server/transparency"
+
+	"github.com/google/uuid"
+)
+
+const leafHashesPageSize = 10000
+
+type auditor struct {
+	server    string
+	token     string
+	client    *http.Client
+	publicKey ed25519.PublicKey
+}
+
+type deviceKeyInfo struct {
+	DeviceIdentifier string `json:"device_identifier"`
+	PublicKey        []byte `json:"public_key"`
+}
+
+type userDeviceKeys struct {
+	UserID     uuid.UUID       `json:"user_id"`
+	DeviceKeys []deviceKeyInfo `json:"device_keys"`
+}
+
+func getenv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (a *auditor) get(path string, out any) error {
+	req, err := http.NewRequest(http.MethodGet, a.server+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (a *auditor) loadPublicKey(pinned string) error {
+	if pinned == "" {
+		log.Println("Warning: KT_AUDITOR_PUBLIC_KEY not set, trusting the key the server publishes.")
+		var published struct {
+			PublicKey string `json:"public_key"`
+		}
+		if err := a.get("/.well-known/key-transparency.json", &published); err != nil {
+			return err
+		}
+		pinned = published.PublicKey
+	}
+	key, err := base64.StdEncoding.DecodeString(pinned)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("log public key must be a base64 Ed25519 public key")
+	}
+	a.publicKey = key
+	return nil
+}
+
+func loadState(path string) (*transparency.TreeHead, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var head transparency.TreeHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &head, nil
+}
+
+func saveState(path string, head transparency.TreeHead) error {
+	data, err := json.MarshalIndent(head, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func (a *auditor) checkConsistency(previous transparency.TreeHead, head transparency.TreeHead) error {
+	if previous.TreeSize > head.TreeSize {
+		return fmt.Errorf("log shrank from %d to %d leaves", previous.TreeSize, head.TreeSize)
+	}
+	var response struct {
+		TreeHead transparency.TreeHead `json:"tree_head"`
+		Proof    [][]byte              `json:"proof"`
+	}
+	path := fmt.Sprintf("/api/transparency/consistency?first=%d&second=%d", previous.TreeSize, head.TreeSize)
+	if err := a.get(path, &response); err != nil {
+		return err
+	}
+	if !bytes.Equal(response.TreeHead.RootHash, head.RootHash) {
+		return errors.New("server returned a different root hash for the same tree size")
+	}
+	return transparency.VerifyConsistency(previous.TreeSize, head.TreeSize, previous.RootHash, head.RootHash, response.Proof)
+}
+
+func (a *auditor) checkRootHash(head transparency.TreeHead) error {
+	leafHashes := make([][]byte, 0, head.TreeSize)
+	for uint64(len(leafHashes)) < head.TreeSize {
+		var page struct {
+			LeafHashes [][]byte `json:"leaf_hashes"`
+		}
+		start := uint64(len(leafHashes))
+		end := min(start+leafHashesPageSize, head.TreeSize)
+		if err := a.get(fmt.Sprintf("/api/transparency/leaf-hashes?start=%d&end=%d", start, end), &page); err != nil {
+			return err
+		}
+		if len(page.LeafHashes) == 0 {
+			return fmt.Errorf("log has only %d of %d leaves", start, head.TreeSize)
+		}
+		leafHashes = append(leafHashes, page.LeafHashes...)
+	}
+	if !bytes.Equal(transparency.RootHash(leafHashes[:head.TreeSize]), head.RootHash) {
+		return errors.New("leaf hashes do not add up to the signed root hash")
+	}
+	return nil
+}
+
+// checkDeviceKeys compares the device keys the server serves with the keys
+// the log says are current for each of those users.
+func (a *auditor) checkDeviceKeys(head transparency.TreeHead) error {
+	var users []userDeviceKeys
+	if err := a.get("/api/users/device-keys", &users); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		var response struct {
+			Entries []transparency.InclusionEntry `json:"entries"`
+		}
+		path := fmt.Sprintf("/api/transparency/users/%s/inclusion?tree_size=%d", user.UserID, head.TreeSize)
+		if err := a.get(path, &response); err != nil {
+			return err
+		}
+
+		logged := make(map[string][]byte, len(response.Entries))
+		for _, entry := range response.Entries {
+			leafHash := transparency.HashLeaf(entry.LeafData)
+			if err := transparency.VerifyInclusion(entry.LeafIndex, head.TreeSize, leafHash, entry.Proof, head.RootHash); err != nil {
+				return fmt.Errorf("user %s leaf %d: %w", user.UserID, entry.LeafIndex, err)
+			}
+			leaf, err := transparency.ParseLeaf(entry.LeafData)
+			if err != nil {
+				return fmt.Errorf("user %s leaf %d: %w", user.UserID, entry.LeafIndex, err)
+			}
+			if leaf.UserID != user.UserID {
+				return fmt.Errorf("leaf %d belongs to user %s, not %s", entry.LeafIndex, leaf.UserID, user.UserID)
+			}
+			logged[leaf.DeviceIdentifier] = leaf.PublicKey
+		}
+
+		for _, key := range user.DeviceKeys {
+			publicKey, ok := logged[key.DeviceIdentifier]
+			if !ok {
+				return fmt.Errorf("user %s device %s is served but not in the log", user.UserID, key.DeviceIdentifier)
+			}
+			if !bytes.Equal(publicKey, key.PublicKey) {
+				return fmt.Errorf("user %s device %s is served with a key that differs from the log", user.UserID, key.DeviceIdentifier)
+			}
+			delete(logged, key.DeviceIdentifier)
+		}
+		for deviceIdentifier := range logged {
+			return fmt.Errorf("user %s device %s is in the log but not served", user.UserID, deviceIdentifier)
+		}
+	}
+	log.Printf("Device keys of %d user(s) match the log", len(users))
+	return nil
+}
+
+func main() {
+	a := &auditor{
+		server: strings.TrimSuffix(getenv("KT_AUDITOR_SERVER", "http://localhost:8080"), "/"),
+		token:  os.Getenv("KT_AUDITOR_TOKEN"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	statePath := getenv("KT_AUDITOR_STATE", "kt-auditor-state.json")
+	if a.token == "" {
+		log.Fatal("KT_AUDITOR_TOKEN must be set")
+	}
+
+	if err := a.loadPublicKey(os.Getenv("KT_AUDITOR_PUBLIC_KEY")); err != nil {
+		log.Fatalf("Could not load log public key: %v", err)
+	}
+
+	var head transparency.TreeHead
+	if err := a.get("/api/transparency/tree-head", &head); err != nil {
+		log.Fatalf("Could not fetch tree head: %v", err)
+	}
+	if err := head.Verify(a.publicKey); err != nil {
+		log.Fatalf("FAIL: %v", err)
+	}
+	log.Printf("Tree head of size %d verified", head.TreeSize)
+
+	previous, err := loadState(statePath)
+	if err != nil {
+		log.Fatalf("Could not load state: %v", err)
+	}
+	if previous != nil {
+		if err := a.checkConsistency(*previous, head); err != nil {
+			log.Fatalf("FAIL: not consistent with the tree head of size %d seen before: %v", previous.TreeSize, err)
+		}
+		log.Printf("Consistent with the tree head of size %d seen before", previous.TreeSize)
+	}
+
+	if err := a.checkRootHash(head); err != nil {
+		log.Fatalf("FAIL: %v", err)
+	}
+	log.Println("Root hash recomputed from all leaves")
+
+	if err := a.checkDeviceKeys(head); err != nil {
+		log.Fatalf("FAIL: %v", err)
+	}
+
+	if err := saveState(statePath, head); err != nil {
+		log.Fatalf("Could not save state: %v", err)
+	}
+	log.Println("OK")
+}
@@ -0,0 +1,288 @@
+// Command mock-oidc is a minimal OpenID Connect provider for local development
+// and testing of single sign-on. It implements discovery, JWKS, the
+// authorization endpoint (a bare HTML form, or auto-approval when login_hint is
+// given) and the token endpoint with PKCE (S256). Never expose it publicly: it
+// signs in anyone as anyone.
+//
+// Configuration:
+//
+//	MOCK_OIDC_ADDR           listen address (default :9400)
+//	MOCK_OIDC_ISSUER         issuer URL; must be reachable by both the app and the server (default http://localhost:9400)
+//	MOCK_OIDC_CLIENT_ID      expected client_id (default chat-app)
+//	MOCK_OIDC_CLIENT_SECRET  optional client secret to require at the token endpoint
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	signingKID = "mock-oidc-1"
+	codeTTL    = time.Minute
+	idTokenTTL = 5 * time.Minute
+)
+
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	emailVerified bool
+	username      string
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	publicKey    ed25519.PublicKey
+	privateKey   ed25519.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+func getenv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func randomString() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatalf("Could not read random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+func tokenError(w http.ResponseWriter, code string, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": signingKID,
+			"use": "sig",
+			"alg": "EdDSA",
+			"x":   base64.RawURLEncoding.EncodeToString(p.publicKey),
+		}},
+	})
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!doctype html>
+<html><body>
+<h1>Mock OIDC sign-in</h1>
+<form method="post">
+{{range $key, $values := .Query}}{{range $values}}<input type="hidden" name="{{$key}}" value="{{.}}">{{end}}{{end}}
+<p><label>Email <input name="login_hint" type="email" required></label></p>
+<p><label>Username <input name="username"></label></p>
+<p><label><input name="email_verified" type="checkbox" value="true" checked> Email verified</label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body></html>`))
+
+// authorize shows the sign-in form, or approves immediately when the request
+// already carries login_hint (handy for scripted tests).
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+
+	redirectURI := params.Get("redirect_uri")
+	if params.Get("client_id") != p.clientID || redirectURI == "" {
+		http.Error(w, "unknown client_id or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if params.Get("response_type") != "code" ||
+		params.Get("code_challenge") == "" ||
+		params.Get("code_challenge_method") != "S256" {
+		http.Error(w, "only response_type=code with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(params.Get("login_hint"))
+	if email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := loginForm.Execute(w, map[string]any{"Query": r.URL.Query()}); err != nil {
+			log.Printf("Error rendering login form: %v", err)
+		}
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		clientID:      p.clientID,
+		redirectURI:   redirectURI,
+		nonce:         params.Get("nonce"),
+		codeChallenge: params.Get("code_challenge"),
+		email:         email,
+		emailVerified: params.Get("email_verified") != "false",
+		username:      params.Get("username"),
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	query.Set("code", code)
+	query.Set("state", params.Get("state"))
+	target.RawQuery = query.Encode()
+	log.Printf("Authorized %s, redirecting to %s", email, target.Scheme+"://"+target.Host+target.Path)
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", "could not parse form")
+		return
+	}
+
+	clientID, clientSecret, hasBasic := r.BasicAuth()
+	if hasBasic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID ||
+		(p.clientSecret != "" && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(auth.expiresAt) {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != auth.redirectURI {
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	}
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifierHash[:]) != auth.codeChallenge {
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            "mock|" + strings.ToLower(auth.email),
+		"aud":            auth.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(idTokenTTL).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": auth.emailVerified,
+	}
+	if auth.username != "" {
+		claims["preferred_username"] = auth.username
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	idToken.Header["kid"] = signingKID
+	signed, err := idToken.SignedString(p.privateKey)
+	if err != nil {
+		log.Printf("Error signing id_token: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenTTL.Seconds()),
+		"id_token":     signed,
+	})
+}
+
+func main() {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatalf("Could not generate signing key: %v", err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(getenv("MOCK_OIDC_ISSUER", "http://localhost:9400"), "/"),
+		clientID:     getenv("MOCK_OIDC_CLIENT_ID", "chat-app"),
+		clientSecret: os.Getenv("MOCK_OIDC_CLIENT_SECRET"),
+		publicKey:    publicKey,
+		privateKey:   privateKey,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+
+	addr := getenv("MOCK_OIDC_ADDR", ":9400")
+	log.Printf("Mock OIDC provider for client %q listening on %s with issuer %s", p.clientID, addr, p.issuer)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
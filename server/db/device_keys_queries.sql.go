@@ -9,6 +9,7 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const deleteAllDeviceKeysForUser = `-- name: DeleteAllDeviceKeysForUser :exec
@@ -36,8 +37,39 @@ func (q *Queries) DeleteDeviceKey(ctx context.Context, arg DeleteDeviceKeyParams
 	return err
 }
 
+const deleteOtherDeviceKeysForUser = `-- name: DeleteOtherDeviceKeysForUser :many
+DELETE FROM device_keys
+WHERE user_id = $1 AND device_identifier <> $2
+RETURNING device_identifier
+`
+
+type DeleteOtherDeviceKeysForUserParams struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+}
+
+func (q *Queries) DeleteOtherDeviceKeysForUser(ctx context.Context, arg DeleteOtherDeviceKeysForUserParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, deleteOtherDeviceKeysForUser, arg.UserID, arg.DeviceIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var device_identifier string
+		if err := rows.Scan(&device_identifier); err != nil {
+			return nil, err
+		}
+		items = append(items, device_identifier)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDeviceKeyByIdentifier = `-- name: GetDeviceKeyByIdentifier :one
-SELECT id, user_id, device_identifier, public_key, created_at, last_seen_at FROM device_keys
+SELECT id, user_id, device_identifier, public_key, created_at, last_seen_at, name, signature FROM device_keys
 WHERE user_id = $1 AND device_identifier = $2
 LIMIT 1
 `
@@ -57,12 +89,14 @@ func (q *Queries) GetDeviceKeyByIdentifier(ctx context.Context, arg GetDeviceKey
 		&i.PublicKey,
 		&i.CreatedAt,
 		&i.LastSeenAt,
+		&i.Name,
+		&i.Signature,
 	)
 	return i, err
 }
 
 const getDeviceKeysForUser = `-- name: GetDeviceKeysForUser :many
-SELECT id, user_id, device_identifier, public_key, created_at, last_seen_at FROM device_keys
+SELECT id, user_id, device_identifier, public_key, created_at, last_seen_at, name, signature FROM device_keys
 WHERE user_id = $1
 ORDER BY created_at DESC
 `
@@ -83,6 +117,8 @@ func (q *Queries) GetDeviceKeysForUser(ctx context.Context, userID uuid.UUID) ([
 			&i.PublicKey,
 			&i.CreatedAt,
 			&i.LastSeenAt,
+			&i.Name,
+			&i.Signature,
 		); err != nil {
 			return nil, err
 		}
@@ -94,29 +130,101 @@ func (q *Queries) GetDeviceKeysForUser(ctx context.Context, userID uuid.UUID) ([
 	return items, nil
 }
 
+const getGroupDeviceIdentifiers = `-- name: GetGroupDeviceIdentifiers :many
+SELECT dk.user_id, dk.device_identifier
+FROM device_keys dk
+JOIN user_groups ug ON ug.user_id = dk.user_id
+WHERE ug.group_id = $1
+ORDER BY dk.user_id, dk.device_identifier
+`
+
+type GetGroupDeviceIdentifiersRow struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+}
+
+// Every device of every current member of the group, i.e. the devices a
+// message to the group must carry an envelope for.
+func (q *Queries) GetGroupDeviceIdentifiers(ctx context.Context, groupID *uuid.UUID) ([]GetGroupDeviceIdentifiersRow, error) {
+	rows, err := q.db.Query(ctx, getGroupDeviceIdentifiers, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGroupDeviceIdentifiersRow
+	for rows.Next() {
+		var i GetGroupDeviceIdentifiersRow
+		if err := rows.Scan(&i.UserID, &i.DeviceIdentifier); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const registerDeviceKey = `-- name: RegisterDeviceKey :one
 INSERT INTO device_keys (
     user_id,
     device_identifier,
     public_key,
+    signature,
     last_seen_at
 ) VALUES (
-    $1, $2, $3, now()
+    $1, $2, $3, $4, now()
 )
 ON CONFLICT (user_id, device_identifier) DO UPDATE SET
     public_key = EXCLUDED.public_key,
+    signature = EXCLUDED.signature,
     last_seen_at = now()
-RETURNING id, user_id, device_identifier, public_key, created_at, last_seen_at
+RETURNING id, user_id, device_identifier, public_key, created_at, last_seen_at, name, signature
 `
 
 type RegisterDeviceKeyParams struct {
 	UserID           uuid.UUID `json:"user_id"`
 	DeviceIdentifier string    `json:"device_identifier"`
 	PublicKey        []byte    `json:"public_key"`
+	Signature        []byte    `json:"signature"`
 }
 
 func (q *Queries) RegisterDeviceKey(ctx context.Context, arg RegisterDeviceKeyParams) (DeviceKey, error) {
-	row := q.db.QueryRow(ctx, registerDeviceKey, arg.UserID, arg.DeviceIdentifier, arg.PublicKey)
+	row := q.db.QueryRow(ctx, registerDeviceKey,
+		arg.UserID,
+		arg.DeviceIdentifier,
+		arg.PublicKey,
+		arg.Signature,
+	)
+	var i DeviceKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.DeviceIdentifier,
+		&i.PublicKey,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.Name,
+		&i.Signature,
+	)
+	return i, err
+}
+
+const renameDeviceKey = `-- name: RenameDeviceKey :one
+UPDATE device_keys
+SET name = $3
+WHERE user_id = $1 AND device_identifier = $2
+RETURNING id, user_id, device_identifier, public_key, created_at, last_seen_at, name, signature
+`
+
+type RenameDeviceKeyParams struct {
+	UserID           uuid.UUID   `json:"user_id"`
+	DeviceIdentifier string      `json:"device_identifier"`
+	Name             pgtype.Text `json:"name"`
+}
+
+func (q *Queries) RenameDeviceKey(ctx context.Context, arg RenameDeviceKeyParams) (DeviceKey, error) {
+	row := q.db.QueryRow(ctx, renameDeviceKey, arg.UserID, arg.DeviceIdentifier, arg.Name)
 	var i DeviceKey
 	err := row.Scan(
 		&i.ID,
@@ -125,6 +233,8 @@ func (q *Queries) RegisterDeviceKey(ctx context.Context, arg RegisterDeviceKeyPa
 		&i.PublicKey,
 		&i.CreatedAt,
 		&i.LastSeenAt,
+		&i.Name,
+		&i.Signature,
 	)
 	return i, err
 }
@@ -144,3 +254,23 @@ func (q *Queries) UpdateDeviceKeyLastSeen(ctx context.Context, arg UpdateDeviceK
 	_, err := q.db.Exec(ctx, updateDeviceKeyLastSeen, arg.UserID, arg.DeviceIdentifier)
 	return err
 }
+
+const updateDeviceKeySignature = `-- name: UpdateDeviceKeySignature :execrows
+UPDATE device_keys
+SET signature = $3
+WHERE user_id = $1 AND device_identifier = $2
+`
+
+type UpdateDeviceKeySignatureParams struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	Signature        []byte    `json:"signature"`
+}
+
+func (q *Queries) UpdateDeviceKeySignature(ctx context.Context, arg UpdateDeviceKeySignatureParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateDeviceKeySignature, arg.UserID, arg.DeviceIdentifier, arg.Signature)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
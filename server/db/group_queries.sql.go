@@ -85,20 +85,21 @@ func (q *Queries) GetAllGroups(ctx context.Context) ([]GetAllGroupsRow, error) {
 }
 
 const getGroupById = `-- name: GetGroupById :one
-SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at" FROM groups WHERE id = $1
+SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at", "encrypted_reactions" FROM groups WHERE id = $1
 `
 
 type GetGroupByIdRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	ID                 uuid.UUID        `json:"id"`
+	Name               string           `json:"name"`
+	Description        pgtype.Text      `json:"description"`
+	Location           pgtype.Text      `json:"location"`
+	ImageUrl           pgtype.Text      `json:"image_url"`
+	Blurhash           pgtype.Text      `json:"blurhash"`
+	StartTime          pgtype.Timestamp `json:"start_time"`
+	EndTime            pgtype.Timestamp `json:"end_time"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	UpdatedAt          pgtype.Timestamp `json:"updated_at"`
+	EncryptedReactions bool             `json:"encrypted_reactions"`
 }
 
 func (q *Queries) GetGroupById(ctx context.Context, id uuid.UUID) (GetGroupByIdRow, error) {
@@ -115,6 +116,7 @@ func (q *Queries) GetGroupById(ctx context.Context, id uuid.UUID) (GetGroupByIdR
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EncryptedReactions,
 	)
 	return i, err
 }
@@ -131,6 +133,7 @@ SELECT
     g.end_time,
     g.created_at,
     g.updated_at,
+    g.encrypted_reactions,
     (SELECT ug_check.admin FROM user_groups ug_check WHERE ug_check.group_id = g.id AND ug_check.user_id = $1) AS admin, -- Admin status of the requesting user for THIS group
     COALESCE(
         (SELECT json_agg(jsonb_build_object('id', u.id, 'username', u.username, 'email', u.email, 'admin', ug.admin, 'invited_at', ug.created_at))::text
@@ -151,18 +154,19 @@ type GetGroupWithUsersByIDParams struct {
 }
 
 type GetGroupWithUsersByIDRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
-	Admin       bool             `json:"admin"`
-	GroupUsers  interface{}      `json:"group_users"`
+	ID                 uuid.UUID        `json:"id"`
+	Name               string           `json:"name"`
+	Description        pgtype.Text      `json:"description"`
+	Location           pgtype.Text      `json:"location"`
+	ImageUrl           pgtype.Text      `json:"image_url"`
+	Blurhash           pgtype.Text      `json:"blurhash"`
+	StartTime          pgtype.Timestamp `json:"start_time"`
+	EndTime            pgtype.Timestamp `json:"end_time"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	UpdatedAt          pgtype.Timestamp `json:"updated_at"`
+	EncryptedReactions bool             `json:"encrypted_reactions"`
+	Admin              bool             `json:"admin"`
+	GroupUsers         interface{}      `json:"group_users"`
 }
 
 func (q *Queries) GetGroupWithUsersByID(ctx context.Context, arg GetGroupWithUsersByIDParams) (GetGroupWithUsersByIDRow, error) {
@@ -179,6 +183,7 @@ func (q *Queries) GetGroupWithUsersByID(ctx context.Context, arg GetGroupWithUse
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EncryptedReactions,
 		&i.Admin,
 		&i.GroupUsers,
 	)
@@ -186,7 +191,7 @@ func (q *Queries) GetGroupWithUsersByID(ctx context.Context, arg GetGroupWithUse
 }
 
 const getGroupsForUser = `-- name: GetGroupsForUser :many
-SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, groups.updated_at,
+SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, groups.updated_at, groups.encrypted_reactions,
 json_agg(jsonb_build_object('id', u2.id, 'username', u2.username, 'email', u2.email, 'admin', ug2.admin, 'invited_at', ug2.created_at))::text AS group_users 
 FROM groups
 JOIN user_groups ug ON ug.group_id = groups.id
@@ -198,18 +203,19 @@ GROUP BY groups.id, ug.id, u.id
 `
 
 type GetGroupsForUserRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	Admin       bool             `json:"admin"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
-	GroupUsers  string           `json:"group_users"`
+	ID                 uuid.UUID        `json:"id"`
+	Name               string           `json:"name"`
+	Description        pgtype.Text      `json:"description"`
+	Location           pgtype.Text      `json:"location"`
+	ImageUrl           pgtype.Text      `json:"image_url"`
+	Blurhash           pgtype.Text      `json:"blurhash"`
+	StartTime          pgtype.Timestamp `json:"start_time"`
+	EndTime            pgtype.Timestamp `json:"end_time"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	Admin              bool             `json:"admin"`
+	UpdatedAt          pgtype.Timestamp `json:"updated_at"`
+	EncryptedReactions bool             `json:"encrypted_reactions"`
+	GroupUsers         string           `json:"group_users"`
 }
 
 func (q *Queries) GetGroupsForUser(ctx context.Context, id uuid.UUID) ([]GetGroupsForUserRow, error) {
@@ -233,6 +239,7 @@ func (q *Queries) GetGroupsForUser(ctx context.Context, id uuid.UUID) ([]GetGrou
 			&i.CreatedAt,
 			&i.Admin,
 			&i.UpdatedAt,
+			&i.EncryptedReactions,
 			&i.GroupUsers,
 		); err != nil {
 			return nil, err
@@ -246,7 +253,7 @@ func (q *Queries) GetGroupsForUser(ctx context.Context, id uuid.UUID) ([]GetGrou
 }
 
 const insertGroup = `-- name: InsertGroup :one
-INSERT INTO groups ("id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, name, created_at, updated_at, start_time, end_time, description, location, image_url, blurhash
+INSERT INTO groups ("id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, name, created_at, updated_at, start_time, end_time, description, location, image_url, blurhash, encrypted_reactions
 `
 
 type InsertGroupParams struct {
@@ -283,6 +290,7 @@ func (q *Queries) InsertGroup(ctx context.Context, arg InsertGroupParams) (Group
 		&i.Location,
 		&i.ImageUrl,
 		&i.Blurhash,
+		&i.EncryptedReactions,
 	)
 	return i, err
 }
@@ -296,33 +304,36 @@ SET
     "description" = coalesce($5, "description"),
     "location" = coalesce($6, "location"),
     "image_url" = coalesce($7, "image_url"),
-    "blurhash" = coalesce($8, "blurhash")
+    "blurhash" = coalesce($8, "blurhash"),
+    "encrypted_reactions" = coalesce($9, "encrypted_reactions")
 WHERE id = $1
-RETURNING "id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "created_at", "updated_at"
+RETURNING "id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "created_at", "updated_at", "encrypted_reactions"
 `
 
 type UpdateGroupParams struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        pgtype.Text      `json:"name"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
+	ID                 uuid.UUID        `json:"id"`
+	Name               pgtype.Text      `json:"name"`
+	StartTime          pgtype.Timestamp `json:"start_time"`
+	EndTime            pgtype.Timestamp `json:"end_time"`
+	Description        pgtype.Text      `json:"description"`
+	Location           pgtype.Text      `json:"location"`
+	ImageUrl           pgtype.Text      `json:"image_url"`
+	Blurhash           pgtype.Text      `json:"blurhash"`
+	EncryptedReactions pgtype.Bool      `json:"encrypted_reactions"`
 }
 
 type UpdateGroupRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	ID                 uuid.UUID        `json:"id"`
+	Name               string           `json:"name"`
+	StartTime          pgtype.Timestamp `json:"start_time"`
+	EndTime            pgtype.Timestamp `json:"end_time"`
+	Description        pgtype.Text      `json:"description"`
+	Location           pgtype.Text      `json:"location"`
+	ImageUrl           pgtype.Text      `json:"image_url"`
+	Blurhash           pgtype.Text      `json:"blurhash"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	UpdatedAt          pgtype.Timestamp `json:"updated_at"`
+	EncryptedReactions bool             `json:"encrypted_reactions"`
 }
 
 func (q *Queries) UpdateGroup(ctx context.Context, arg UpdateGroupParams) (UpdateGroupRow, error) {
@@ -335,6 +346,7 @@ func (q *Queries) UpdateGroup(ctx context.Context, arg UpdateGroupParams) (Updat
 		arg.Location,
 		arg.ImageUrl,
 		arg.Blurhash,
+		arg.EncryptedReactions,
 	)
 	var i UpdateGroupRow
 	err := row.Scan(
@@ -348,6 +360,7 @@ func (q *Queries) UpdateGroup(ctx context.Context, arg UpdateGroupParams) (Updat
 		&i.Blurhash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EncryptedReactions,
 	)
 	return i, err
 }
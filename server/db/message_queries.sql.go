@@ -12,33 +12,6 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const deleteMessage = `-- name: DeleteMessage :one
-DELETE FROM messages
-WHERE id = $1
-RETURNING id, user_id, group_id, created_at
-`
-
-type DeleteMessageRow struct {
-	ID        uuid.UUID        `json:"id"`
-	UserID    *uuid.UUID       `json:"user_id"`
-	GroupID   *uuid.UUID       `json:"group_id"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
-}
-
-// Deletes a message by its ID.
-// Returns the deleted message's core fields (E2EE fields might be large to return).
-func (q *Queries) DeleteMessage(ctx context.Context, id uuid.UUID) (DeleteMessageRow, error) {
-	row := q.db.QueryRow(ctx, deleteMessage, id)
-	var i DeleteMessageRow
-	err := row.Scan(
-		&i.ID,
-		&i.UserID,
-		&i.GroupID,
-		&i.CreatedAt,
-	)
-	return i, err
-}
-
 const getAllMessages = `-- name: GetAllMessages :many
 SELECT
     id,
@@ -48,22 +21,20 @@ SELECT
     updated_at,
     ciphertext,
     message_type,
-    msg_nonce,
-    key_envelopes
+    msg_nonce
 FROM messages
 ORDER BY created_at DESC
 `
 
 type GetAllMessagesRow struct {
-	ID           uuid.UUID        `json:"id"`
-	UserID       *uuid.UUID       `json:"user_id"`
-	GroupID      *uuid.UUID       `json:"group_id"`
-	CreatedAt    pgtype.Timestamp `json:"created_at"`
-	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
-	Ciphertext   []byte           `json:"ciphertext"`
-	MessageType  MessageType      `json:"message_type"`
-	MsgNonce     []byte           `json:"msg_nonce"`
-	KeyEnvelopes []byte           `json:"key_envelopes"`
+	ID          uuid.UUID        `json:"id"`
+	UserID      *uuid.UUID       `json:"user_id"`
+	GroupID     *uuid.UUID       `json:"group_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	Ciphertext  []byte           `json:"ciphertext"`
+	MessageType MessageType      `json:"message_type"`
+	MsgNonce    []byte           `json:"msg_nonce"`
 }
 
 // Retrieves all messages. Use with caution on large datasets.
@@ -86,7 +57,126 @@ func (q *Queries) GetAllMessages(ctx context.Context) ([]GetAllMessagesRow, erro
 			&i.Ciphertext,
 			&i.MessageType,
 			&i.MsgNonce,
-			&i.KeyEnvelopes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCurrentTimestamp = `-- name: GetCurrentTimestamp :one
+SELECT now()::timestamp AS now
+`
+
+// The database clock, which stamps updated_at and deleted_at; a full sync
+// starts its changes watermark here.
+func (q *Queries) GetCurrentTimestamp(ctx context.Context) (pgtype.Timestamp, error) {
+	row := q.db.QueryRow(ctx, getCurrentTimestamp)
+	var now pgtype.Timestamp
+	err := row.Scan(&now)
+	return now, err
+}
+
+const getEditedMessages = `-- name: GetEditedMessages :many
+SELECT
+    m.id,
+    m.group_id,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
+    m.updated_at,
+    m.deleted_at,
+    m.ciphertext,
+    m.message_type,
+    m.msg_nonce,
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = $1
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = $2 AND me.user_id = $1
+WHERE (m.updated_at, m.id) > ($3::timestamp, $4::uuid)
+AND m.updated_at > m.created_at
+AND m.deleted_at IS NULL
+AND m.created_at > ug.created_at
+AND ($5::uuid IS NULL OR m.group_id = $5::uuid)
+AND (m.created_at, m.id) <= ($6::timestamp, $7::uuid)
+ORDER BY m.updated_at, m.id
+LIMIT $8
+`
+
+type GetEditedMessagesParams struct {
+	UserID          *uuid.UUID       `json:"user_id"`
+	DeviceID        string           `json:"device_id"`
+	ChangedAfter    pgtype.Timestamp `json:"changed_after"`
+	ChangedAfterID  uuid.UUID        `json:"changed_after_id"`
+	GroupID         *uuid.UUID       `json:"group_id"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursor_created_at"`
+	CursorID        uuid.UUID        `json:"cursor_id"`
+	MaxChanges      int32            `json:"max_changes"`
+}
+
+type GetEditedMessagesRow struct {
+	ID             uuid.UUID        `json:"id"`
+	GroupID        *uuid.UUID       `json:"group_id"`
+	SenderID       *uuid.UUID       `json:"sender_id"`
+	Timestamp      pgtype.Timestamp `json:"timestamp"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	DeletedAt      pgtype.Timestamp `json:"deleted_at"`
+	Ciphertext     []byte           `json:"ciphertext"`
+	MessageType    MessageType      `json:"message_type"`
+	MsgNonce       []byte           `json:"msg_nonce"`
+	SenderKeyID    *uuid.UUID       `json:"sender_key_id"`
+	SenderDeviceID pgtype.Text      `json:"sender_device_id"`
+	MlsEpoch       pgtype.Int8      `json:"mls_epoch"`
+	EphPubKey      []byte           `json:"eph_pub_key"`
+	KeyNonce       []byte           `json:"key_nonce"`
+	SealedKey      []byte           `json:"sealed_key"`
+}
+
+// Messages up to the sync cursor that were edited after the changes
+// watermark, in (updated_at, id) order, so incremental syncs also pick up new
+// versions of messages they delivered earlier.
+func (q *Queries) GetEditedMessages(ctx context.Context, arg GetEditedMessagesParams) ([]GetEditedMessagesRow, error) {
+	rows, err := q.db.Query(ctx, getEditedMessages,
+		arg.UserID,
+		arg.DeviceID,
+		arg.ChangedAfter,
+		arg.ChangedAfterID,
+		arg.GroupID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.MaxChanges,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetEditedMessagesRow
+	for rows.Next() {
+		var i GetEditedMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.GroupID,
+			&i.SenderID,
+			&i.Timestamp,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Ciphertext,
+			&i.MessageType,
+			&i.MsgNonce,
+			&i.SenderKeyID,
+			&i.SenderDeviceID,
+			&i.MlsEpoch,
+			&i.EphPubKey,
+			&i.KeyNonce,
+			&i.SealedKey,
 		); err != nil {
 			return nil, err
 		}
@@ -107,22 +197,20 @@ SELECT
     updated_at,
     ciphertext,
     message_type,
-    msg_nonce,
-    key_envelopes
+    msg_nonce
 FROM messages
 WHERE id = $1
 `
 
 type GetMessageByIdRow struct {
-	ID           uuid.UUID        `json:"id"`
-	UserID       *uuid.UUID       `json:"user_id"`
-	GroupID      *uuid.UUID       `json:"group_id"`
-	CreatedAt    pgtype.Timestamp `json:"created_at"`
-	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
-	Ciphertext   []byte           `json:"ciphertext"`
-	MessageType  MessageType      `json:"message_type"`
-	MsgNonce     []byte           `json:"msg_nonce"`
-	KeyEnvelopes []byte           `json:"key_envelopes"`
+	ID          uuid.UUID        `json:"id"`
+	UserID      *uuid.UUID       `json:"user_id"`
+	GroupID     *uuid.UUID       `json:"group_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	Ciphertext  []byte           `json:"ciphertext"`
+	MessageType MessageType      `json:"message_type"`
+	MsgNonce    []byte           `json:"msg_nonce"`
 }
 
 func (q *Queries) GetMessageById(ctx context.Context, id uuid.UUID) (GetMessageByIdRow, error) {
@@ -137,61 +225,276 @@ func (q *Queries) GetMessageById(ctx context.Context, id uuid.UUID) (GetMessageB
 		&i.Ciphertext,
 		&i.MessageType,
 		&i.MsgNonce,
-		&i.KeyEnvelopes,
 	)
 	return i, err
 }
 
-const getMessagesForGroup = `-- name: GetMessagesForGroup :many
+const getMessageTombstones = `-- name: GetMessageTombstones :many
+SELECT
+    m.id,
+    m.group_id,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
+    m.message_type,
+    m.deleted_at
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = $1
+WHERE (m.deleted_at, m.id) > ($2::timestamp, $3::uuid)
+AND m.created_at > ug.created_at
+AND ($4::uuid IS NULL OR m.group_id = $4::uuid)
+AND (m.created_at, m.id) <= ($5::timestamp, $6::uuid)
+ORDER BY m.deleted_at, m.id
+LIMIT $7
+`
+
+type GetMessageTombstonesParams struct {
+	UserID          *uuid.UUID       `json:"user_id"`
+	ChangedAfter    pgtype.Timestamp `json:"changed_after"`
+	ChangedAfterID  uuid.UUID        `json:"changed_after_id"`
+	GroupID         *uuid.UUID       `json:"group_id"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursor_created_at"`
+	CursorID        uuid.UUID        `json:"cursor_id"`
+	MaxChanges      int32            `json:"max_changes"`
+}
+
+type GetMessageTombstonesRow struct {
+	ID          uuid.UUID        `json:"id"`
+	GroupID     *uuid.UUID       `json:"group_id"`
+	SenderID    *uuid.UUID       `json:"sender_id"`
+	Timestamp   pgtype.Timestamp `json:"timestamp"`
+	MessageType MessageType      `json:"message_type"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+}
+
+// Messages up to the sync cursor that were deleted after the changes
+// watermark, in (deleted_at, id) order, so incremental syncs also purge
+// messages they delivered earlier.
+func (q *Queries) GetMessageTombstones(ctx context.Context, arg GetMessageTombstonesParams) ([]GetMessageTombstonesRow, error) {
+	rows, err := q.db.Query(ctx, getMessageTombstones,
+		arg.UserID,
+		arg.ChangedAfter,
+		arg.ChangedAfterID,
+		arg.GroupID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.MaxChanges,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessageTombstonesRow
+	for rows.Next() {
+		var i GetMessageTombstonesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.GroupID,
+			&i.SenderID,
+			&i.Timestamp,
+			&i.MessageType,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesForGroupAfter = `-- name: GetMessagesForGroupAfter :many
 SELECT
     m.id,
-    m.user_id,
-    u.username,
     m.group_id,
-    m.created_at,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
     m.updated_at,
+    m.deleted_at,
     m.ciphertext,
     m.message_type,
     m.msg_nonce,
-    m.key_envelopes
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
 FROM messages m
-JOIN users u ON m.user_id = u.id
-WHERE m.group_id = $1
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = $1
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = $2 AND me.user_id = $1
+WHERE m.group_id = $3
+AND m.created_at > ug.created_at
+AND (m.created_at, m.id) > ($4::timestamp, $5::uuid)
+ORDER BY m.created_at, m.id
+LIMIT $6
 `
 
-type GetMessagesForGroupRow struct {
-	ID           uuid.UUID        `json:"id"`
-	UserID       *uuid.UUID       `json:"user_id"`
-	Username     string           `json:"username"`
-	GroupID      *uuid.UUID       `json:"group_id"`
-	CreatedAt    pgtype.Timestamp `json:"created_at"`
-	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
-	Ciphertext   []byte           `json:"ciphertext"`
-	MessageType  MessageType      `json:"message_type"`
-	MsgNonce     []byte           `json:"msg_nonce"`
-	KeyEnvelopes []byte           `json:"key_envelopes"`
+type GetMessagesForGroupAfterParams struct {
+	UserID         *uuid.UUID       `json:"user_id"`
+	DeviceID       string           `json:"device_id"`
+	GroupID        *uuid.UUID       `json:"group_id"`
+	AfterCreatedAt pgtype.Timestamp `json:"after_created_at"`
+	AfterID        uuid.UUID        `json:"after_id"`
+	MaxMessages    int32            `json:"max_messages"`
+}
+
+type GetMessagesForGroupAfterRow struct {
+	ID             uuid.UUID        `json:"id"`
+	GroupID        *uuid.UUID       `json:"group_id"`
+	SenderID       *uuid.UUID       `json:"sender_id"`
+	Timestamp      pgtype.Timestamp `json:"timestamp"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	DeletedAt      pgtype.Timestamp `json:"deleted_at"`
+	Ciphertext     []byte           `json:"ciphertext"`
+	MessageType    MessageType      `json:"message_type"`
+	MsgNonce       []byte           `json:"msg_nonce"`
+	SenderKeyID    *uuid.UUID       `json:"sender_key_id"`
+	SenderDeviceID pgtype.Text      `json:"sender_device_id"`
+	MlsEpoch       pgtype.Int8      `json:"mls_epoch"`
+	EphPubKey      []byte           `json:"eph_pub_key"`
+	KeyNonce       []byte           `json:"key_nonce"`
+	SealedKey      []byte           `json:"sealed_key"`
 }
 
-func (q *Queries) GetMessagesForGroup(ctx context.Context, groupID *uuid.UUID) ([]GetMessagesForGroupRow, error) {
-	rows, err := q.db.Query(ctx, getMessagesForGroup, groupID)
+// Pages forwards through a group's history from the cursor. Members only see
+// messages sent after they joined.
+func (q *Queries) GetMessagesForGroupAfter(ctx context.Context, arg GetMessagesForGroupAfterParams) ([]GetMessagesForGroupAfterRow, error) {
+	rows, err := q.db.Query(ctx, getMessagesForGroupAfter,
+		arg.UserID,
+		arg.DeviceID,
+		arg.GroupID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxMessages,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetMessagesForGroupRow
+	var items []GetMessagesForGroupAfterRow
 	for rows.Next() {
-		var i GetMessagesForGroupRow
+		var i GetMessagesForGroupAfterRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.UserID,
-			&i.Username,
 			&i.GroupID,
-			&i.CreatedAt,
+			&i.SenderID,
+			&i.Timestamp,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 			&i.Ciphertext,
 			&i.MessageType,
 			&i.MsgNonce,
-			&i.KeyEnvelopes,
+			&i.SenderKeyID,
+			&i.SenderDeviceID,
+			&i.MlsEpoch,
+			&i.EphPubKey,
+			&i.KeyNonce,
+			&i.SealedKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesForGroupBefore = `-- name: GetMessagesForGroupBefore :many
+SELECT
+    m.id,
+    m.group_id,
+    m.user_id AS sender_id,
+    m.created_at AS "timestamp",
+    m.updated_at,
+    m.deleted_at,
+    m.ciphertext,
+    m.message_type,
+    m.msg_nonce,
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id AND ug.user_id = $1
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = $2 AND me.user_id = $1
+WHERE m.group_id = $3
+AND m.created_at > ug.created_at
+AND (
+    $4::timestamp IS NULL
+    OR (m.created_at, m.id) < ($4::timestamp, $5::uuid)
+)
+ORDER BY m.created_at DESC, m.id DESC
+LIMIT $6
+`
+
+type GetMessagesForGroupBeforeParams struct {
+	UserID          *uuid.UUID       `json:"user_id"`
+	DeviceID        string           `json:"device_id"`
+	GroupID         *uuid.UUID       `json:"group_id"`
+	BeforeCreatedAt pgtype.Timestamp `json:"before_created_at"`
+	BeforeID        *uuid.UUID       `json:"before_id"`
+	MaxMessages     int32            `json:"max_messages"`
+}
+
+type GetMessagesForGroupBeforeRow struct {
+	ID             uuid.UUID        `json:"id"`
+	GroupID        *uuid.UUID       `json:"group_id"`
+	SenderID       *uuid.UUID       `json:"sender_id"`
+	Timestamp      pgtype.Timestamp `json:"timestamp"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	DeletedAt      pgtype.Timestamp `json:"deleted_at"`
+	Ciphertext     []byte           `json:"ciphertext"`
+	MessageType    MessageType      `json:"message_type"`
+	MsgNonce       []byte           `json:"msg_nonce"`
+	SenderKeyID    *uuid.UUID       `json:"sender_key_id"`
+	SenderDeviceID pgtype.Text      `json:"sender_device_id"`
+	MlsEpoch       pgtype.Int8      `json:"mls_epoch"`
+	EphPubKey      []byte           `json:"eph_pub_key"`
+	KeyNonce       []byte           `json:"key_nonce"`
+	SealedKey      []byte           `json:"sealed_key"`
+}
+
+// Pages backwards through a group's history from the cursor, or from the
+// newest message without one. Members only see messages sent after they
+// joined.
+func (q *Queries) GetMessagesForGroupBefore(ctx context.Context, arg GetMessagesForGroupBeforeParams) ([]GetMessagesForGroupBeforeRow, error) {
+	rows, err := q.db.Query(ctx, getMessagesForGroupBefore,
+		arg.UserID,
+		arg.DeviceID,
+		arg.GroupID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.MaxMessages,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessagesForGroupBeforeRow
+	for rows.Next() {
+		var i GetMessagesForGroupBeforeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.GroupID,
+			&i.SenderID,
+			&i.Timestamp,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Ciphertext,
+			&i.MessageType,
+			&i.MsgNonce,
+			&i.SenderKeyID,
+			&i.SenderDeviceID,
+			&i.MlsEpoch,
+			&i.EphPubKey,
+			&i.KeyNonce,
+			&i.SealedKey,
 		); err != nil {
 			return nil, err
 		}
@@ -209,32 +512,71 @@ SELECT
     m.group_id,
     m.user_id AS sender_id,
     m.created_at AS "timestamp",
+    m.updated_at,
+    m.deleted_at,
     m.ciphertext,
     m.message_type,
     m.msg_nonce,
-    m.key_envelopes
+    m.sender_key_id,
+    m.sender_device_id,
+    m.mls_epoch,
+    me.eph_pub_key,
+    me.key_nonce,
+    me.sealed_key
 FROM messages m
 JOIN user_groups ug ON ug.group_id = m.group_id
-JOIN users u_member ON ug.user_id = u_member.id 
-JOIN users u_sender ON m.user_id = u_sender.id
-JOIN groups g ON m.group_id = g.id
-WHERE u_member.id = $1
+JOIN users u_member ON ug.user_id = u_member.id
+LEFT JOIN message_envelopes me ON me.message_id = m.id AND me.device_id = $1 AND me.user_id = $2
+WHERE u_member.id = $2
 AND m.created_at > ug.created_at
+AND ($3::uuid IS NULL OR m.group_id = $3::uuid)
+AND (
+    $4::timestamp IS NULL
+    OR (m.created_at, m.id) > ($4::timestamp, $5::uuid)
+)
+ORDER BY m.created_at, m.id
+LIMIT $6
 `
 
+type GetRelevantMessagesParams struct {
+	DeviceID       string           `json:"device_id"`
+	UserID         uuid.UUID        `json:"user_id"`
+	GroupID        *uuid.UUID       `json:"group_id"`
+	AfterCreatedAt pgtype.Timestamp `json:"after_created_at"`
+	AfterID        *uuid.UUID       `json:"after_id"`
+	MaxMessages    int32            `json:"max_messages"`
+}
+
 type GetRelevantMessagesRow struct {
-	ID           uuid.UUID        `json:"id"`
-	GroupID      *uuid.UUID       `json:"group_id"`
-	SenderID     *uuid.UUID       `json:"sender_id"`
-	Timestamp    pgtype.Timestamp `json:"timestamp"`
-	Ciphertext   []byte           `json:"ciphertext"`
-	MessageType  MessageType      `json:"message_type"`
-	MsgNonce     []byte           `json:"msg_nonce"`
-	KeyEnvelopes []byte           `json:"key_envelopes"`
+	ID             uuid.UUID        `json:"id"`
+	GroupID        *uuid.UUID       `json:"group_id"`
+	SenderID       *uuid.UUID       `json:"sender_id"`
+	Timestamp      pgtype.Timestamp `json:"timestamp"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	DeletedAt      pgtype.Timestamp `json:"deleted_at"`
+	Ciphertext     []byte           `json:"ciphertext"`
+	MessageType    MessageType      `json:"message_type"`
+	MsgNonce       []byte           `json:"msg_nonce"`
+	SenderKeyID    *uuid.UUID       `json:"sender_key_id"`
+	SenderDeviceID pgtype.Text      `json:"sender_device_id"`
+	MlsEpoch       pgtype.Int8      `json:"mls_epoch"`
+	EphPubKey      []byte           `json:"eph_pub_key"`
+	KeyNonce       []byte           `json:"key_nonce"`
+	SealedKey      []byte           `json:"sealed_key"`
 }
 
-func (q *Queries) GetRelevantMessages(ctx context.Context, id uuid.UUID) ([]GetRelevantMessagesRow, error) {
-	rows, err := q.db.Query(ctx, getRelevantMessages, id)
+// Pages through the messages of the user's groups in (created_at, id) order,
+// starting after the cursor when one is given. Members only see messages sent
+// after they joined.
+func (q *Queries) GetRelevantMessages(ctx context.Context, arg GetRelevantMessagesParams) ([]GetRelevantMessagesRow, error) {
+	rows, err := q.db.Query(ctx, getRelevantMessages,
+		arg.DeviceID,
+		arg.UserID,
+		arg.GroupID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxMessages,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -247,10 +589,17 @@ func (q *Queries) GetRelevantMessages(ctx context.Context, id uuid.UUID) ([]GetR
 			&i.GroupID,
 			&i.SenderID,
 			&i.Timestamp,
+			&i.UpdatedAt,
+			&i.DeletedAt,
 			&i.Ciphertext,
 			&i.MessageType,
 			&i.MsgNonce,
-			&i.KeyEnvelopes,
+			&i.SenderKeyID,
+			&i.SenderDeviceID,
+			&i.MlsEpoch,
+			&i.EphPubKey,
+			&i.KeyNonce,
+			&i.SealedKey,
 		); err != nil {
 			return nil, err
 		}
@@ -270,32 +619,35 @@ INSERT INTO messages (
     ciphertext,
     message_type,
     msg_nonce,
-    key_envelopes
+    sender_key_id,
+    sender_device_id,
+    mls_epoch
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7
-) RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce, key_envelopes
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+) RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce
 `
 
 type InsertMessageParams struct {
-	ID           uuid.UUID   `json:"id"`
-	UserID       *uuid.UUID  `json:"user_id"`
-	GroupID      *uuid.UUID  `json:"group_id"`
-	Ciphertext   []byte      `json:"ciphertext"`
-	MessageType  MessageType `json:"message_type"`
-	MsgNonce     []byte      `json:"msg_nonce"`
-	KeyEnvelopes []byte      `json:"key_envelopes"`
+	ID             uuid.UUID   `json:"id"`
+	UserID         *uuid.UUID  `json:"user_id"`
+	GroupID        *uuid.UUID  `json:"group_id"`
+	Ciphertext     []byte      `json:"ciphertext"`
+	MessageType    MessageType `json:"message_type"`
+	MsgNonce       []byte      `json:"msg_nonce"`
+	SenderKeyID    *uuid.UUID  `json:"sender_key_id"`
+	SenderDeviceID pgtype.Text `json:"sender_device_id"`
+	MlsEpoch       pgtype.Int8 `json:"mls_epoch"`
 }
 
 type InsertMessageRow struct {
-	ID           uuid.UUID        `json:"id"`
-	UserID       *uuid.UUID       `json:"user_id"`
-	GroupID      *uuid.UUID       `json:"group_id"`
-	CreatedAt    pgtype.Timestamp `json:"created_at"`
-	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
-	Ciphertext   []byte           `json:"ciphertext"`
-	MessageType  MessageType      `json:"message_type"`
-	MsgNonce     []byte           `json:"msg_nonce"`
-	KeyEnvelopes []byte           `json:"key_envelopes"`
+	ID          uuid.UUID        `json:"id"`
+	UserID      *uuid.UUID       `json:"user_id"`
+	GroupID     *uuid.UUID       `json:"group_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	Ciphertext  []byte           `json:"ciphertext"`
+	MessageType MessageType      `json:"message_type"`
+	MsgNonce    []byte           `json:"msg_nonce"`
 }
 
 func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (InsertMessageRow, error) {
@@ -306,7 +658,9 @@ func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (I
 		arg.Ciphertext,
 		arg.MessageType,
 		arg.MsgNonce,
-		arg.KeyEnvelopes,
+		arg.SenderKeyID,
+		arg.SenderDeviceID,
+		arg.MlsEpoch,
 	)
 	var i InsertMessageRow
 	err := row.Scan(
@@ -318,7 +672,63 @@ func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (I
 		&i.Ciphertext,
 		&i.MessageType,
 		&i.MsgNonce,
-		&i.KeyEnvelopes,
 	)
 	return i, err
 }
+
+const insertMessageEnvelope = `-- name: InsertMessageEnvelope :exec
+INSERT INTO message_envelopes (
+    message_id,
+    user_id,
+    device_id,
+    eph_pub_key,
+    key_nonce,
+    sealed_key
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+`
+
+type InsertMessageEnvelopeParams struct {
+	MessageID uuid.UUID `json:"message_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	DeviceID  string    `json:"device_id"`
+	EphPubKey []byte    `json:"eph_pub_key"`
+	KeyNonce  []byte    `json:"key_nonce"`
+	SealedKey []byte    `json:"sealed_key"`
+}
+
+func (q *Queries) InsertMessageEnvelope(ctx context.Context, arg InsertMessageEnvelopeParams) error {
+	_, err := q.db.Exec(ctx, insertMessageEnvelope,
+		arg.MessageID,
+		arg.UserID,
+		arg.DeviceID,
+		arg.EphPubKey,
+		arg.KeyNonce,
+		arg.SealedKey,
+	)
+	return err
+}
+
+const tombstoneMessage = `-- name: TombstoneMessage :one
+UPDATE messages
+SET ciphertext = ''::bytea,
+    msg_nonce = ''::bytea,
+    sender_key_id = NULL,
+    sender_device_id = NULL,
+    mls_epoch = NULL,
+    updated_at = now(),
+    deleted_at = now()
+WHERE id = $1
+RETURNING deleted_at
+`
+
+// Deletes a message for everyone. The row stays as a tombstone that keeps its
+// id, group, sender and timestamp but no content; envelopes and earlier
+// versions are deleted separately.
+func (q *Queries) TombstoneMessage(ctx context.Context, id uuid.UUID) (pgtype.Timestamp, error) {
+	row := q.db.QueryRow(ctx, tombstoneMessage, id)
+	var deleted_at pgtype.Timestamp
+	err := row.Scan(&deleted_at)
+	return deleted_at, err
+}
@@ -64,6 +64,57 @@ type DeviceKey struct {
 	PublicKey  []byte           `json:"public_key"`
 	CreatedAt  pgtype.Timestamp `json:"created_at"`
 	LastSeenAt pgtype.Timestamp `json:"last_seen_at"`
+	// User-chosen label shown in device management
+	Name pgtype.Text `json:"name"`
+	// Ed25519 signature by the user's identity key over the device key; NULL for keys registered before signing was required
+	Signature []byte `json:"signature"`
+}
+
+// Unclaimed X3DH one-time prekeys; claiming one deletes it
+type DeviceOneTimePrekey struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	KeyID            int64     `json:"key_id"`
+	// Curve25519 public key bytes
+	PublicKey []byte           `json:"public_key"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+// Current X3DH signed prekey of each device; uploading a new one replaces it
+type DeviceSignedPrekey struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	// Client-chosen ID the initiator echoes back so the device knows which private key to use
+	KeyID int64 `json:"key_id"`
+	// Curve25519 public key bytes
+	PublicKey []byte `json:"public_key"`
+	// Ed25519 signature by the user's identity key over the signed prekey
+	Signature []byte           `json:"signature"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type EmailChangeRevertToken struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// Address the account had when the change was requested, restored by the token
+	OldEmail string `json:"old_email"`
+	// SHA-256 of the token emailed to the old address; the raw token is never stored
+	TokenHash []byte           `json:"token_hash"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type EmailVerificationToken struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// Address the token proves ownership of
+	Email string `json:"email"`
+	// SHA-256 of the emailed verification token; the raw token is never stored
+	TokenHash []byte           `json:"token_hash"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
 type Group struct {
@@ -77,6 +128,8 @@ type Group struct {
 	Location    pgtype.Text      `json:"location"`
 	ImageUrl    pgtype.Text      `json:"image_url"`
 	Blurhash    pgtype.Text      `json:"blurhash"`
+	// Whether new reactions in the group are encrypted payloads instead of plaintext emoji
+	EncryptedReactions bool `json:"encrypted_reactions"`
 }
 
 type GroupReservation struct {
@@ -85,6 +138,39 @@ type GroupReservation struct {
 	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
+type KeyTransparencyEntry struct {
+	ID        int64  `json:"id"`
+	Operation string `json:"operation"`
+	// Not a foreign key: entries outlive the account so its key deletions stay provable
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	PublicKey        []byte           `json:"public_key"`
+	Signature        []byte           `json:"signature"`
+	ChangedAt        pgtype.Timestamp `json:"changed_at"`
+	// Position in the Merkle log, assigned by the sequencer; NULL while pending
+	LeafIndex pgtype.Int8 `json:"leaf_index"`
+	// Exact bytes hashed into the log (JSON), so clients can recompute the leaf hash
+	LeafData []byte `json:"leaf_data"`
+	// RFC 6962 leaf hash: SHA-256(0x00 || leaf_data)
+	LeafHash []byte `json:"leaf_hash"`
+}
+
+type KeyTransparencySubtree struct {
+	// The subtree covers 2^level leaves from start_index; level 0 holds the leaf hashes
+	Level      int16  `json:"level"`
+	StartIndex int64  `json:"start_index"`
+	Hash       []byte `json:"hash"`
+}
+
+type KeyTransparencyTreeHead struct {
+	TreeSize    int64  `json:"tree_size"`
+	RootHash    []byte `json:"root_hash"`
+	TimestampMs int64  `json:"timestamp_ms"`
+	// Ed25519 signature by the log key over the tree size, timestamp and root hash
+	Signature []byte           `json:"signature"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
 type Message struct {
 	ID        uuid.UUID        `json:"id"`
 	UserID    *uuid.UUID       `json:"user_id"`
@@ -94,19 +180,221 @@ type Message struct {
 	// Encrypted message content (libsodium secretbox output)
 	Ciphertext []byte `json:"ciphertext"`
 	// Nonce used for symmetric encryption of the ciphertext
-	MsgNonce []byte `json:"msg_nonce"`
-	// JSON array of per-recipient sealed symmetric keys. Each element: {deviceId, ephPubKey, keyNonce, sealedKey}
-	KeyEnvelopes []byte      `json:"key_envelopes"`
-	MessageType  MessageType `json:"message_type"`
+	MsgNonce    []byte      `json:"msg_nonce"`
+	MessageType MessageType `json:"message_type"`
+	// Sender key the ciphertext is encrypted under; NULL for messages that carry per-device message_envelopes
+	SenderKeyID *uuid.UUID `json:"sender_key_id"`
+	// Device that sent a sender-key message
+	SenderDeviceID pgtype.Text `json:"sender_device_id"`
+	// Epoch of an MLS application message; NULL for messages in groups that do not use MLS
+	MlsEpoch pgtype.Int8 `json:"mls_epoch"`
+	// When the message was deleted for everyone; the row stays as a tombstone without ciphertext or envelopes
+	DeletedAt pgtype.Timestamp `json:"deleted_at"`
 }
 
-type User struct {
-	ID        uuid.UUID        `json:"id"`
-	Username  string           `json:"username"`
+// Previous versions of edited messages, copied from messages before each edit
+type MessageEdit struct {
+	ID             uuid.UUID   `json:"id"`
+	MessageID      uuid.UUID   `json:"message_id"`
+	Ciphertext     []byte      `json:"ciphertext"`
+	MsgNonce       []byte      `json:"msg_nonce"`
+	SenderKeyID    *uuid.UUID  `json:"sender_key_id"`
+	SenderDeviceID pgtype.Text `json:"sender_device_id"`
+	MlsEpoch       pgtype.Int8 `json:"mls_epoch"`
+	// When this version was written: the message's created_at or the time of the edit that produced it
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	// When the next edit replaced this version
+	ReplacedAt pgtype.Timestamp `json:"replaced_at"`
+}
+
+// Envelopes of a previous message version, moved out of message_envelopes by the edit
+type MessageEditEnvelope struct {
+	EditID    uuid.UUID `json:"edit_id"`
+	DeviceID  string    `json:"device_id"`
+	EphPubKey []byte    `json:"eph_pub_key"`
+	KeyNonce  []byte    `json:"key_nonce"`
+	SealedKey []byte    `json:"sealed_key"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+// Message key sealed to one recipient device; each device only syncs its own
+type MessageEnvelope struct {
+	MessageID uuid.UUID `json:"message_id"`
+	DeviceID  string    `json:"device_id"`
+	EphPubKey []byte    `json:"eph_pub_key"`
+	KeyNonce  []byte    `json:"key_nonce"`
+	// Message key boxed to the device key with the sender's ephemeral key
+	SealedKey []byte `json:"sealed_key"`
+	// Recipient user; device_id is only unique per user
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// Reactions to messages, one row per (message, user, reaction)
+type MessageReaction struct {
+	MessageID uuid.UUID `json:"message_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	// The emoji, or the base64 encrypted reaction payload when encrypted
+	Reaction string `json:"reaction"`
+	// Whether the group used encrypted reactions when this reaction was added
+	Encrypted bool             `json:"encrypted"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type MfaChallenge struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// SHA-256 of the mfa pending token returned by login; the raw token is never stored
+	TokenHash        []byte `json:"token_hash"`
+	DeviceIdentifier string `json:"device_identifier"`
+	// Base64 device public key from the login request, registered once the second factor passes
+	PublicKey          string           `json:"public_key"`
+	FailedAttempts     int32            `json:"failed_attempts"`
+	ExpiresAt          pgtype.Timestamp `json:"expires_at"`
+	UsedAt             pgtype.Timestamp `json:"used_at"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	DeviceKeySignature string           `json:"device_key_signature"`
+	IdentityKey        pgtype.Text      `json:"identity_key"`
+	// Login asked to replace the account's identity key if the uploaded one does not match
+	ResetIdentityKey bool `json:"reset_identity_key"`
+}
+
+type MlsCommit struct {
+	GroupID uuid.UUID `json:"group_id"`
+	// Epoch the Commit was built on; applying it moves the group to epoch + 1
+	Epoch          int64     `json:"epoch"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	SenderDeviceID string    `json:"sender_device_id"`
+	// MLSMessage carrying the Commit, as sent by the committer
+	CommitMessage []byte           `json:"commit_message"`
+	CreatedAt     pgtype.Timestamp `json:"created_at"`
+}
+
+type MlsGroup struct {
+	GroupID uuid.UUID `json:"group_id"`
+	// Current MLS epoch; the next accepted Commit must be built on it
+	Epoch     int64            `json:"epoch"`
 	CreatedAt pgtype.Timestamp `json:"created_at"`
 	UpdatedAt pgtype.Timestamp `json:"updated_at"`
-	Email     string           `json:"email"`
-	Password  pgtype.Text      `json:"password"`
+}
+
+// Unclaimed one-time MLS KeyPackages; claiming one deletes it
+type MlsKeyPackage struct {
+	ID               uuid.UUID        `json:"id"`
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	KeyPackage       []byte           `json:"key_package"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+}
+
+type MlsWelcome struct {
+	ID      uuid.UUID `json:"id"`
+	GroupID uuid.UUID `json:"group_id"`
+	// Epoch the new member joins at
+	Epoch             int64            `json:"epoch"`
+	RecipientUserID   uuid.UUID        `json:"recipient_user_id"`
+	RecipientDeviceID string           `json:"recipient_device_id"`
+	WelcomeMessage    []byte           `json:"welcome_message"`
+	CreatedAt         pgtype.Timestamp `json:"created_at"`
+}
+
+type OidcLoginState struct {
+	ID uuid.UUID `json:"id"`
+	// SHA-256 of the OAuth state parameter; the raw state is never stored
+	StateHash []byte `json:"state_hash"`
+	Nonce     string `json:"nonce"`
+	// PKCE verifier sent with the code exchange
+	CodeVerifier     string      `json:"code_verifier"`
+	DeviceIdentifier pgtype.Text `json:"device_identifier"`
+	PublicKey        pgtype.Text `json:"public_key"`
+	// Set when a signed-in user is linking an identity instead of logging in
+	LinkUserID         *uuid.UUID       `json:"link_user_id"`
+	ExpiresAt          pgtype.Timestamp `json:"expires_at"`
+	UsedAt             pgtype.Timestamp `json:"used_at"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	DeviceKeySignature pgtype.Text      `json:"device_key_signature"`
+	IdentityKey        pgtype.Text      `json:"identity_key"`
+	// Session family that started a link; only that session may complete it
+	LinkSessionID *uuid.UUID `json:"link_session_id"`
+}
+
+type PasswordResetToken struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// SHA-256 of the emailed reset token; the raw token is never stored
+	TokenHash []byte           `json:"token_hash"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type PersonalAccessToken struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	// SHA-256 of the token; the raw token is only shown once at creation
+	TokenHash []byte `json:"token_hash"`
+	// First characters of the token so users can tell their tokens apart
+	TokenPrefix string           `json:"token_prefix"`
+	Scopes      []string         `json:"scopes"`
+	ExpiresAt   pgtype.Timestamp `json:"expires_at"`
+	LastUsedAt  pgtype.Timestamp `json:"last_used_at"`
+	RevokedAt   pgtype.Timestamp `json:"revoked_at"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+}
+
+// Sender-key chains, one per sending device and group until the sender rotates it; the key material itself only ever leaves the device sealed to each recipient device
+type SenderKey struct {
+	ID             uuid.UUID        `json:"id"`
+	GroupID        uuid.UUID        `json:"group_id"`
+	SenderID       uuid.UUID        `json:"sender_id"`
+	SenderDeviceID string           `json:"sender_device_id"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+}
+
+// A sender key distribution message sealed to one recipient device. Rows outlive the recipient's membership and device so the server knows who has seen a key and can demand a rotation
+type SenderKeyDistribution struct {
+	KeyID             uuid.UUID `json:"key_id"`
+	RecipientUserID   uuid.UUID `json:"recipient_user_id"`
+	RecipientDeviceID string    `json:"recipient_device_id"`
+	EphPubKey         []byte    `json:"eph_pub_key"`
+	KeyNonce          []byte    `json:"key_nonce"`
+	// Distribution message (chain key and signing key) boxed to the recipient device key with the sender's ephemeral key, like a message envelope
+	SealedKey []byte           `json:"sealed_key"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type Session struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// Shared by every refresh token rotated from the same login
+	FamilyID uuid.UUID `json:"family_id"`
+	// SHA-256 of the opaque refresh token; the raw token is never stored
+	RefreshTokenHash []byte           `json:"refresh_token_hash"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	ExpiresAt        pgtype.Timestamp `json:"expires_at"`
+	// Set when the refresh token is exchanged; presenting it again revokes the family
+	RotatedAt pgtype.Timestamp `json:"rotated_at"`
+	RevokedAt pgtype.Timestamp `json:"revoked_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type TotpRecoveryCode struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// SHA-256 of the normalized recovery code; the raw code is never stored
+	CodeHash  []byte           `json:"code_hash"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type User struct {
+	ID              uuid.UUID        `json:"id"`
+	Username        string           `json:"username"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+	UpdatedAt       pgtype.Timestamp `json:"updated_at"`
+	Email           string           `json:"email"`
+	Password        pgtype.Text      `json:"password"`
+	EmailVerifiedAt pgtype.Timestamp `json:"email_verified_at"`
 }
 
 type UserGroup struct {
@@ -117,3 +405,62 @@ type UserGroup struct {
 	UpdatedAt pgtype.Timestamp `json:"updated_at"`
 	Admin     bool             `json:"admin"`
 }
+
+type UserIdentity struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// OpenID Connect issuer URL (iss claim)
+	Issuer string `json:"issuer"`
+	// Stable user identifier at the issuer (sub claim)
+	Subject string `json:"subject"`
+	// Email the provider reported when the identity was last used; informational only
+	Email       pgtype.Text      `json:"email"`
+	LastLoginAt pgtype.Timestamp `json:"last_login_at"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+}
+
+type UserIdentityKey struct {
+	UserID uuid.UUID `json:"user_id"`
+	// Long-term Ed25519 public key that signs the user's device keys
+	PublicKey []byte           `json:"public_key"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+type UserTotp struct {
+	UserID uuid.UUID `json:"user_id"`
+	// Base32 RFC 6238 shared secret
+	Secret string `json:"secret"`
+	// NULL while enrollment is pending confirmation with a first code
+	EnabledAt pgtype.Timestamp `json:"enabled_at"`
+	// Most recent accepted time step; codes at or before it are rejected as replays
+	LastUsedStep int64            `json:"last_used_step"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+}
+
+type WebauthnChallenge struct {
+	ID uuid.UUID `json:"id"`
+	// SHA-256 of the base64url challenge; the raw challenge is never stored
+	ChallengeHash []byte `json:"challenge_hash"`
+	Ceremony      string `json:"ceremony"`
+	// Account registering a passkey; NULL for discoverable-credential logins
+	UserID    *uuid.UUID       `json:"user_id"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type WebauthnCredential struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// Raw credential ID chosen by the authenticator
+	CredentialID []byte `json:"credential_id"`
+	// COSE_Key encoded credential public key
+	PublicKey []byte `json:"public_key"`
+	// Last signature counter seen; a counter that does not increase suggests a cloned authenticator
+	SignCount  int64            `json:"sign_count"`
+	Transports []string         `json:"transports"`
+	Name       pgtype.Text      `json:"name"`
+	LastUsedAt pgtype.Timestamp `json:"last_used_at"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+}
@@ -288,3 +288,23 @@ func (q *Queries) UpdateUserGroup(ctx context.Context, arg UpdateUserGroupParams
 	)
 	return i, err
 }
+
+const usersShareGroup = `-- name: UsersShareGroup :one
+SELECT EXISTS (
+    SELECT 1 FROM user_groups a
+    JOIN user_groups b ON a.group_id = b.group_id
+    WHERE a.user_id = $1 AND b.user_id = $2
+)
+`
+
+type UsersShareGroupParams struct {
+	UserID      *uuid.UUID `json:"user_id"`
+	OtherUserID *uuid.UUID `json:"other_user_id"`
+}
+
+func (q *Queries) UsersShareGroup(ctx context.Context, arg UsersShareGroupParams) (bool, error) {
+	row := q.db.QueryRow(ctx, usersShareGroup, arg.UserID, arg.OtherUserID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
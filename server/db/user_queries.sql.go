@@ -12,6 +12,43 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const changeUserEmail = `-- name: ChangeUserEmail :one
+UPDATE users
+SET
+    "email" = $2,
+    "email_verified_at" = now(),
+    "updated_at" = now()
+WHERE id = $1
+RETURNING "id", "username", "email", "created_at", "updated_at"
+`
+
+type ChangeUserEmailParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+type ChangeUserEmailRow struct {
+	ID        uuid.UUID        `json:"id"`
+	Username  string           `json:"username"`
+	Email     string           `json:"email"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+// Moves the account to an address its owner has just proven they control.
+func (q *Queries) ChangeUserEmail(ctx context.Context, arg ChangeUserEmailParams) (ChangeUserEmailRow, error) {
+	row := q.db.QueryRow(ctx, changeUserEmail, arg.ID, arg.Email)
+	var i ChangeUserEmailRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const deleteUser = `-- name: DeleteUser :one
 DELETE FROM users
 WHERE id = $1 RETURNING "id", "username", "email", "created_at", "updated_at"
@@ -173,25 +210,30 @@ relevant_users AS (
 )
 SELECT
     ru.user_id,
+    coalesce(encode(uik.public_key, 'base64'), '')::text AS identity_key,
     jsonb_agg(
         jsonb_build_object(
             'device_identifier', dk.device_identifier,
-            'public_key', encode(dk.public_key, 'base64')
+            'public_key', encode(dk.public_key, 'base64'),
+            'signature', encode(dk.signature, 'base64')
         ) ORDER BY dk.created_at DESC
     ) AS device_keys
 FROM
     relevant_users ru
 JOIN
     device_keys dk ON ru.user_id = dk.user_id
+LEFT JOIN
+    user_identity_keys uik ON ru.user_id = uik.user_id
 GROUP BY
-    ru.user_id
+    ru.user_id, uik.public_key
 HAVING
     count(dk.id) > 0
 `
 
 type GetRelevantUserDeviceKeysRow struct {
-	UserID     *uuid.UUID `json:"user_id"`
-	DeviceKeys []byte     `json:"device_keys"`
+	UserID      *uuid.UUID `json:"user_id"`
+	IdentityKey string     `json:"identity_key"`
+	DeviceKeys  []byte     `json:"device_keys"`
 }
 
 func (q *Queries) GetRelevantUserDeviceKeys(ctx context.Context, userID *uuid.UUID) ([]GetRelevantUserDeviceKeysRow, error) {
@@ -203,7 +245,7 @@ func (q *Queries) GetRelevantUserDeviceKeys(ctx context.Context, userID *uuid.UU
 	var items []GetRelevantUserDeviceKeysRow
 	for rows.Next() {
 		var i GetRelevantUserDeviceKeysRow
-		if err := rows.Scan(&i.UserID, &i.DeviceKeys); err != nil {
+		if err := rows.Scan(&i.UserID, &i.IdentityKey, &i.DeviceKeys); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -389,8 +431,19 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (GetUs
 	return i, err
 }
 
+const getUserEmailVerifiedAt = `-- name: GetUserEmailVerifiedAt :one
+SELECT "email_verified_at" FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserEmailVerifiedAt(ctx context.Context, id uuid.UUID) (pgtype.Timestamp, error) {
+	row := q.db.QueryRow(ctx, getUserEmailVerifiedAt, id)
+	var email_verified_at pgtype.Timestamp
+	err := row.Scan(&email_verified_at)
+	return email_verified_at, err
+}
+
 const getUsersByEmails = `-- name: GetUsersByEmails :many
-SELECT id, username, email, created_at, updated_at FROM users WHERE email = ANY($1::text[])
+SELECT id, username, email, created_at, updated_at FROM users WHERE email = ANY($1::text[]) AND email_verified_at IS NOT NULL
 `
 
 type GetUsersByEmailsRow struct {
@@ -401,6 +454,7 @@ type GetUsersByEmailsRow struct {
 	UpdatedAt pgtype.Timestamp `json:"updated_at"`
 }
 
+// Only verified addresses can be matched, so nobody can claim someone else's invites.
 func (q *Queries) GetUsersByEmails(ctx context.Context, emails []string) ([]GetUsersByEmailsRow, error) {
 	rows, err := q.db.Query(ctx, getUsersByEmails, emails)
 	if err != nil {
@@ -496,6 +550,27 @@ func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (InsertU
 	return i, err
 }
 
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :execrows
+UPDATE users
+SET
+    "email_verified_at" = now(),
+    "updated_at" = now()
+WHERE id = $1 AND LOWER(email) = LOWER($2)
+`
+
+type MarkUserEmailVerifiedParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, arg MarkUserEmailVerifiedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, markUserEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users 
 SET
@@ -531,3 +606,21 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    "password" = $2,
+    "updated_at" = now()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID       uuid.UUID   `json:"id"`
+	Password pgtype.Text `json:"password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.Password)
+	return err
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) Mailer {
+	return &smtpMailer{cfg: cfg}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := m.cfg.Host + ":" + m.cfg.Port
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{msg.To}, formatMessage(m.cfg.From, msg))
+}
+
+// fileMailer writes each message to its own file instead of delivering it.
+// It is meant for local development and tests.
+type fileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) Mailer {
+	return &fileMailer{dir: dir}
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, formatMessage("no-reply@localhost", msg), 0o600); err != nil {
+		return err
+	}
+	log.Printf("Mailer: wrote %q for %s to %s", msg.Subject, msg.To, path)
+	return nil
+}
+
+// NewFromEnv uses SMTP when MAILER=smtp and falls back to writing messages
+// under MAIL_DIR otherwise.
+func NewFromEnv() Mailer {
+	if os.Getenv("MAILER") == "smtp" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		})
+	}
+
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "chat-app-mail")
+	}
+	log.Printf("Mailer: SMTP not configured, writing outgoing mail to %s", dir)
+	return NewFileMailer(dir)
+}
+
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
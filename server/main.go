@@ -4,9 +4,11 @@ import (
 	"chat-app-server/auth"
 	"chat-app-server/db"
 	"chat-app-server/images"
+	"chat-app-server/mailer"
 	"chat-app-server/router"
 	"chat-app-server/s3store"
 	"chat-app-server/server"
+	"chat-app-server/transparency"
 	"chat-app-server/ws"
 	"context"
 	"fmt"
@@ -50,6 +52,10 @@ func main() {
 
 	InitializeRedis(ctx)
 
+	if err := auth.InitKeysFromEnv(); err != nil {
+		log.Fatalf("Could not load JWT keys: %v", err)
+	}
+
 	connPool, err := pgxpool.New(ctx, os.Getenv("DB_URL"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
@@ -57,12 +63,28 @@ func main() {
 	}
 	db := db.New(connPool)
 
-	authHandler := auth.NewAuthHandler(db, ctx, connPool)
+	revocations := auth.NewRevocationStore(RedisClient)
+	mail := mailer.NewFromEnv()
+	limiter := auth.NewRateLimiter(RedisClient)
+	oidcProvider, err := auth.NewOIDCProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Could not configure OIDC sign-in: %v", err)
+	}
+	authHandler := auth.NewAuthHandler(db, ctx, connPool, revocations, mail, limiter, oidcProvider, auth.NewWebAuthnConfigFromEnv())
 	hub := ws.NewHub(db, ctx, connPool, RedisClient, ServerInstanceID)
-	wsHandler := ws.NewHandler(hub, db, ctx, connPool)
+	revocations.SetDisconnectFunc(hub.DisconnectRevokedClient)
+	authHandler.SetDeviceKeysChangedFunc(hub.PublishDeviceKeysChanged)
+	wsHandler := ws.NewHandler(hub, db, ctx, connPool, revocations)
 	go hub.Run()
 
-	api := server.NewAPI(db, ctx, connPool)
+	api := server.NewAPI(db, ctx, connPool, hub, revocations)
+
+	ktSigningKey, err := transparency.LoadSigningKeyFromEnv()
+	if err != nil {
+		log.Fatalf("Could not load key transparency signing key: %v", err)
+	}
+	keyLog := transparency.NewLog(db, ctx, connPool, ktSigningKey)
+	go keyLog.Run()
 
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
@@ -75,7 +97,7 @@ func main() {
 
 	defer connPool.Close()
 
-	router.InitRouter(authHandler, wsHandler, api, imageHandler)
+	router.InitRouter(authHandler, wsHandler, api, imageHandler, keyLog, revocations)
 	router.Start(":8080")
 
 }
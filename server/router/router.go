@@ -4,6 +4,7 @@ import (
 	"chat-app-server/auth"
 	"chat-app-server/images"
 	"chat-app-server/server"
+	"chat-app-server/transparency"
 	"chat-app-server/ws"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 
 var r *gin.Engine
 
-func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *server.API, imageHandler *images.ImageHandler) {
+func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *server.API, imageHandler *images.ImageHandler, keyLog *transparency.Log, revocations *auth.RevocationStore) {
 	r = gin.Default()
 
 	r.Use(cors.New(cors.Config{
@@ -28,42 +29,108 @@ func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *serve
 		MaxAge: 12 * time.Hour,
 	}))
 
-	// general API
+	r.GET("/.well-known/jwks.json", auth.JWKS)
+	r.GET("/.well-known/key-transparency.json", keyLog.PublicKey)
+
+	// general API, login sessions only
 	apiRoutes := r.Group("/api/")
-	apiRoutes.Use(auth.JWTAuthMiddleware())
+	apiRoutes.Use(auth.JWTAuthMiddleware(revocations))
+
+	apiRoutes.DELETE("/users/me", api.DeleteAccount)
+	apiRoutes.GET("/users/devices", api.GetMyDevices)
+	apiRoutes.PUT("/users/devices/:deviceIdentifier", api.RenameDevice)
+	apiRoutes.DELETE("/users/devices/:deviceIdentifier", api.RevokeDevice)
+	apiRoutes.POST("/users/devices/revoke-others", api.RevokeOtherDevices)
+	apiRoutes.PUT("/users/identity-key", api.ResetIdentityKey)
+
+	// general API, also open to personal access tokens with the group's scope
+	apiUsersRead := r.Group("/api/", authHandler.TokenAuthMiddleware(auth.ScopeUsersRead))
+	apiUsersRead.GET("/users/whoami", api.WhoAmI)
+	apiUsersRead.GET("/users/device-keys", api.GetRelevantDeviceKeys)
+	apiUsersRead.GET("/transparency/tree-head", keyLog.GetTreeHead)
+	apiUsersRead.GET("/transparency/consistency", keyLog.GetConsistencyProof)
+	apiUsersRead.GET("/transparency/leaf-hashes", keyLog.GetLeafHashes)
+	apiUsersRead.GET("/transparency/users/:userID/inclusion", keyLog.GetInclusionProofs)
 
-	apiRoutes.GET("/users/whoami", api.WhoAmI)
-	apiRoutes.GET("/users/device-keys", api.GetRelevantDeviceKeys)
-	
-	apiRoutes.POST("/groups/reserve/:groupID", api.ReserveGroup)
+	apiGroupsWrite := r.Group("/api/", authHandler.TokenAuthMiddleware(auth.ScopeGroupsWrite))
+	apiGroupsWrite.POST("/groups/reserve/:groupID", api.ReserveGroup)
 
 	// auth routes group
 	authRoutes := r.Group("/auth/")
 	authRoutes.POST("/signup", authHandler.Signup)
 	authRoutes.POST("/login", authHandler.Login)
+	authRoutes.POST("/login/mfa", authHandler.VerifyMFALogin)
+	authRoutes.POST("/refresh", authHandler.Refresh)
+	authRoutes.POST("/logout", auth.JWTAuthMiddleware(revocations), authHandler.Logout)
+	authRoutes.POST("/password-reset/request", authHandler.RequestPasswordReset)
+	authRoutes.POST("/password-reset/confirm", authHandler.ConfirmPasswordReset)
+	authRoutes.POST("/verify-email", authHandler.VerifyEmail)
+	authRoutes.POST("/verify-email/resend", auth.JWTAuthMiddleware(revocations), authHandler.ResendEmailVerification)
+	authRoutes.POST("/password/change", auth.JWTAuthMiddleware(revocations), authHandler.ChangePassword)
+	authRoutes.POST("/email/change", auth.JWTAuthMiddleware(revocations), authHandler.ChangeEmail)
+	authRoutes.POST("/email/revert", authHandler.RevertEmailChange)
+	authRoutes.POST("/2fa/setup", auth.JWTAuthMiddleware(revocations), authHandler.SetupTwoFactor)
+	authRoutes.POST("/2fa/enable", auth.JWTAuthMiddleware(revocations), authHandler.EnableTwoFactor)
+	authRoutes.POST("/2fa/disable", auth.JWTAuthMiddleware(revocations), authHandler.DisableTwoFactor)
+	authRoutes.POST("/2fa/recovery-codes", auth.JWTAuthMiddleware(revocations), authHandler.RegenerateRecoveryCodes)
+	authRoutes.GET("/oidc", authHandler.OIDCConfig)
+	authRoutes.POST("/oidc/start", authHandler.StartOIDCLogin)
+	authRoutes.POST("/oidc/callback", authHandler.CompleteOIDC)
+	authRoutes.POST("/oidc/link", auth.JWTAuthMiddleware(revocations), authHandler.StartOIDCLink)
+	authRoutes.GET("/oidc/identities", auth.JWTAuthMiddleware(revocations), authHandler.GetLinkedIdentities)
+	authRoutes.DELETE("/oidc/identities/:identityID", auth.JWTAuthMiddleware(revocations), authHandler.UnlinkIdentity)
+	authRoutes.POST("/passkeys/register/begin", auth.JWTAuthMiddleware(revocations), authHandler.BeginPasskeyRegistration)
+	authRoutes.POST("/passkeys/register/finish", auth.JWTAuthMiddleware(revocations), authHandler.FinishPasskeyRegistration)
+	authRoutes.POST("/passkeys/login/begin", authHandler.BeginPasskeyLogin)
+	authRoutes.POST("/passkeys/login/finish", authHandler.FinishPasskeyLogin)
+	authRoutes.GET("/passkeys", auth.JWTAuthMiddleware(revocations), authHandler.GetPasskeys)
+	authRoutes.DELETE("/passkeys/:passkeyID", auth.JWTAuthMiddleware(revocations), authHandler.DeletePasskey)
+	authRoutes.POST("/tokens", auth.JWTAuthMiddleware(revocations), authHandler.CreatePersonalAccessToken)
+	authRoutes.GET("/tokens", auth.JWTAuthMiddleware(revocations), authHandler.GetPersonalAccessTokens)
+	authRoutes.DELETE("/tokens/:tokenID", auth.JWTAuthMiddleware(revocations), authHandler.RevokePersonalAccessToken)
 
-	// WS routes
-	wsRoutes := r.Group("/ws/")
-	wsRoutes.Use(auth.JWTAuthMiddleware())
+	// WS routes, open to personal access tokens with the group's scope
+	wsGroupsRead := r.Group("/ws/", authHandler.TokenAuthMiddleware(auth.ScopeGroupsRead))
+	wsGroupsRead.GET("/get-groups", wsHandler.GetGroups)
+	wsGroupsRead.GET("/get-users-in-group/:groupID", wsHandler.GetUsersInGroup)
+	wsGroupsRead.GET("/relevant-users", wsHandler.GetRelevantUsers)
+	wsGroupsRead.GET("/mls/groups/:groupID", wsHandler.GetMLSGroupState)
 
-	wsRoutes.POST("/create-group", wsHandler.CreateGroup)
-	wsRoutes.PUT("/update-group/:groupID", wsHandler.UpdateGroup)
-	wsRoutes.POST("/invite-users-to-group", wsHandler.InviteUsersToGroup)
-	wsRoutes.POST("/remove-user-from-group", wsHandler.RemoveUserFromGroup)
-	wsRoutes.GET("/get-groups", wsHandler.GetGroups)
-	wsRoutes.GET("/get-users-in-group/:groupID", wsHandler.GetUsersInGroup)
-	wsRoutes.POST("/leave-group/:groupID", wsHandler.LeaveGroup)
-	wsRoutes.GET("/relevant-users", wsHandler.GetRelevantUsers)
-	wsRoutes.GET("/relevant-messages", wsHandler.GetRelevantMessages)
+	wsGroupsWrite := r.Group("/ws/", authHandler.TokenAuthMiddleware(auth.ScopeGroupsWrite))
+	wsGroupsWrite.POST("/create-group", wsHandler.CreateGroup)
+	wsGroupsWrite.PUT("/update-group/:groupID", wsHandler.UpdateGroup)
+	wsGroupsWrite.POST("/invite-users-to-group", wsHandler.InviteUsersToGroup)
+	wsGroupsWrite.POST("/remove-user-from-group", wsHandler.RemoveUserFromGroup)
+	wsGroupsWrite.POST("/leave-group/:groupID", wsHandler.LeaveGroup)
+	wsGroupsWrite.POST("/mls/groups/:groupID", wsHandler.EnableMLS)
+
+	wsMessagesRead := r.Group("/ws/", authHandler.TokenAuthMiddleware(auth.ScopeMessagesRead))
+	wsMessagesRead.GET("/relevant-messages", wsHandler.GetRelevantMessages)
+	wsMessagesRead.GET("/groups/:groupID/messages", wsHandler.GetGroupMessages)
+	wsMessagesRead.GET("/mls/groups/:groupID/commits", wsHandler.GetMLSCommits)
+
+	// Sender keys, MLS state and prekeys are bound to the device of a signed-in session
+	wsDevice := r.Group("/ws/", auth.JWTAuthMiddleware(revocations))
+	wsDevice.POST("/sender-keys", wsHandler.UploadSenderKey)
+	wsDevice.GET("/sender-keys", wsHandler.GetSenderKeyDistributions)
+	wsDevice.POST("/mls/groups/:groupID/commits", wsHandler.SubmitMLSCommit)
+	wsDevice.POST("/mls/key-packages", wsHandler.UploadMLSKeyPackages)
+	wsDevice.POST("/mls/key-packages/claim", wsHandler.ClaimMLSKeyPackages)
+	wsDevice.GET("/mls/welcomes", wsHandler.GetMLSWelcomes)
+	wsDevice.DELETE("/mls/welcomes/:welcomeID", wsHandler.DeleteMLSWelcome)
+	wsDevice.POST("/prekeys", wsHandler.UploadPrekeys)
+	wsDevice.GET("/prekeys", wsHandler.GetPrekeyStatus)
+	wsDevice.POST("/prekeys/claim", wsHandler.ClaimPrekeyBundles)
 
 	// authenticated after upgrade
 	r.GET("/ws/establish-connection", wsHandler.EstablishConnection)
 
 	// Image routes
-	imageRoutes := r.Group("/images")
-	imageRoutes.Use(auth.JWTAuthMiddleware())
-	imageRoutes.POST("/presign-upload", imageHandler.PresignUpload)
-	imageRoutes.POST("/presign-download", imageHandler.PresignDownload)
+	imagesWrite := r.Group("/images", authHandler.TokenAuthMiddleware(auth.ScopeImagesWrite))
+	imagesWrite.POST("/presign-upload", imageHandler.PresignUpload)
+
+	imagesRead := r.Group("/images", authHandler.TokenAuthMiddleware(auth.ScopeImagesRead))
+	imagesRead.POST("/presign-download", imageHandler.PresignDownload)
 }
 
 func Start(addr string) error {
@@ -1,22 +1,34 @@
 package server
 
 import (
+	"chat-app-server/auth"
 	"chat-app-server/db"
+	"chat-app-server/ws"
 	"context"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type API struct {
-	db   *db.Queries
-	ctx  context.Context
-	conn *pgxpool.Pool
+	db          *db.Queries
+	ctx         context.Context
+	conn        *pgxpool.Pool
+	hub         *ws.Hub
+	revocations *auth.RevocationStore
 }
 
-func NewAPI(db *db.Queries, ctx context.Context, conn *pgxpool.Pool) *API {
+func NewAPI(
+	db *db.Queries,
+	ctx context.Context,
+	conn *pgxpool.Pool,
+	hub *ws.Hub,
+	revocations *auth.RevocationStore,
+) *API {
 	return &API{
-		db:   db,
-		ctx:  ctx,
-		conn: conn,
+		db:          db,
+		ctx:         ctx,
+		conn:        conn,
+		hub:         hub,
+		revocations: revocations,
 	}
 }
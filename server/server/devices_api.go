@@ -0,0 +1,375 @@
+package server
+
+import (
+	"chat-app-server/auth"
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ClientDevice struct {
+	DeviceIdentifier string    `json:"device_identifier"`
+	Name             *string   `json:"name,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastSeenAt       time.Time `json:"last_seen_at"`
+	Current          bool      `json:"current"`
+}
+
+type RenameDeviceRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// ResetIdentityKeyRequest replaces the account's identity key. The current
+// device's key is re-signed with the new one; every other device is removed
+// because its signature no longer checks out.
+type ResetIdentityKeyRequest struct {
+	IdentityKey        string `json:"identity_key" binding:"required"`
+	DeviceKeySignature string `json:"device_key_signature" binding:"required"`
+	// Password is left out by accounts that don't have one.
+	Password string `json:"password"`
+	// Code is the current authenticator code, required when 2FA is on.
+	Code string `json:"code"`
+}
+
+func toClientDevice(key db.DeviceKey, currentDeviceIdentifier string) ClientDevice {
+	device := ClientDevice{
+		DeviceIdentifier: key.DeviceIdentifier,
+		CreatedAt:        key.CreatedAt.Time,
+		LastSeenAt:       key.LastSeenAt.Time,
+		Current:          key.DeviceIdentifier == currentDeviceIdentifier,
+	}
+	if key.Name.Valid {
+		device.Name = &key.Name.String
+	}
+	return device
+}
+
+// currentDeviceIdentifier resolves the device the request was made from via
+// the session family in the access token.
+func (api *API) currentDeviceIdentifier(c *gin.Context) (string, error) {
+	claims, err := auth.GetClaims(c)
+	if err != nil {
+		return "", err
+	}
+	familyID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return "", errors.New("token has no session")
+	}
+	return api.db.GetSessionFamilyDeviceIdentifier(c.Request.Context(), familyID)
+}
+
+// endDeviceSessions denylists the revoked sessions and tells group peers to
+// stop encrypting to the removed devices. Failures are logged; the database
+// change has already been committed.
+func (api *API) endDeviceSessions(c *gin.Context, userID uuid.UUID, familyIDs []uuid.UUID, removedDevices []string) {
+	ctx := c.Request.Context()
+	if err := api.revocations.RevokeSessions(ctx, userID, familyIDs); err != nil {
+		log.Printf("Error denylisting sessions of revoked devices for user %s: %v", userID, err)
+	}
+	if len(removedDevices) == 0 {
+		return
+	}
+	if err := api.hub.PublishDeviceKeysChanged(ctx, userID, removedDevices); err != nil {
+		log.Printf("Error publishing device key change for user %s: %v", userID, err)
+	}
+}
+
+func (api *API) GetMyDevices(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	currentDevice, err := api.currentDeviceIdentifier(c)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Could not resolve current device for user %s: %v", user.ID, err)
+	}
+
+	keys, err := api.db.GetDeviceKeysForUser(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error loading devices for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load devices"})
+		return
+	}
+
+	devices := make([]ClientDevice, 0, len(keys))
+	for _, key := range keys {
+		devices = append(devices, toClientDevice(key, currentDevice))
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+func (api *API) RenameDevice(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req RenameDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	key, err := api.db.RenameDeviceKey(c.Request.Context(), db.RenameDeviceKeyParams{
+		UserID:           user.ID,
+		DeviceIdentifier: c.Param("deviceIdentifier"),
+		Name:             pgtype.Text{String: req.Name, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		} else {
+			log.Printf("Error renaming device for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename device"})
+		}
+		return
+	}
+
+	currentDevice, _ := api.currentDeviceIdentifier(c)
+	c.JSON(http.StatusOK, toClientDevice(key, currentDevice))
+}
+
+// RevokeDevice removes one of the caller's devices: its key stops being an
+// E2EE recipient and its sessions end immediately.
+func (api *API) RevokeDevice(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	deviceIdentifier := c.Param("deviceIdentifier")
+
+	tx, err := api.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for device revocation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := api.db.WithTx(tx)
+
+	if _, err := qtx.GetDeviceKeyByIdentifier(ctx, db.GetDeviceKeyByIdentifierParams{
+		UserID:           user.ID,
+		DeviceIdentifier: deviceIdentifier,
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		} else {
+			log.Printf("Error loading device for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		}
+		return
+	}
+
+	if err := qtx.DeleteDeviceKey(ctx, db.DeleteDeviceKeyParams{
+		UserID:           user.ID,
+		DeviceIdentifier: deviceIdentifier,
+	}); err != nil {
+		log.Printf("Error deleting device key for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		return
+	}
+
+	familyIDs, err := qtx.RevokeSessionsForDevice(ctx, db.RevokeSessionsForDeviceParams{
+		UserID:           user.ID,
+		DeviceIdentifier: deviceIdentifier,
+	})
+	if err != nil {
+		log.Printf("Error revoking device sessions for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit device revocation for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		return
+	}
+
+	log.Printf("User %s revoked device %s", user.ID, deviceIdentifier)
+	api.endDeviceSessions(c, user.ID, familyIDs, []string{deviceIdentifier})
+	c.JSON(http.StatusOK, gin.H{"message": "Device revoked"})
+}
+
+// RevokeOtherDevices removes every device except the one making the request.
+func (api *API) RevokeOtherDevices(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	currentDevice, err := api.currentDeviceIdentifier(c)
+	if err != nil {
+		log.Printf("Could not resolve current device for user %s: %v", user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not determine the current device"})
+		return
+	}
+
+	tx, err := api.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for device revocation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke devices"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := api.db.WithTx(tx)
+
+	removed, err := qtx.DeleteOtherDeviceKeysForUser(ctx, db.DeleteOtherDeviceKeysForUserParams{
+		UserID:           user.ID,
+		DeviceIdentifier: currentDevice,
+	})
+	if err != nil {
+		log.Printf("Error deleting other device keys for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke devices"})
+		return
+	}
+
+	familyIDs, err := qtx.RevokeSessionsForOtherDevices(ctx, db.RevokeSessionsForOtherDevicesParams{
+		UserID:           user.ID,
+		DeviceIdentifier: currentDevice,
+	})
+	if err != nil {
+		log.Printf("Error revoking other device sessions for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke devices"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit device revocation for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke devices"})
+		return
+	}
+
+	if removed == nil {
+		removed = []string{}
+	}
+	log.Printf("User %s revoked %d other device(s)", user.ID, len(removed))
+	api.endDeviceSessions(c, user.ID, familyIDs, removed)
+	c.JSON(http.StatusOK, gin.H{"revoked_devices": removed})
+}
+
+// ResetIdentityKey is how a signed-in user who lost their identity private key
+// starts over; one who can't sign in any more resets it at login instead. It
+// takes the password and authenticator code since it removes every other
+// device. Peers see the new identity key and the removed devices through the
+// usual device key change notification.
+func (api *API) ResetIdentityKey(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req ResetIdentityKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	identityKey, err := auth.DecodeIdentityKey(req.IdentityKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	internalUser, err := api.db.GetUserByIdInternal(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading user %s for identity key reset: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset identity key"})
+		return
+	}
+	if !auth.ConfirmPassword(c, api.db, internalUser, req.Password) {
+		return
+	}
+	if !auth.ConfirmSecondFactor(c, api.db, api.conn, user.ID, req.Code) {
+		return
+	}
+
+	currentDevice, err := api.currentDeviceIdentifier(c)
+	if err != nil {
+		log.Printf("Could not resolve current device for user %s: %v", user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not determine the current device"})
+		return
+	}
+
+	tx, err := api.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for identity key reset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset identity key"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := api.db.WithTx(tx)
+
+	key, err := qtx.GetDeviceKeyByIdentifier(ctx, db.GetDeviceKeyByIdentifierParams{
+		UserID:           user.ID,
+		DeviceIdentifier: currentDevice,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The current device has no registered key"})
+		} else {
+			log.Printf("Error loading current device key for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset identity key"})
+		}
+		return
+	}
+
+	signature, err := auth.VerifyDeviceKeySignature(identityKey, key.DeviceIdentifier, key.PublicKey, req.DeviceKeySignature)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := qtx.UpdateDeviceKeySignature(ctx, db.UpdateDeviceKeySignatureParams{
+		UserID:           user.ID,
+		DeviceIdentifier: currentDevice,
+		Signature:        signature,
+	}); err != nil {
+		log.Printf("Error re-signing current device key for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset identity key"})
+		return
+	}
+
+	removed, familyIDs, err := auth.ReplaceIdentityKey(ctx, qtx, user.ID, identityKey, currentDevice)
+	if err != nil {
+		log.Printf("Error resetting identity key for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset identity key"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit identity key reset for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset identity key"})
+		return
+	}
+
+	log.Printf("User %s reset their identity key, removing %d other device(s)", user.ID, len(removed))
+	api.endDeviceSessions(c, user.ID, familyIDs, removed)
+	if len(removed) == 0 {
+		// Peers still have to refetch the new identity key.
+		if err := api.hub.PublishDeviceKeysChanged(ctx, user.ID, removed); err != nil {
+			log.Printf("Error publishing device key change for user %s: %v", user.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked_devices": removed})
+}
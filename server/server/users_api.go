@@ -1,7 +1,9 @@
 package server
 
 import (
+	"chat-app-server/auth"
 	"chat-app-server/util"
+	"chat-app-server/ws"
 	"encoding/json"
 	"errors"
 	"log"
@@ -12,13 +14,23 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+// ClientDeviceKeyInfo carries the identity key's signature over the device
+// key so clients can check it themselves; Signature is nil for keys registered
+// before signing was required.
 type ClientDeviceKeyInfo struct {
-	DeviceIdentifier string `json:"device_identifier"`
-	PublicKey        string `json:"public_key"`
+	DeviceIdentifier string  `json:"device_identifier"`
+	PublicKey        string  `json:"public_key"`
+	Signature        *string `json:"signature"`
 }
 type UserWithDeviceKeys struct {
-	UserID     uuid.UUID             `json:"user_id"`
-	DeviceKeys []ClientDeviceKeyInfo `json:"device_keys"`
+	UserID      uuid.UUID             `json:"user_id"`
+	IdentityKey string                `json:"identity_key,omitempty"`
+	DeviceKeys  []ClientDeviceKeyInfo `json:"device_keys"`
+}
+
+// DeleteAccountRequest leaves out Password when the account has none.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
 }
 
 func (api *API) WhoAmI(c *gin.Context) {
@@ -67,10 +79,123 @@ func (api *API) GetRelevantDeviceKeys(c *gin.Context) {
 		}
 
 		response = append(response, UserWithDeviceKeys{
-			UserID:     *row.UserID,
-			DeviceKeys: deviceKeyInfos,
+			UserID:      *row.UserID,
+			IdentityKey: row.IdentityKey,
+			DeviceKeys:  deviceKeyInfos,
 		})
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// DeleteAccount permanently deletes the caller's account after confirming
+// their password, or a recent login for accounts without one. The user leaves
+// every group exactly as LeaveGroup would, and their devices, reservations and
+// live connections go with the account.
+func (api *API) DeleteAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	internalUser, err := api.db.GetUserByIdInternal(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading user %s for account deletion: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	if !auth.ConfirmPassword(c, api.db, internalUser, req.Password) {
+		return
+	}
+
+	tx, err := api.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := api.db.WithTx(tx)
+
+	userGroups, err := qtx.GetAllUserGroupsForUser(ctx, &user.ID)
+	if err != nil {
+		log.Printf("Error loading groups for account deletion of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	deletedGroups := make(map[uuid.UUID]bool, len(userGroups))
+	for _, ug := range userGroups {
+		if ug.GroupID == nil {
+			continue
+		}
+		_, groupDeleted, err := ws.LeaveGroupTx(ctx, qtx, user.ID, *ug.GroupID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+		deletedGroups[*ug.GroupID] = groupDeleted
+	}
+
+	deviceKeys, err := qtx.GetDeviceKeysForUser(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading device keys for account deletion of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	removedDevices := make([]string, 0, len(deviceKeys))
+	for _, key := range deviceKeys {
+		removedDevices = append(removedDevices, key.DeviceIdentifier)
+	}
+
+	if err := qtx.DeleteAllDeviceKeysForUser(ctx, user.ID); err != nil {
+		log.Printf("Error deleting device keys of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := qtx.DeleteAllGroupReservationsForUser(ctx, user.ID); err != nil {
+		log.Printf("Error deleting group reservations of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if _, err := qtx.DeleteUser(ctx, user.ID); err != nil {
+		log.Printf("Error deleting user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit account deletion for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// Peers are told about the removed devices before the user's Redis group
+	// set, which the notification is addressed from, is cleared.
+	if err := api.hub.PublishDeviceKeysChanged(ctx, user.ID, removedDevices); err != nil {
+		log.Printf("Error publishing device key removal for deleted user %s: %v", user.ID, err)
+	}
+	for groupID, groupDeleted := range deletedGroups {
+		api.hub.NotifyUserLeftGroup(ctx, user.ID, groupID, groupDeleted)
+	}
+	if err := api.hub.ClearUserGroups(ctx, user.ID); err != nil {
+		log.Printf("Error clearing Redis groups for deleted user %s: %v", user.ID, err)
+	}
+	if err := api.revocations.RevokeUser(ctx, user.ID); err != nil {
+		log.Printf("Error revoking tokens for deleted user %s: %v", user.ID, err)
+	}
+
+	log.Printf("User %s deleted their account", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
@@ -0,0 +1,195 @@
+package transparency
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"chat-app-server/db"
+	"chat-app-server/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxLeafHashesPerPage = 10000
+
+type InclusionEntry struct {
+	LeafIndex uint64   `json:"leaf_index"`
+	LeafData  []byte   `json:"leaf_data"`
+	Proof     [][]byte `json:"proof"`
+}
+
+// PublicKey publishes the key tree heads are signed with. Auditors should pin
+// it rather than fetch it on every run.
+func (l *Log) PublicKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "Ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(l.signingKey.Public().(ed25519.PublicKey)),
+	})
+}
+
+// treeHeadFromQuery loads the tree head named by the tree_size query
+// parameter, or the latest one when it's absent. It responds itself on error.
+func (l *Log) treeHeadFromQuery(c *gin.Context, param string) (db.KeyTransparencyTreeHead, bool) {
+	ctx := c.Request.Context()
+	var head db.KeyTransparencyTreeHead
+	var err error
+	if value := c.Query(param); value != "" {
+		treeSize, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil || treeSize < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			return head, false
+		}
+		head, err = l.db.GetKeyTransparencyTreeHead(ctx, treeSize)
+	} else {
+		head, err = l.db.GetLatestKeyTransparencyTreeHead(ctx)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No tree head of that size"})
+		} else {
+			log.Printf("Error loading key transparency tree head: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tree head"})
+		}
+		return head, false
+	}
+	return head, true
+}
+
+// GetTreeHead returns the latest signed tree head, or the one for
+// ?tree_size=.
+func (l *Log) GetTreeHead(c *gin.Context) {
+	head, ok := l.treeHeadFromQuery(c, "tree_size")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toTreeHead(head))
+}
+
+// GetConsistencyProof proves the tree head of size ?first= is a prefix of the
+// one of size ?second= (the latest by default).
+func (l *Log) GetConsistencyProof(c *gin.Context) {
+	first, err := strconv.ParseInt(c.Query("first"), 10, 64)
+	if err != nil || first < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid first"})
+		return
+	}
+	second, ok := l.treeHeadFromQuery(c, "second")
+	if !ok {
+		return
+	}
+	if first > second.TreeSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "first must not be larger than second"})
+		return
+	}
+
+	proof, err := l.proofHashes(c.Request.Context(), consistencyProofRanges(int(first), int(second.TreeSize)))
+	if err != nil {
+		log.Printf("Error loading key transparency subtrees: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build consistency proof"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tree_head": toTreeHead(second),
+		"first":     first,
+		"proof":     proof,
+	})
+}
+
+// GetLeafHashes pages through leaf hashes so auditors can recompute root
+// hashes. Leaf data is not exposed here; it names users and devices.
+func (l *Log) GetLeafHashes(c *gin.Context) {
+	start, err := strconv.ParseInt(c.DefaultQuery("start", "0"), 10, 64)
+	if err != nil || start < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start"})
+		return
+	}
+	end, err := strconv.ParseInt(c.Query("end"), 10, 64)
+	if err != nil || end < start {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end"})
+		return
+	}
+	end = min(end, start+maxLeafHashesPerPage)
+
+	leafHashes, err := l.db.GetKeyTransparencyLeafHashes(c.Request.Context(), db.GetKeyTransparencyLeafHashesParams{
+		StartIndex: start,
+		EndIndex:   end,
+	})
+	if err != nil {
+		log.Printf("Error loading key transparency leaf hashes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaf hashes"})
+		return
+	}
+	if leafHashes == nil {
+		leafHashes = [][]byte{}
+	}
+	c.JSON(http.StatusOK, gin.H{"start": start, "leaf_hashes": leafHashes})
+}
+
+// GetInclusionProofs proves that each of a user's current device keys is in
+// the tree (the latest tree head, or ?tree_size=). Callers can only look up
+// themselves and people they share a group with, the same users whose device
+// keys they can fetch.
+func (l *Log) GetInclusionProofs(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, l.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	targetID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if targetID != user.ID {
+		shared, err := l.db.UsersShareGroup(ctx, db.UsersShareGroupParams{UserID: &user.ID, OtherUserID: &targetID})
+		if err != nil {
+			log.Printf("Error checking shared groups for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build inclusion proofs"})
+			return
+		}
+		if !shared {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+	}
+
+	head, ok := l.treeHeadFromQuery(c, "tree_size")
+	if !ok {
+		return
+	}
+
+	leaves, err := l.db.GetCurrentKeyTransparencyLeavesForUser(ctx, db.GetCurrentKeyTransparencyLeavesForUserParams{
+		UserID:   targetID,
+		TreeSize: head.TreeSize,
+	})
+	if err != nil {
+		log.Printf("Error loading key transparency leaves for user %s: %v", targetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build inclusion proofs"})
+		return
+	}
+
+	entries := make([]InclusionEntry, 0, len(leaves))
+	for _, leaf := range leaves {
+		index := int(leaf.LeafIndex.Int64)
+		proof, err := l.proofHashes(ctx, inclusionProofRanges(index, int(head.TreeSize)))
+		if err != nil {
+			log.Printf("Error loading key transparency subtrees: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build inclusion proofs"})
+			return
+		}
+		entries = append(entries, InclusionEntry{
+			LeafIndex: uint64(index),
+			LeafData:  leaf.LeafData,
+			Proof:     proof,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"tree_head": toTreeHead(head), "entries": entries})
+}
@@ -0,0 +1,227 @@
+package transparency
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"chat-app-server/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	sequenceInterval  = 5 * time.Second
+	sequenceBatchSize = 1000
+)
+
+// Log is the append-only Merkle log of device key changes. A database trigger
+// queues every change to device_keys; the sequencer turns queued changes into
+// leaves and signs a tree head over them.
+type Log struct {
+	db         *db.Queries
+	ctx        context.Context
+	conn       *pgxpool.Pool
+	signingKey ed25519.PrivateKey
+}
+
+func NewLog(
+	db *db.Queries,
+	ctx context.Context,
+	conn *pgxpool.Pool,
+	signingKey ed25519.PrivateKey,
+) *Log {
+	return &Log{
+		db:         db,
+		ctx:        ctx,
+		conn:       conn,
+		signingKey: signingKey,
+	}
+}
+
+// Run sequences pending entries every few seconds until the log's context is
+// cancelled.
+func (l *Log) Run() {
+	ticker := time.NewTicker(sequenceInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.Sequence(l.ctx); err != nil {
+			log.Printf("Error sequencing key transparency log: %v", err)
+		}
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sequence appends pending entries to the tree in the order they were queued
+// and publishes a signed tree head covering them. Instances take turns via an
+// advisory lock, so leaf indexes stay dense.
+func (l *Log) Sequence(ctx context.Context) error {
+	tx, err := l.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := l.db.WithTx(tx)
+
+	if err := qtx.LockKeyTransparencyLog(ctx); err != nil {
+		return err
+	}
+
+	head, err := qtx.GetLatestKeyTransparencyTreeHead(ctx)
+	hasHead := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	pending, err := qtx.GetPendingKeyTransparencyEntries(ctx, sequenceBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 && hasHead {
+		return nil
+	}
+
+	// Only the frontier of the tree is needed to extend it: the complete
+	// subtrees it's made of, whose hashes fold into the current root.
+	frontierNodes := rangeSubtrees(leafRange{Start: 0, End: int(head.TreeSize)})
+	stored, err := loadSubtrees(ctx, qtx, frontierNodes)
+	if err != nil {
+		return err
+	}
+	frontier := make([]subtreeHash, 0, len(frontierNodes))
+	for _, node := range frontierNodes {
+		frontier = append(frontier, subtreeHash{subtree: node, Hash: stored[node]})
+	}
+	if hasHead && !bytes.Equal(frontierRoot(frontier), head.RootHash) {
+		return fmt.Errorf("stored subtrees do not match the tree head of size %d", head.TreeSize)
+	}
+
+	var added db.InsertKeyTransparencySubtreesParams
+	treeSize := head.TreeSize
+	for _, entry := range pending {
+		leafData, err := encodeLeaf(Leaf{
+			Operation:        entry.Operation,
+			UserID:           entry.UserID,
+			DeviceIdentifier: entry.DeviceIdentifier,
+			PublicKey:        entry.PublicKey,
+			Signature:        entry.Signature,
+			ChangedAt:        entry.ChangedAt.Time,
+		})
+		if err != nil {
+			return err
+		}
+		leafHash := HashLeaf(leafData)
+		if err := qtx.SequenceKeyTransparencyEntry(ctx, db.SequenceKeyTransparencyEntryParams{
+			LeafIndex: treeSize,
+			LeafData:  leafData,
+			LeafHash:  leafHash,
+			ID:        entry.ID,
+		}); err != nil {
+			return err
+		}
+		treeSize++
+
+		var completed []subtreeHash
+		frontier, completed = appendLeaf(frontier, leafHash)
+		for _, node := range completed {
+			added.Levels = append(added.Levels, int16(node.Level))
+			added.StartIndexes = append(added.StartIndexes, int64(node.Start))
+			added.Hashes = append(added.Hashes, node.Hash)
+		}
+	}
+	if len(added.Hashes) > 0 {
+		if err := qtx.InsertKeyTransparencySubtrees(ctx, added); err != nil {
+			return err
+		}
+	}
+
+	treeHead := TreeHead{
+		TreeSize:  uint64(treeSize),
+		RootHash:  frontierRoot(frontier),
+		Timestamp: time.Now().UTC().UnixMilli(),
+	}
+	treeHead.Signature = ed25519.Sign(l.signingKey, treeHead.SignedMessage())
+
+	if _, err := qtx.InsertKeyTransparencyTreeHead(ctx, db.InsertKeyTransparencyTreeHeadParams{
+		TreeSize:    int64(treeHead.TreeSize),
+		RootHash:    treeHead.RootHash,
+		TimestampMs: treeHead.Timestamp,
+		Signature:   treeHead.Signature,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	log.Printf("Key transparency log now has %d leaves", treeHead.TreeSize)
+	return nil
+}
+
+// loadSubtrees loads the stored hashes of nodes. Every complete subtree of a
+// sequenced tree is stored, so a missing one means the log is corrupt.
+func loadSubtrees(ctx context.Context, q *db.Queries, nodes []subtree) (map[subtree][]byte, error) {
+	params := db.GetKeyTransparencySubtreesParams{
+		Levels:       make([]int16, 0, len(nodes)),
+		StartIndexes: make([]int64, 0, len(nodes)),
+	}
+	for _, node := range nodes {
+		params.Levels = append(params.Levels, int16(node.Level))
+		params.StartIndexes = append(params.StartIndexes, int64(node.Start))
+	}
+	rows, err := q.GetKeyTransparencySubtrees(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[subtree][]byte, len(rows))
+	for _, row := range rows {
+		stored[subtree{Level: int(row.Level), Start: int(row.StartIndex)}] = row.Hash
+	}
+	for _, node := range nodes {
+		if _, ok := stored[node]; !ok {
+			return nil, fmt.Errorf("missing subtree of %d leaves at %d", 1<<node.Level, node.Start)
+		}
+	}
+	return stored, nil
+}
+
+// proofHashes loads the hash of each range of a proof from the stored
+// subtrees, in one query rather than from every leaf of the tree.
+func (l *Log) proofHashes(ctx context.Context, ranges []leafRange) ([][]byte, error) {
+	var nodes []subtree
+	for _, r := range ranges {
+		nodes = append(nodes, rangeSubtrees(r)...)
+	}
+	stored, err := loadSubtrees(ctx, l.db, nodes)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, 0, len(ranges))
+	for _, r := range ranges {
+		var nodeHashes [][]byte
+		for _, node := range rangeSubtrees(r) {
+			nodeHashes = append(nodeHashes, stored[node])
+		}
+		hashes = append(hashes, foldSubtrees(nodeHashes))
+	}
+	return hashes, nil
+}
+
+func toTreeHead(row db.KeyTransparencyTreeHead) TreeHead {
+	return TreeHead{
+		TreeSize:  uint64(row.TreeSize),
+		RootHash:  row.RootHash,
+		Timestamp: row.TimestampMs,
+		Signature: row.Signature,
+	}
+}
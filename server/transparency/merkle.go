@@ -0,0 +1,273 @@
+package transparency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// Merkle tree hashing, audit paths and consistency proofs as defined in
+// RFC 6962 §2.1 (and RFC 9162 §2.1 for verification). Functions taking
+// leafHashes expect hashes produced by HashLeaf, in leaf order.
+
+var (
+	errInvalidInclusionProof   = errors.New("inclusion proof does not match the root hash")
+	errInvalidConsistencyProof = errors.New("consistency proof does not match the root hashes")
+)
+
+// HashLeaf returns SHA-256(0x00 || data).
+func HashLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashChildren(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint returns the largest power of two smaller than n, for n > 1.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// RootHash computes the Merkle tree hash of the leaves.
+func RootHash(leafHashes [][]byte) []byte {
+	switch len(leafHashes) {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return leafHashes[0]
+	}
+	k := splitPoint(len(leafHashes))
+	return hashChildren(RootHash(leafHashes[:k]), RootHash(leafHashes[k:]))
+}
+
+// leafRange is the leaves [Start, End) of a proof node. Proofs only cover
+// ranges whose Start is a multiple of a power of two no smaller than the
+// range, so their hashes fold from the complete subtrees in rangeSubtrees.
+type leafRange struct {
+	Start int
+	End   int
+}
+
+// subtree is the complete subtree of the 2^Level leaves from Start. The log
+// stores the hash of each one as soon as its last leaf is sequenced.
+type subtree struct {
+	Level int
+	Start int
+}
+
+// rangeSubtrees splits r into its complete subtrees, largest first.
+func rangeSubtrees(r leafRange) []subtree {
+	var nodes []subtree
+	for start := r.Start; start < r.End; {
+		level := bits.Len(uint(r.End-start)) - 1
+		nodes = append(nodes, subtree{Level: level, Start: start})
+		start += 1 << level
+	}
+	return nodes
+}
+
+// foldSubtrees computes the Merkle tree hash of a range from the hashes of
+// its rangeSubtrees, in the same order.
+func foldSubtrees(hashes [][]byte) []byte {
+	if len(hashes) == 0 {
+		return RootHash(nil)
+	}
+	root := hashes[len(hashes)-1]
+	for i := len(hashes) - 2; i >= 0; i-- {
+		root = hashChildren(hashes[i], root)
+	}
+	return root
+}
+
+// subtreeHash is a complete subtree together with its hash.
+type subtreeHash struct {
+	subtree
+	Hash []byte
+}
+
+// appendLeaf adds the next leaf to frontier, the complete subtrees of the tree
+// as rangeSubtrees orders them, and returns the new frontier along with every
+// subtree the leaf completes, starting with the leaf itself.
+func appendLeaf(frontier []subtreeHash, leafHash []byte) ([]subtreeHash, []subtreeHash) {
+	index := 0
+	if n := len(frontier); n > 0 {
+		index = frontier[n-1].Start + 1<<frontier[n-1].Level
+	}
+	node := subtreeHash{subtree: subtree{Level: 0, Start: index}, Hash: leafHash}
+	completed := []subtreeHash{node}
+	for n := len(frontier); n > 0 && frontier[n-1].Level == node.Level; n-- {
+		left := frontier[n-1]
+		node = subtreeHash{
+			subtree: subtree{Level: node.Level + 1, Start: left.Start},
+			Hash:    hashChildren(left.Hash, node.Hash),
+		}
+		frontier = frontier[:n-1]
+		completed = append(completed, node)
+	}
+	return append(frontier, node), completed
+}
+
+// frontierRoot returns the root hash of the tree with the given frontier.
+func frontierRoot(frontier []subtreeHash) []byte {
+	hashes := make([][]byte, 0, len(frontier))
+	for _, node := range frontier {
+		hashes = append(hashes, node.Hash)
+	}
+	return foldSubtrees(hashes)
+}
+
+// InclusionProof returns the audit path for the leaf at index.
+func InclusionProof(index int, leafHashes [][]byte) [][]byte {
+	return rangeHashes(inclusionProofRanges(index, len(leafHashes)), leafHashes)
+}
+
+// inclusionProofRanges returns the ranges whose hashes make up the audit path
+// for the leaf at index in a tree of treeSize leaves.
+func inclusionProofRanges(index int, treeSize int) []leafRange {
+	return inclusionSubproof(index, leafRange{Start: 0, End: treeSize})
+}
+
+func inclusionSubproof(index int, r leafRange) []leafRange {
+	n := r.End - r.Start
+	if n <= 1 {
+		return []leafRange{}
+	}
+	mid := r.Start + splitPoint(n)
+	if index < mid {
+		return append(inclusionSubproof(index, leafRange{Start: r.Start, End: mid}), leafRange{Start: mid, End: r.End})
+	}
+	return append(inclusionSubproof(index, leafRange{Start: mid, End: r.End}), leafRange{Start: r.Start, End: mid})
+}
+
+// ConsistencyProof proves that the tree of the first oldSize leaves is a
+// prefix of the tree of all leafHashes.
+func ConsistencyProof(oldSize int, leafHashes [][]byte) [][]byte {
+	return rangeHashes(consistencyProofRanges(oldSize, len(leafHashes)), leafHashes)
+}
+
+// consistencyProofRanges returns the ranges whose hashes prove that the tree
+// of oldSize leaves is a prefix of the tree of treeSize leaves.
+func consistencyProofRanges(oldSize int, treeSize int) []leafRange {
+	if oldSize == 0 || oldSize == treeSize {
+		return []leafRange{}
+	}
+	return subproof(oldSize, leafRange{Start: 0, End: treeSize}, true)
+}
+
+func subproof(oldSize int, r leafRange, complete bool) []leafRange {
+	if oldSize == r.End {
+		if complete {
+			return []leafRange{}
+		}
+		return []leafRange{r}
+	}
+	mid := r.Start + splitPoint(r.End-r.Start)
+	if oldSize <= mid {
+		return append(subproof(oldSize, leafRange{Start: r.Start, End: mid}, complete), leafRange{Start: mid, End: r.End})
+	}
+	return append(subproof(oldSize, leafRange{Start: mid, End: r.End}, false), leafRange{Start: r.Start, End: mid})
+}
+
+func rangeHashes(ranges []leafRange, leafHashes [][]byte) [][]byte {
+	hashes := make([][]byte, 0, len(ranges))
+	for _, r := range ranges {
+		hashes = append(hashes, RootHash(leafHashes[r.Start:r.End]))
+	}
+	return hashes
+}
+
+// VerifyInclusion checks that leafHash is at index in the tree of treeSize
+// leaves with the given root.
+func VerifyInclusion(index uint64, treeSize uint64, leafHash []byte, proof [][]byte, rootHash []byte) error {
+	if index >= treeSize {
+		return errors.New("leaf index is outside the tree")
+	}
+	fn, sn := index, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errInvalidInclusionProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, rootHash) {
+		return errInvalidInclusionProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of oldSize leaves with oldRoot is a
+// prefix of the tree of newSize leaves with newRoot.
+func VerifyConsistency(oldSize uint64, newSize uint64, oldRoot []byte, newRoot []byte, proof [][]byte) error {
+	switch {
+	case oldSize > newSize:
+		return errors.New("old tree is larger than the new tree")
+	case oldSize == newSize:
+		if len(proof) != 0 || !bytes.Equal(oldRoot, newRoot) {
+			return errInvalidConsistencyProof
+		}
+		return nil
+	case oldSize == 0:
+		if len(proof) != 0 {
+			return errInvalidConsistencyProof
+		}
+		return nil
+	case len(proof) == 0:
+		return errInvalidConsistencyProof
+	}
+
+	if oldSize&(oldSize-1) == 0 {
+		proof = append([][]byte{oldRoot}, proof...)
+	}
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return errInvalidConsistencyProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashChildren(c, fr)
+			sr = hashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = hashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(fr, oldRoot) || !bytes.Equal(sr, newRoot) {
+		return errInvalidConsistencyProof
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package transparency
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from the RFC 6962 reference implementation (certificate
+// transparency merkle_tree_test).
+var rfc6962Leaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+// rfc6962Roots[i] is the root of the tree of the first i+1 leaves.
+var rfc6962Roots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustHexes(t *testing.T, hexes ...string) [][]byte {
+	t.Helper()
+	out := make([][]byte, 0, len(hexes))
+	for _, s := range hexes {
+		out = append(out, mustHex(t, s))
+	}
+	return out
+}
+
+func rfc6962LeafHashes(t *testing.T, n int) [][]byte {
+	t.Helper()
+	hashes := make([][]byte, 0, n)
+	for _, leaf := range rfc6962Leaves[:n] {
+		hashes = append(hashes, HashLeaf(mustHex(t, leaf)))
+	}
+	return hashes
+}
+
+func equalHashes(a [][]byte, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRootHash(t *testing.T) {
+	empty := RootHash(nil)
+	if got, want := hex.EncodeToString(empty), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"; got != want {
+		t.Errorf("RootHash(empty) = %s, want %s", got, want)
+	}
+
+	for i, want := range rfc6962Roots {
+		size := i + 1
+		if got := hex.EncodeToString(RootHash(rfc6962LeafHashes(t, size))); got != want {
+			t.Errorf("RootHash(%d leaves) = %s, want %s", size, got, want)
+		}
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	tests := []struct {
+		index int
+		size  int
+		proof []string
+	}{
+		{0, 1, nil},
+		{0, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{5, 8, []string{
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 3, []string{
+			"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		}},
+		{1, 5, []string{
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+
+	for _, tt := range tests {
+		leafHashes := rfc6962LeafHashes(t, tt.size)
+		want := mustHexes(t, tt.proof...)
+		got := InclusionProof(tt.index, leafHashes)
+		if !equalHashes(got, want) {
+			t.Errorf("InclusionProof(%d, %d leaves) = %x, want %x", tt.index, tt.size, got, want)
+		}
+
+		root := mustHex(t, rfc6962Roots[tt.size-1])
+		if err := VerifyInclusion(uint64(tt.index), uint64(tt.size), leafHashes[tt.index], want, root); err != nil {
+			t.Errorf("VerifyInclusion(%d, %d leaves) = %v", tt.index, tt.size, err)
+		}
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	tests := []struct {
+		oldSize int
+		newSize int
+		proof   []string
+	}{
+		{1, 1, nil},
+		{1, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{6, 8, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 5, []string{
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+
+	for _, tt := range tests {
+		want := mustHexes(t, tt.proof...)
+		got := ConsistencyProof(tt.oldSize, rfc6962LeafHashes(t, tt.newSize))
+		if !equalHashes(got, want) {
+			t.Errorf("ConsistencyProof(%d, %d leaves) = %x, want %x", tt.oldSize, tt.newSize, got, want)
+		}
+
+		oldRoot := mustHex(t, rfc6962Roots[tt.oldSize-1])
+		newRoot := mustHex(t, rfc6962Roots[tt.newSize-1])
+		if err := VerifyConsistency(uint64(tt.oldSize), uint64(tt.newSize), oldRoot, newRoot, want); err != nil {
+			t.Errorf("VerifyConsistency(%d, %d) = %v", tt.oldSize, tt.newSize, err)
+		}
+	}
+}
+
+// TestProofsRoundTrip checks every proof the log can produce for trees of up
+// to 8 leaves verifies, and fails against a different root.
+func TestProofsRoundTrip(t *testing.T) {
+	leafHashes := rfc6962LeafHashes(t, len(rfc6962Leaves))
+	wrongRoot := HashLeaf([]byte("not the root"))
+
+	for size := 1; size <= len(leafHashes); size++ {
+		root := RootHash(leafHashes[:size])
+		for index := 0; index < size; index++ {
+			proof := InclusionProof(index, leafHashes[:size])
+			if err := VerifyInclusion(uint64(index), uint64(size), leafHashes[index], proof, root); err != nil {
+				t.Errorf("inclusion of %d in %d leaves: %v", index, size, err)
+			}
+			if err := VerifyInclusion(uint64(index), uint64(size), leafHashes[index], proof, wrongRoot); err == nil {
+				t.Errorf("inclusion of %d in %d leaves verified against the wrong root", index, size)
+			}
+			if size > 1 {
+				other := (index + 1) % size
+				if err := VerifyInclusion(uint64(other), uint64(size), leafHashes[index], proof, root); err == nil {
+					t.Errorf("inclusion proof of %d in %d leaves verified at index %d", index, size, other)
+				}
+			}
+		}
+
+		for oldSize := 0; oldSize <= size; oldSize++ {
+			oldRoot := RootHash(leafHashes[:oldSize])
+			proof := ConsistencyProof(oldSize, leafHashes[:size])
+			if err := VerifyConsistency(uint64(oldSize), uint64(size), oldRoot, root, proof); err != nil {
+				t.Errorf("consistency %d -> %d: %v", oldSize, size, err)
+			}
+			if oldSize > 0 && oldSize < size {
+				if err := VerifyConsistency(uint64(oldSize), uint64(size), wrongRoot, root, proof); err == nil {
+					t.Errorf("consistency %d -> %d verified with the wrong old root", oldSize, size)
+				}
+				if err := VerifyConsistency(uint64(oldSize), uint64(size), oldRoot, wrongRoot, proof); err == nil {
+					t.Errorf("consistency %d -> %d verified with the wrong new root", oldSize, size)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyRejectsMalformedInput(t *testing.T) {
+	leafHashes := rfc6962LeafHashes(t, 4)
+	root := RootHash(leafHashes)
+
+	if err := VerifyInclusion(4, 4, leafHashes[0], InclusionProof(0, leafHashes), root); err == nil {
+		t.Error("VerifyInclusion accepted an index outside the tree")
+	}
+	if err := VerifyInclusion(0, 4, leafHashes[0], InclusionProof(0, leafHashes)[:1], root); err == nil {
+		t.Error("VerifyInclusion accepted a truncated proof")
+	}
+	if err := VerifyConsistency(4, 2, root, RootHash(leafHashes[:2]), nil); err == nil {
+		t.Error("VerifyConsistency accepted a shrinking tree")
+	}
+	if err := VerifyConsistency(2, 4, RootHash(leafHashes[:2]), root, nil); err == nil {
+		t.Error("VerifyConsistency accepted an empty proof")
+	}
+	if err := VerifyConsistency(4, 4, root, HashLeaf(nil), nil); err == nil {
+		t.Error("VerifyConsistency accepted different roots for the same size")
+	}
+}
+
+// TestStoredSubtrees grows a tree one leaf at a time the way the sequencer
+// does and checks that roots and proofs folded from the subtrees it stores
+// match the ones computed from every leaf.
+func TestStoredSubtrees(t *testing.T) {
+	const maxSize = 70
+	leafHashes := make([][]byte, 0, maxSize)
+	stored := map[subtree][]byte{}
+	var frontier []subtreeHash
+
+	fromStored := func(ranges []leafRange) [][]byte {
+		hashes := make([][]byte, 0, len(ranges))
+		for _, r := range ranges {
+			var nodeHashes [][]byte
+			for _, node := range rangeSubtrees(r) {
+				hash, ok := stored[node]
+				if !ok {
+					t.Fatalf("subtree %+v of range %+v was never stored", node, r)
+				}
+				nodeHashes = append(nodeHashes, hash)
+			}
+			hashes = append(hashes, foldSubtrees(nodeHashes))
+		}
+		return hashes
+	}
+
+	for size := 1; size <= maxSize; size++ {
+		leafHash := HashLeaf([]byte{byte(size)})
+		leafHashes = append(leafHashes, leafHash)
+		var completed []subtreeHash
+		frontier, completed = appendLeaf(frontier, leafHash)
+		for _, node := range completed {
+			stored[node.subtree] = node.Hash
+		}
+
+		root := RootHash(leafHashes)
+		if got := frontierRoot(frontier); !bytes.Equal(got, root) {
+			t.Fatalf("frontier root of %d leaves = %x, want %x", size, got, root)
+		}
+		if got := fromStored([]leafRange{{Start: 0, End: size}}); !bytes.Equal(got[0], root) {
+			t.Errorf("stored root of %d leaves = %x, want %x", size, got[0], root)
+		}
+		for index := 0; index < size; index++ {
+			if got, want := fromStored(inclusionProofRanges(index, size)), InclusionProof(index, leafHashes); !equalHashes(got, want) {
+				t.Errorf("stored inclusion proof of %d in %d leaves = %x, want %x", index, size, got, want)
+			}
+		}
+		for oldSize := 0; oldSize <= size; oldSize++ {
+			if got, want := fromStored(consistencyProofRanges(oldSize, size)), ConsistencyProof(oldSize, leafHashes); !equalHashes(got, want) {
+				t.Errorf("stored consistency proof %d -> %d = %x, want %x", oldSize, size, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package transparency
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// treeHeadSignatureContext domain-separates tree head signatures.
+const treeHeadSignatureContext = "chat-app key transparency tree head v1"
+
+// TreeHead commits to the first TreeSize leaves of the log. Byte fields are
+// base64 in JSON.
+type TreeHead struct {
+	TreeSize  uint64 `json:"tree_size"`
+	RootHash  []byte `json:"root_hash"`
+	Timestamp int64  `json:"timestamp"`
+	Signature []byte `json:"signature"`
+}
+
+// SignedMessage is what the log key signs: the context string, a zero byte,
+// then the big-endian uint64 tree size and int64 timestamp (Unix
+// milliseconds) followed by the 32-byte root hash.
+func (th TreeHead) SignedMessage() []byte {
+	message := make([]byte, 0, len(treeHeadSignatureContext)+1+16+len(th.RootHash))
+	message = append(message, treeHeadSignatureContext...)
+	message = append(message, 0)
+	message = binary.BigEndian.AppendUint64(message, th.TreeSize)
+	message = binary.BigEndian.AppendUint64(message, uint64(th.Timestamp))
+	return append(message, th.RootHash...)
+}
+
+// Verify checks the tree head signature against the log's public key.
+func (th TreeHead) Verify(publicKey ed25519.PublicKey) error {
+	if !ed25519.Verify(publicKey, th.SignedMessage(), th.Signature) {
+		return errors.New("tree head signature is invalid")
+	}
+	return nil
+}
+
+// Leaf is the logged record of one change to a device key. Its JSON encoding
+// is stored as the leaf data and is what gets hashed into the tree.
+type Leaf struct {
+	Operation        string    `json:"operation"`
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	PublicKey        []byte    `json:"public_key"`
+	Signature        []byte    `json:"signature"`
+	ChangedAt        time.Time `json:"changed_at"`
+}
+
+func encodeLeaf(leaf Leaf) ([]byte, error) {
+	return json.Marshal(leaf)
+}
+
+// ParseLeaf decodes leaf data returned with an inclusion proof.
+func ParseLeaf(data []byte) (Leaf, error) {
+	var leaf Leaf
+	err := json.Unmarshal(data, &leaf)
+	return leaf, err
+}
+
+// LoadSigningKeyFromEnv reads the PKCS #8 PEM Ed25519 key at
+// KT_SIGNING_KEY_FILE. It is required unless KT_EPHEMERAL_KEY=1 opts in to a
+// generated key, which is only suitable for a single dev instance: tree heads
+// signed before a restart no longer verify against the published key.
+func LoadSigningKeyFromEnv() (ed25519.PrivateKey, error) {
+	path := os.Getenv("KT_SIGNING_KEY_FILE")
+	if path == "" {
+		if os.Getenv("KT_EPHEMERAL_KEY") != "1" {
+			return nil, fmt.Errorf("KT_SIGNING_KEY_FILE must be set (or KT_EPHEMERAL_KEY=1 for local development)")
+		}
+		log.Println("Warning: KT_EPHEMERAL_KEY set, signing key transparency tree heads with an ephemeral key.")
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: key transparency signing key must be Ed25519", path)
+	}
+	return privateKey, nil
+}
@@ -62,3 +62,10 @@ func NullablePgTimestamp(s *time.Time) pgtype.Timestamp {
 	}
 	return pgtype.Timestamp{Time: *s, Valid: true}
 }
+
+func NullablePgBool(b *bool) pgtype.Bool {
+	if b == nil {
+		return pgtype.Bool{Valid: false}
+	}
+	return pgtype.Bool{Bool: *b, Valid: true}
+}
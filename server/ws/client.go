@@ -1,9 +1,11 @@
 package ws
 
 import (
+	"chat-app-server/auth"
 	"chat-app-server/db"
 	"chat-app-server/util"
 	"context"
+	"encoding/json"
 	"errors"
 	"log"
 	"net"
@@ -15,13 +17,18 @@ import (
 )
 
 type Client struct {
-	conn    *websocket.Conn
-	Message chan *RawMessageE2EE
-	Groups  map[uuid.UUID]bool
-	User    *db.GetUserByIdRow `json:"user"`
-	mutex   sync.RWMutex
-	ctx     context.Context
-	cancel  context.CancelFunc
+	conn      *websocket.Conn
+	Message   chan *RawMessageE2EE
+	Events    chan *ServerEvent
+	Groups    map[uuid.UUID]bool
+	User      *db.GetUserByIdRow `json:"user"`
+	mutex     sync.RWMutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	tokenID   string
+	sessionID string
+	// deviceID is the device the session was opened on, empty if unknown.
+	deviceID string
 }
 
 const (
@@ -31,15 +38,46 @@ const (
 	maxMessageSize = 16 * 1024
 )
 
-func NewClient(conn *websocket.Conn, user *db.GetUserByIdRow) *Client {
+func NewClient(conn *websocket.Conn, user *db.GetUserByIdRow, claims *auth.Claims) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
-		conn:    conn,
-		Message: make(chan *RawMessageE2EE, 10),
-		Groups:  make(map[uuid.UUID]bool),
-		User:    user,
-		ctx:     ctx,
-		cancel:  cancel,
+		conn:      conn,
+		Message:   make(chan *RawMessageE2EE, 10),
+		Events:    make(chan *ServerEvent, 10),
+		Groups:    make(map[uuid.UUID]bool),
+		User:      user,
+		ctx:       ctx,
+		cancel:    cancel,
+		tokenID:   claims.ID,
+		sessionID: claims.SessionID,
+	}
+}
+
+// AuthenticatedWith reports whether the connection was opened with the given
+// token or with any token from the given session family.
+func (c *Client) AuthenticatedWith(tokenID string, sessionID string) bool {
+	return (tokenID != "" && c.tokenID == tokenID) || (sessionID != "" && c.sessionID == sessionID)
+}
+
+// Close sends a close frame and tears down the connection, which ends the
+// read loop and lets EstablishConnection unregister the client.
+func (c *Client) Close(reason string) {
+	deadline := time.Now().Add(writeWait)
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	if err := c.conn.WriteControl(websocket.CloseMessage, closeMsg, deadline); err != nil {
+		log.Printf("Client %s (%s): Error sending close frame: %v", c.User.ID, c.User.Username, err)
+	}
+	c.cancel()
+	c.conn.Close()
+}
+
+// SendEvent queues an event for the writer without blocking; it is dropped if
+// the client is not keeping up.
+func (c *Client) SendEvent(event *ServerEvent) {
+	select {
+	case c.Events <- event:
+	default:
+		log.Printf("Client %s (%s): event channel full, %s event dropped.", c.User.ID, c.User.Username, event.Type)
 	}
 }
 
@@ -80,6 +118,15 @@ func (c *Client) WriteMessage() {
 				log.Printf("Error writing JSON (E2EE) for client %d (%s): %v", c.User.ID, c.User.Username, err)
 				return
 			}
+		case event := <-c.Events:
+			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+				log.Printf("Client %d (%s): Error setting write deadline: %v", c.User.ID, c.User.Username, err)
+				return
+			}
+			if err := c.conn.WriteJSON(event); err != nil {
+				log.Printf("Error writing %s event for client %d (%s): %v", event.Type, c.User.ID, c.User.Username, err)
+				return
+			}
 		case <-ticker.C:
 			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
 				log.Printf("Client %d (%s): Error setting write deadline for ping: %v", c.User.ID, c.User.Username, err)
@@ -119,8 +166,7 @@ func (c *Client) ReadMessage(hub *Hub, queries *db.Queries) {
 		default:
 		}
 
-		var clientMsg ClientSentE2EMessage
-		err := c.conn.ReadJSON(&clientMsg)
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
 				log.Printf("Client %d (%s): Unexpected WebSocket close error: %v", c.User.ID, c.User.Username, err)
@@ -136,37 +182,163 @@ func (c *Client) ReadMessage(hub *Hub, queries *db.Queries) {
 			return
 		}
 
-		isMember, err := util.UserInGroup(c.ctx, c.User.ID, clientMsg.GroupID, queries)
-		if err != nil {
-			log.Printf("Client %d (%s): DB error checking group %d authorization for E2EE message: %v. Discarding.",
-				c.User.ID, c.User.Username, clientMsg.GroupID, err)
+		var frame ClientFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			log.Printf("Client %s (%s): Malformed frame: %v. Discarding.", c.User.ID, c.User.Username, err)
 			continue
 		}
 
-		if !isMember {
-			log.Printf("Client %d (%s) attempted to send E2EE message to unauthorized group %d. Discarding.",
-				c.User.ID, c.User.Username, clientMsg.GroupID)
-			continue
+		switch frame.Type {
+		case "", "message":
+			if !c.sendChatMessage(hub, queries, data) {
+				return
+			}
+		case "edit_message":
+			c.editMessage(hub, data)
+		case "delete_message":
+			c.deleteMessage(hub, data)
+		case "add_reaction", "remove_reaction":
+			c.reactToMessage(hub, data, frame.Type == "add_reaction")
+		default:
+			log.Printf("Client %s (%s): Unknown frame type %q. Discarding.", c.User.ID, c.User.Username, frame.Type)
 		}
+	}
+}
 
-		hubMessage := &RawMessageE2EE{
-			ID:          clientMsg.ID,
-			GroupID:     clientMsg.GroupID,
-			MessageType: clientMsg.MessageType,
-			MsgNonce:    clientMsg.MsgNonce,
-			Ciphertext:  clientMsg.Ciphertext,
-			Envelopes:   clientMsg.Envelopes,
-			SenderID:    c.User.ID,
-		}
+// sendChatMessage checks a new chat message and hands it to the hub. It
+// returns false once the client's context is cancelled.
+func (c *Client) sendChatMessage(hub *Hub, queries *db.Queries, data []byte) bool {
+	var clientMsg ClientSentE2EMessage
+	if err := json.Unmarshal(data, &clientMsg); err != nil {
+		log.Printf("Client %s (%s): Malformed E2EE message: %v. Discarding.", c.User.ID, c.User.Username, err)
+		return true
+	}
 
-		select {
-		case hub.Broadcast <- hubMessage:
-			log.Printf("Client %d (%s) sent E2EE message to hub for group %d", c.User.ID, c.User.Username, hubMessage.GroupID)
-		case <-c.ctx.Done():
-			log.Printf("Client %d (%s): Context cancelled while trying to broadcast message.", c.User.ID, c.User.Username)
-			return
-		default:
-			log.Printf("Hub broadcast channel full for client %d (%s). Message for group %d dropped.", c.User.ID, c.User.Username, hubMessage.GroupID)
-		}
+	isMember, err := util.UserInGroup(c.ctx, c.User.ID, clientMsg.GroupID, queries)
+	if err != nil {
+		log.Printf("Client %d (%s): DB error checking group %d authorization for E2EE message: %v. Discarding.",
+			c.User.ID, c.User.Username, clientMsg.GroupID, err)
+		return true
+	}
+
+	if !isMember {
+		log.Printf("Client %d (%s) attempted to send E2EE message to unauthorized group %d. Discarding.",
+			c.User.ID, c.User.Username, clientMsg.GroupID)
+		return true
+	}
+
+	rejection, err := hub.CheckMessageKeys(c.ctx, c.User.ID, c.deviceID, &clientMsg)
+	if err != nil {
+		log.Printf("Client %s (%s): DB error checking recipients of message %s for group %s: %v. Discarding.",
+			c.User.ID, c.User.Username, clientMsg.ID, clientMsg.GroupID, err)
+		return true
+	}
+	if rejection != nil {
+		log.Printf("Client %s (%s): message %s for group %s rejected: %s",
+			c.User.ID, c.User.Username, clientMsg.ID, clientMsg.GroupID, rejection.Message)
+		c.SendEvent(rejection)
+		return true
+	}
+
+	hubMessage := newRawMessage(&clientMsg, c.User.ID, c.deviceID)
+
+	select {
+	case hub.Broadcast <- hubMessage:
+		log.Printf("Client %d (%s) sent E2EE message to hub for group %d", c.User.ID, c.User.Username, hubMessage.GroupID)
+	case <-c.ctx.Done():
+		log.Printf("Client %d (%s): Context cancelled while trying to broadcast message.", c.User.ID, c.User.Username)
+		return false
+	default:
+		log.Printf("Hub broadcast channel full for client %d (%s). Message for group %d dropped.", c.User.ID, c.User.Username, hubMessage.GroupID)
+	}
+	return true
+}
+
+// editMessage replaces the content of one of the client's own messages. The
+// edited message reaches the group as a "message_edited" event; rejections
+// come back as an error frame.
+func (c *Client) editMessage(hub *Hub, data []byte) {
+	var edit ClientSentE2EMessage
+	if err := json.Unmarshal(data, &edit); err != nil {
+		log.Printf("Client %s (%s): Malformed edit: %v. Discarding.", c.User.ID, c.User.Username, err)
+		return
+	}
+
+	rejection, err := hub.EditMessage(c.ctx, c.User.ID, c.deviceID, &edit)
+	if err != nil {
+		log.Printf("Client %s (%s): Error editing message %s: %v", c.User.ID, c.User.Username, edit.ID, err)
+		return
+	}
+	if rejection != nil {
+		log.Printf("Client %s (%s): edit of message %s rejected: %s", c.User.ID, c.User.Username, edit.ID, rejection.Message)
+		c.SendEvent(rejection)
+	}
+}
+
+// deleteMessage deletes a message for everyone in its group. The tombstone
+// reaches the group as a "message_deleted" event; rejections come back as an
+// error frame.
+func (c *Client) deleteMessage(hub *Hub, data []byte) {
+	var request ClientDeleteMessage
+	if err := json.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %s (%s): Malformed delete: %v. Discarding.", c.User.ID, c.User.Username, err)
+		return
+	}
+
+	rejection, err := hub.DeleteMessage(c.ctx, c.User.ID, request.ID)
+	if err != nil {
+		log.Printf("Client %s (%s): Error deleting message %s: %v", c.User.ID, c.User.Username, request.ID, err)
+		return
+	}
+	if rejection != nil {
+		log.Printf("Client %s (%s): delete of message %s rejected: %s", c.User.ID, c.User.Username, request.ID, rejection.Message)
+		c.SendEvent(rejection)
+	}
+}
+
+// reactToMessage adds or removes one of the client's reactions. The change
+// reaches the group as a "reaction_added" or "reaction_removed" event;
+// rejections come back as an error frame.
+func (c *Client) reactToMessage(hub *Hub, data []byte, add bool) {
+	var request ClientReaction
+	if err := json.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %s (%s): Malformed reaction: %v. Discarding.", c.User.ID, c.User.Username, err)
+		return
+	}
+
+	rejection, err := hub.ReactToMessage(c.ctx, c.User.ID, &request, add)
+	if err != nil {
+		log.Printf("Client %s (%s): Error updating reaction to message %s: %v", c.User.ID, c.User.Username, request.ID, err)
+		return
+	}
+	if rejection != nil {
+		log.Printf("Client %s (%s): reaction to message %s rejected: %s", c.User.ID, c.User.Username, request.ID, rejection.Message)
+		c.SendEvent(rejection)
+	}
+}
+
+// newRawMessage builds the hub message for a checked client message, keeping
+// only the key material of the message's mode: envelopes, a sender key or an
+// MLS epoch.
+func newRawMessage(msg *ClientSentE2EMessage, senderID uuid.UUID, senderDeviceID string) *RawMessageE2EE {
+	message := &RawMessageE2EE{
+		ID:          msg.ID,
+		GroupID:     msg.GroupID,
+		MessageType: msg.MessageType,
+		MsgNonce:    msg.MsgNonce,
+		Ciphertext:  msg.Ciphertext,
+		Envelopes:   msg.Envelopes,
+		SenderID:    senderID,
+	}
+	switch {
+	case msg.MLSEpoch != nil:
+		message.Envelopes = []Envelope{}
+		message.MLSEpoch = msg.MLSEpoch
+		message.SenderDeviceID = senderDeviceID
+	case msg.SenderKeyID != nil:
+		message.Envelopes = []Envelope{}
+		message.SenderKeyID = msg.SenderKeyID
+		message.SenderDeviceID = senderDeviceID
 	}
+	return message
 }
@@ -0,0 +1,233 @@
+package ws
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"chat-app-server/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	envelopeMismatchCode  = "stale_envelopes"
+	senderKeyMismatchCode = "stale_sender_key"
+	unknownSenderKeyCode  = "unknown_sender_key"
+	mlsEpochMismatchCode  = "stale_epoch"
+	mlsNotEnabledCode     = "mls_not_enabled"
+)
+
+var errUnknownSenderKey = errors.New("sender key does not belong to this device and group")
+
+// CheckMessageKeys makes sure a message can be read by exactly the group's
+// current devices before it is stored. MLS groups only take application
+// messages for the current epoch; other groups take sender-key or envelope
+// messages. It returns the error frame to send back when the message must be
+// rejected.
+func (h *Hub) CheckMessageKeys(ctx context.Context, senderID uuid.UUID, senderDeviceID string, msg *ClientSentE2EMessage) (*ServerEvent, error) {
+	mlsGroup, err := h.db.GetMLSGroup(ctx, msg.GroupID)
+	usesMLS := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	switch {
+	case usesMLS:
+		if msg.MLSEpoch == nil || *msg.MLSEpoch != mlsGroup.Epoch {
+			return &ServerEvent{
+				Type:    "error",
+				Message: "Message was not encrypted for the group's current MLS epoch",
+				Payload: &MLSEpochMismatchPayload{
+					Code:      mlsEpochMismatchCode,
+					MessageID: msg.ID,
+					GroupID:   msg.GroupID,
+					Epoch:     &mlsGroup.Epoch,
+				},
+			}, nil
+		}
+		return nil, nil
+	case msg.MLSEpoch != nil:
+		return &ServerEvent{
+			Type:    "error",
+			Message: "Group does not use MLS",
+			Payload: &MLSEpochMismatchPayload{
+				Code:      mlsNotEnabledCode,
+				MessageID: msg.ID,
+				GroupID:   msg.GroupID,
+			},
+		}, nil
+	}
+
+	var mismatch *EnvelopeMismatchPayload
+	if msg.SenderKeyID != nil {
+		mismatch, err = h.CheckSenderKey(ctx, msg.GroupID, senderID, senderDeviceID, *msg.SenderKeyID)
+	} else {
+		mismatch, err = h.CheckEnvelopes(ctx, msg.GroupID, msg.Envelopes)
+	}
+	if errors.Is(err, errUnknownSenderKey) {
+		return &ServerEvent{
+			Type:    "error",
+			Message: "Sender key was not distributed from this device for this group",
+			Payload: &EnvelopeMismatchPayload{
+				Code:           unknownSenderKeyCode,
+				MessageID:      msg.ID,
+				GroupID:        msg.GroupID,
+				MissingDevices: []EnvelopeRecipient{},
+				ExtraDevices:   []EnvelopeRecipient{},
+			},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mismatch != nil {
+		mismatch.MessageID = msg.ID
+		return &ServerEvent{
+			Type:    "error",
+			Message: "Message recipients do not match the group's current devices",
+			Payload: mismatch,
+		}, nil
+	}
+	return nil, nil
+}
+
+// CheckEnvelopes compares the devices a message was encrypted for with the
+// group's current device keys. It returns nil when they match exactly, or the
+// devices the sender missed and the ones it shouldn't have included (removed
+// devices or devices of users no longer in the group).
+func (h *Hub) CheckEnvelopes(ctx context.Context, groupID uuid.UUID, envelopes []Envelope) (*EnvelopeMismatchPayload, error) {
+	devices, err := h.db.GetGroupDeviceIdentifiers(ctx, &groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	covered := make([]EnvelopeRecipient, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		covered = append(covered, EnvelopeRecipient{UserID: envelope.UserID, DeviceID: envelope.DeviceID})
+	}
+	return deviceMismatch(envelopeMismatchCode, groupID, devices, covered), nil
+}
+
+// CheckSenderKey checks that a sender key belongs to the sending device and
+// group, was distributed to every other current device in the group, and was
+// never given to a device that has since left it. Anything else means the
+// sender has to distribute the key further or rotate it.
+func (h *Hub) CheckSenderKey(ctx context.Context, groupID uuid.UUID, senderID uuid.UUID, senderDeviceID string, keyID uuid.UUID) (*EnvelopeMismatchPayload, error) {
+	senderKey, err := h.db.GetSenderKey(ctx, keyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errUnknownSenderKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if senderKey.GroupID != groupID || senderKey.SenderID != senderID || senderKey.SenderDeviceID != senderDeviceID {
+		return nil, errUnknownSenderKey
+	}
+
+	devices, err := h.db.GetGroupDeviceIdentifiers(ctx, &groupID)
+	if err != nil {
+		return nil, err
+	}
+	recipients, err := h.db.GetSenderKeyRecipients(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make([]db.GetGroupDeviceIdentifiersRow, 0, len(devices))
+	for _, device := range devices {
+		if device.UserID != senderID || device.DeviceIdentifier != senderDeviceID {
+			expected = append(expected, device)
+		}
+	}
+	covered := make([]EnvelopeRecipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		covered = append(covered, EnvelopeRecipient{UserID: recipient.RecipientUserID, DeviceID: recipient.RecipientDeviceID})
+	}
+	return deviceMismatch(senderKeyMismatchCode, groupID, expected, covered), nil
+}
+
+// deviceMismatch lists the expected devices missing from covered and the
+// covered devices that weren't expected, or returns nil if there are none.
+// Devices are matched on user and device identifier together.
+func deviceMismatch(code string, groupID uuid.UUID, expected []db.GetGroupDeviceIdentifiersRow, covered []EnvelopeRecipient) *EnvelopeMismatchPayload {
+	remaining := make(map[EnvelopeRecipient]bool, len(covered))
+	for _, recipient := range covered {
+		remaining[recipient] = true
+	}
+
+	mismatch := &EnvelopeMismatchPayload{
+		Code:           code,
+		GroupID:        groupID,
+		MissingDevices: []EnvelopeRecipient{},
+		ExtraDevices:   []EnvelopeRecipient{},
+	}
+	for _, device := range expected {
+		recipient := EnvelopeRecipient{UserID: device.UserID, DeviceID: device.DeviceIdentifier}
+		if remaining[recipient] {
+			delete(remaining, recipient)
+			continue
+		}
+		mismatch.MissingDevices = append(mismatch.MissingDevices, recipient)
+	}
+	for _, recipient := range covered {
+		if remaining[recipient] {
+			delete(remaining, recipient)
+			mismatch.ExtraDevices = append(mismatch.ExtraDevices, recipient)
+		}
+	}
+
+	if len(mismatch.MissingDevices) == 0 && len(mismatch.ExtraDevices) == 0 {
+		return nil
+	}
+	return mismatch
+}
+
+// envelopeParams decodes a message's envelopes into message_envelopes rows. A
+// device listed twice keeps its first envelope.
+func envelopeParams(messageID uuid.UUID, envelopes []Envelope) ([]db.InsertMessageEnvelopeParams, error) {
+	params := make([]db.InsertMessageEnvelopeParams, 0, len(envelopes))
+	seen := make(map[EnvelopeRecipient]bool, len(envelopes))
+	for _, envelope := range envelopes {
+		recipient := EnvelopeRecipient{UserID: envelope.UserID, DeviceID: envelope.DeviceID}
+		if seen[recipient] {
+			continue
+		}
+		seen[recipient] = true
+
+		ephPubKey, err := base64.StdEncoding.DecodeString(envelope.EphPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("ephPubKey for device %s: %w", envelope.DeviceID, err)
+		}
+		keyNonce, err := base64.StdEncoding.DecodeString(envelope.KeyNonce)
+		if err != nil {
+			return nil, fmt.Errorf("keyNonce for device %s: %w", envelope.DeviceID, err)
+		}
+		sealedKey, err := base64.StdEncoding.DecodeString(envelope.SealedKey)
+		if err != nil {
+			return nil, fmt.Errorf("sealedKey for device %s: %w", envelope.DeviceID, err)
+		}
+		params = append(params, db.InsertMessageEnvelopeParams{
+			MessageID: messageID,
+			UserID:    envelope.UserID,
+			DeviceID:  envelope.DeviceID,
+			EphPubKey: ephPubKey,
+			KeyNonce:  keyNonce,
+			SealedKey: sealedKey,
+		})
+	}
+	return params, nil
+}
+
+// envelopesForDevice keeps only the envelope sealed to the user's deviceID, so
+// a client never downloads its peers' sealed keys. The result is never nil.
+func envelopesForDevice(envelopes []Envelope, userID uuid.UUID, deviceID string) []Envelope {
+	for _, envelope := range envelopes {
+		if envelope.UserID == userID && envelope.DeviceID == deviceID && deviceID != "" {
+			return []Envelope{envelope}
+		}
+	}
+	return []Envelope{}
+}
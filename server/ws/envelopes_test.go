@@ -0,0 +1,119 @@
+package ws
+
+import (
+	"testing"
+
+	"chat-app-server/db"
+
+	"github.com/google/uuid"
+)
+
+func TestDeviceMismatch(t *testing.T) {
+	groupID := uuid.New()
+	alice := uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	bob := uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	// Both accounts have used the same install, so they share an identifier.
+	expected := []db.GetGroupDeviceIdentifiersRow{
+		{UserID: alice, DeviceIdentifier: "shared"},
+		{UserID: bob, DeviceIdentifier: "shared"},
+		{UserID: bob, DeviceIdentifier: "laptop"},
+	}
+
+	tests := []struct {
+		name        string
+		covered     []EnvelopeRecipient
+		wantMissing []EnvelopeRecipient
+		wantExtra   []EnvelopeRecipient
+	}{
+		{
+			name: "every device",
+			covered: []EnvelopeRecipient{
+				{UserID: bob, DeviceID: "laptop"},
+				{UserID: alice, DeviceID: "shared"},
+				{UserID: bob, DeviceID: "shared"},
+			},
+		},
+		{
+			name: "shared identifier covered for one user only",
+			covered: []EnvelopeRecipient{
+				{UserID: alice, DeviceID: "shared"},
+				{UserID: bob, DeviceID: "laptop"},
+			},
+			wantMissing: []EnvelopeRecipient{{UserID: bob, DeviceID: "shared"}},
+		},
+		{
+			name: "device of the wrong user",
+			covered: []EnvelopeRecipient{
+				{UserID: alice, DeviceID: "shared"},
+				{UserID: bob, DeviceID: "shared"},
+				{UserID: alice, DeviceID: "laptop"},
+			},
+			wantMissing: []EnvelopeRecipient{{UserID: bob, DeviceID: "laptop"}},
+			wantExtra:   []EnvelopeRecipient{{UserID: alice, DeviceID: "laptop"}},
+		},
+		{
+			name: "duplicate envelope",
+			covered: []EnvelopeRecipient{
+				{UserID: alice, DeviceID: "shared"},
+				{UserID: alice, DeviceID: "shared"},
+				{UserID: bob, DeviceID: "shared"},
+				{UserID: bob, DeviceID: "laptop"},
+			},
+		},
+		{
+			name:        "nothing",
+			covered:     []EnvelopeRecipient{},
+			wantMissing: []EnvelopeRecipient{{UserID: alice, DeviceID: "shared"}, {UserID: bob, DeviceID: "shared"}, {UserID: bob, DeviceID: "laptop"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatch := deviceMismatch(envelopeMismatchCode, groupID, expected, tt.covered)
+			if tt.wantMissing == nil && tt.wantExtra == nil {
+				if mismatch != nil {
+					t.Fatalf("deviceMismatch = %+v, want nil", mismatch)
+				}
+				return
+			}
+			if mismatch == nil {
+				t.Fatal("deviceMismatch = nil, want a mismatch")
+			}
+			if !sameRecipients(mismatch.MissingDevices, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", mismatch.MissingDevices, tt.wantMissing)
+			}
+			if !sameRecipients(mismatch.ExtraDevices, tt.wantExtra) {
+				t.Errorf("extra = %v, want %v", mismatch.ExtraDevices, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestEnvelopesForDevice(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	envelopes := []Envelope{
+		{UserID: alice, DeviceID: "shared", SealedKey: "for alice"},
+		{UserID: bob, DeviceID: "shared", SealedKey: "for bob"},
+	}
+
+	if got := envelopesForDevice(envelopes, bob, "shared"); len(got) != 1 || got[0].SealedKey != "for bob" {
+		t.Errorf("envelopesForDevice(bob) = %v, want bob's envelope", got)
+	}
+	if got := envelopesForDevice(envelopes, uuid.New(), "shared"); got == nil || len(got) != 0 {
+		t.Errorf("envelopesForDevice(other user) = %v, want empty", got)
+	}
+	if got := envelopesForDevice(envelopes, alice, ""); got == nil || len(got) != 0 {
+		t.Errorf("envelopesForDevice(no device) = %v, want empty", got)
+	}
+}
+
+func sameRecipients(got []EnvelopeRecipient, want []EnvelopeRecipient) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
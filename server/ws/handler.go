@@ -24,14 +24,15 @@ import (
 )
 
 type Handler struct {
-	hub  *Hub
-	db   *db.Queries
-	ctx  context.Context
-	conn *pgxpool.Pool
+	hub         *Hub
+	db          *db.Queries
+	ctx         context.Context
+	conn        *pgxpool.Pool
+	revocations *auth.RevocationStore
 }
 
-func NewHandler(h *Hub, db *db.Queries, ctx context.Context, conn *pgxpool.Pool) *Handler {
-	return &Handler{hub: h, db: db, ctx: ctx, conn: conn}
+func NewHandler(h *Hub, db *db.Queries, ctx context.Context, conn *pgxpool.Pool, revocations *auth.RevocationStore) *Handler {
+	return &Handler{hub: h, db: db, ctx: ctx, conn: conn, revocations: revocations}
 }
 
 var upgrader = websocket.Upgrader{
@@ -74,6 +75,7 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 
 	var userID uuid.UUID
 	var user *db.GetUserByIdRow
+	var claims *auth.Claims
 	isAuthenticated := false
 
 	if err := conn.SetReadDeadline(time.Now().Add(authTimeout)); err != nil {
@@ -109,12 +111,22 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 	if messageType == websocket.TextMessage {
 		var authMsg AuthMessage
 		if err := json.Unmarshal(messageBytes, &authMsg); err == nil && authMsg.Type == "auth" {
-			extractedUserID, validationErr := auth.ValidateToken(authMsg.Token)
+			extractedClaims, validationErr := auth.ParseToken(authMsg.Token)
 			if validationErr == nil {
+				revoked, revokedErr := h.revocations.IsRevoked(requestCtx, extractedClaims)
+				if revokedErr != nil || revoked {
+					log.Printf("Authentication failed (token revoked or revocation check failed): %v", revokedErr)
+					response := ServerResponseMessage{Type: "auth_failure", Error: auth.ErrTokenRevoked.Error()}
+					conn.WriteJSON(response)
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Authentication failed"))
+					return
+				}
+				extractedUserID := extractedClaims.UserID
 				fetchedUser, dbErr := h.db.GetUserById(requestCtx, extractedUserID)
 				if dbErr == nil {
 					userID = extractedUserID
 					user = &fetchedUser
+					claims = extractedClaims
 					isAuthenticated = true
 					log.Printf("User %s (%s) authenticated successfully via WebSocket.", userID.String(), user.Username)
 					response := ServerResponseMessage{Type: "auth_success", Message: "Authentication successful"}
@@ -156,7 +168,14 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 		return
 	}
 
-	client := NewClient(conn, user)
+	client := NewClient(conn, user, claims)
+	if familyID, err := uuid.Parse(claims.SessionID); err == nil {
+		deviceID, err := h.db.GetSessionFamilyDeviceIdentifier(requestCtx, familyID)
+		if err != nil {
+			log.Printf("Could not resolve device for client %s (%s): %v", client.User.ID.String(), client.User.Username, err)
+		}
+		client.deviceID = deviceID
+	}
 	log.Printf("Client %s (%s) connected. Remote: %s", client.User.ID.String(), client.User.Username, conn.RemoteAddr())
 
 	h.hub.Register <- client
@@ -515,6 +534,7 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 	updateParams.Location = util.NullablePgText(req.Location)
 	updateParams.ImageUrl = util.NullablePgText(req.ImageUrl)
 	updateParams.Blurhash = util.NullablePgText(req.Blurhash)
+	updateParams.EncryptedReactions = util.NullablePgBool(req.EncryptedReactions)
 
 	_, err = h.db.UpdateGroup(ctx, updateParams)
 	if err != nil {
@@ -584,11 +604,12 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 	}
 
 	responseClientGroup := ClientGroup{
-		ID:         fullGroupData.ID,
-		Name:       fullGroupData.Name,
-		CreatedAt:  fullGroupData.CreatedAt.Time,
-		UpdatedAt:  fullGroupData.UpdatedAt.Time,
-		GroupUsers: clientGroupUsers,
+		ID:                 fullGroupData.ID,
+		Name:               fullGroupData.Name,
+		CreatedAt:          fullGroupData.CreatedAt.Time,
+		UpdatedAt:          fullGroupData.UpdatedAt.Time,
+		EncryptedReactions: fullGroupData.EncryptedReactions,
+		GroupUsers:         clientGroupUsers,
 	}
 
 	if fullGroupData.StartTime.Valid {
@@ -735,20 +756,41 @@ func (h *Handler) LeaveGroup(c *gin.Context) {
 
 	qtx := h.db.WithTx(tx)
 
-	deletedUserGroup, err := qtx.DeleteUserGroup(ctx, db.DeleteUserGroupParams{
-		UserID:  &user.ID,
-		GroupID: &groupID,
-	})
+	deletedUserGroup, groupIsEmpty, err := LeaveGroupTx(ctx, qtx, user.ID, groupID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
 		} else {
-			log.Printf("Error deleting user_group link for user %d, group %d: %v", user.ID, groupID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from group"})
 		}
 		return
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit transaction for leaving group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize leaving group"})
+		return
+	}
+
+	h.hub.NotifyUserLeftGroup(ctx, user.ID, groupID, groupIsEmpty)
+	c.JSON(http.StatusOK, deletedUserGroup)
+}
+
+// LeaveGroupTx removes the user from the group within the caller's
+// transaction. An emptied group is deleted; if the last admin left, a
+// remaining member is promoted. It reports whether the group was deleted.
+func LeaveGroupTx(ctx context.Context, qtx *db.Queries, userID uuid.UUID, groupID uuid.UUID) (db.DeleteUserGroupRow, bool, error) {
+	deletedUserGroup, err := qtx.DeleteUserGroup(ctx, db.DeleteUserGroupParams{
+		UserID:  &userID,
+		GroupID: &groupID,
+	})
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error deleting user_group link for user %d, group %d: %v", userID, groupID, err)
+		}
+		return db.DeleteUserGroupRow{}, false, err
+	}
+
 	remainingUserGroups, err := qtx.GetAllUserGroupsForGroup(ctx, &groupID)
 	groupIsEmpty := false
 	if err != nil {
@@ -756,8 +798,7 @@ func (h *Handler) LeaveGroup(c *gin.Context) {
 			groupIsEmpty = true
 		} else {
 			log.Printf("Error retrieving remaining user_groups for group %d: %v", groupID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group status after leaving"})
-			return
+			return db.DeleteUserGroupRow{}, false, err
 		}
 	} else if len(remainingUserGroups) == 0 {
 		groupIsEmpty = true
@@ -766,10 +807,9 @@ func (h *Handler) LeaveGroup(c *gin.Context) {
 	if groupIsEmpty {
 		if _, err = qtx.DeleteGroup(ctx, groupID); err != nil {
 			log.Printf("Error deleting empty group %d: %v", groupID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clean up empty group"})
-			return
+			return db.DeleteUserGroupRow{}, false, err
 		}
-		log.Printf("Group %d deleted as it became empty after user %d left.", groupID, user.ID)
+		log.Printf("Group %d deleted as it became empty after user %d left.", groupID, userID)
 	} else {
 		if deletedUserGroup.Admin {
 			anyAdminLeft := false
@@ -787,42 +827,14 @@ func (h *Handler) LeaveGroup(c *gin.Context) {
 				}
 				if _, err = qtx.UpdateUserGroup(ctx, promoteParams); err != nil {
 					log.Printf("Error promoting new admin for group %d: %v", groupID, err)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign new admin"})
-					return
+					return db.DeleteUserGroupRow{}, false, err
 				}
 				log.Printf("User %d promoted to admin in group %d.", remainingUserGroups[0].UserID, groupID)
 			}
 		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		log.Printf("Failed to commit transaction for leaving group: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize leaving group"})
-		return
-	}
-
-	select {
-	case h.hub.RemoveUserFromGroupChan <- &RemoveClientFromGroupMsg{UserID: user.ID, GroupID: groupID}:
-		log.Printf("Sent request to hub to process user %d removal from group %d state", user.ID, groupID)
-	case <-ctx.Done():
-		log.Printf("Context cancelled while trying to send RemoveUserFromGroupChan for user %d, group %d", user.ID, groupID)
-		return
-	default:
-		log.Printf("Warning: Hub RemoveUserFromGroupChan full for user %d group %d. Update might be delayed or dropped.", user.ID, groupID)
-	}
-
-	if groupIsEmpty {
-		select {
-		case h.hub.DeleteHubGroupChan <- &DeleteHubGroupMsg{GroupID: groupID}:
-			log.Printf("Sent request to hub to delete empty group %d state", groupID)
-		case <-ctx.Done():
-			log.Printf("Context cancelled while trying to send DeleteHubGroupChan for group %d", groupID)
-			return
-		default:
-			log.Printf("Warning: Hub DeleteHubGroupChan full for group %d. Deletion might be delayed or dropped.", groupID)
-		}
-	}
-	c.JSON(http.StatusOK, deletedUserGroup)
+	return deletedUserGroup, groupIsEmpty, nil
 }
 
 func (h *Handler) GetRelevantUsers(c *gin.Context) {
@@ -849,6 +861,13 @@ func (h *Handler) GetRelevantUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
+// GetRelevantMessages pages through the messages of the caller's groups in
+// (created_at, id) order. ?since= resumes after a cursor from an earlier
+// response, ?group_id= narrows it to one group and ?limit= sets the page
+// size. next_cursor points after the last message returned, so clients keep
+// it for their next incremental sync; has_more says whether to fetch again
+// right away. changes_cursor goes back as ?changes_since= so edits and
+// tombstones are only listed once; without it they start from ?since=.
 func (h *Handler) GetRelevantMessages(c *gin.Context) {
 	ctx := c.Request.Context()
 	user, err := util.GetUser(c, h.db)
@@ -857,49 +876,275 @@ func (h *Handler) GetRelevantMessages(c *gin.Context) {
 		return
 	}
 
-	dbMessages, err := h.db.GetRelevantMessages(ctx, user.ID)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusOK, []RawMessageE2EE{}) // Send empty slice
+	since, ok := messageCursorFromQuery(c, "since")
+	if !ok {
+		return
+	}
+	changesSince, ok := messageCursorFromQuery(c, "changes_since")
+	if !ok {
+		return
+	}
+	limit, ok := messagePageSize(c)
+	if !ok {
+		return
+	}
+	params := db.GetRelevantMessagesParams{UserID: user.ID, MaxMessages: limit + 1}
+	if groupIDParam := c.Query("group_id"); groupIDParam != "" {
+		groupID, err := uuid.Parse(groupIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
 			return
 		}
-		log.Printf("Error retrieving relevant E2EE messages for user %d: %v", user.ID, err)
+		params.GroupID = &groupID
+	}
+	if since != nil {
+		params.AfterCreatedAt = since.Timestamp()
+		params.AfterID = &since.ID
+	}
+
+	params.DeviceID = h.envelopeDeviceIdentifier(c, user.ID)
+
+	dbMessages, err := h.db.GetRelevantMessages(ctx, params)
+	if err != nil {
+		log.Printf("Error retrieving relevant E2EE messages for user %s: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve relevant messages"})
 		return
 	}
 
-	messagesToClient := make([]RawMessageE2EE, 0, len(dbMessages))
-	for _, dbMsg := range dbMessages {
-		var envelopes []Envelope
-		if len(dbMsg.KeyEnvelopes) > 0 {
-			if err := json.Unmarshal(dbMsg.KeyEnvelopes, &envelopes); err != nil {
-				log.Printf("Error unmarshalling key_envelopes for message %s: %v", dbMsg.ID, err)
-				continue
-			}
+	page := MessagePage{
+		Messages:   make([]RawMessageE2EE, 0, min(len(dbMessages), int(limit))),
+		Edits:      []RawMessageE2EE{},
+		Tombstones: []RawMessageE2EE{},
+	}
+	if len(dbMessages) > int(limit) {
+		dbMessages = dbMessages[:limit]
+		page.HasMore = true
+	}
+	if since != nil {
+		nextCursor := since.String()
+		page.NextCursor = &nextCursor
+
+		changedAfter := *since
+		if changesSince != nil {
+			changedAfter = *changesSince
+		}
+		if err := h.addMessageChanges(ctx, &page, params, *since, changedAfter, limit); err != nil {
+			log.Printf("Error retrieving edited and deleted messages for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve relevant messages"})
+			return
 		}
+	} else if err := h.startMessageChanges(ctx, &page); err != nil {
+		log.Printf("Error starting changes watermark for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve relevant messages"})
+		return
+	}
+	for _, dbMsg := range dbMessages {
+		nextCursor := newMessageCursor(dbMsg.Timestamp, dbMsg.ID).String()
+		page.NextCursor = &nextCursor
+		page.Messages = append(page.Messages, toRawMessage(dbMsg, params.UserID, params.DeviceID))
+	}
+	if err := h.addReactions(ctx, page.Messages); err != nil {
+		log.Printf("Error retrieving reactions for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve relevant messages"})
+		return
+	}
+	if err := h.addReactions(ctx, page.Edits); err != nil {
+		log.Printf("Error retrieving reactions for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve relevant messages"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetGroupMessages loads one group's history a page at a time for lazy
+// scrolling. Without a cursor it returns the newest page; ?before= pages back
+// through older messages and ?after= forward through newer ones. Messages are
+// always in (created_at, id) order; older_cursor and newer_cursor bracket the
+// page and has_more applies to the direction requested. Members only see
+// messages sent after they joined.
+func (h *Handler) GetGroupMessages(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	isMember, err := util.UserInGroup(ctx, user.ID, groupID, h.db)
+	if err != nil {
+		log.Printf("Error checking membership of user %s in group %s: %v", user.ID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group membership"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this group"})
+		return
+	}
 
-		senderID := dbMsg.SenderID
-		if *senderID == uuid.Nil {
-			log.Printf("Warning: Message %s has NULL UserID in DB", dbMsg.ID)
-			continue
+	before, ok := messageCursorFromQuery(c, "before")
+	if !ok {
+		return
+	}
+	after, ok := messageCursorFromQuery(c, "after")
+	if !ok {
+		return
+	}
+	if before != nil && after != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use either before or after, not both"})
+		return
+	}
+	limit, ok := messagePageSize(c)
+	if !ok {
+		return
+	}
+	deviceID := h.envelopeDeviceIdentifier(c, user.ID)
+
+	var dbMessages []db.GetRelevantMessagesRow
+	if after != nil {
+		rows, err := h.db.GetMessagesForGroupAfter(ctx, db.GetMessagesForGroupAfterParams{
+			UserID:         &user.ID,
+			DeviceID:       deviceID,
+			GroupID:        &groupID,
+			AfterCreatedAt: after.Timestamp(),
+			AfterID:        after.ID,
+			MaxMessages:    limit + 1,
+		})
+		if err != nil {
+			log.Printf("Error retrieving messages of group %s for user %s: %v", groupID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+			return
 		}
+		for _, row := range rows {
+			dbMessages = append(dbMessages, db.GetRelevantMessagesRow(row))
+		}
+	} else {
+		params := db.GetMessagesForGroupBeforeParams{
+			UserID:      &user.ID,
+			DeviceID:    deviceID,
+			GroupID:     &groupID,
+			MaxMessages: limit + 1,
+		}
+		if before != nil {
+			params.BeforeCreatedAt = before.Timestamp()
+			params.BeforeID = &before.ID
+		}
+		rows, err := h.db.GetMessagesForGroupBefore(ctx, params)
+		if err != nil {
+			log.Printf("Error retrieving messages of group %s for user %s: %v", groupID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+			return
+		}
+		// Newest first from the query; flip back into chronological order.
+		for i := len(rows) - 1; i >= 0; i-- {
+			dbMessages = append(dbMessages, db.GetRelevantMessagesRow(rows[i]))
+		}
+	}
 
-		groupID := dbMsg.GroupID
-		if *groupID == uuid.Nil {
-			log.Printf("Warning: Message %s has NULL GroupID in DB", dbMsg.ID)
-			continue
+	page := GroupMessagePage{}
+	if len(dbMessages) > int(limit) {
+		page.HasMore = true
+		if after != nil {
+			dbMessages = dbMessages[:limit]
+		} else {
+			dbMessages = dbMessages[1:]
 		}
+	}
+	page.Messages = make([]RawMessageE2EE, 0, len(dbMessages))
+	for _, dbMsg := range dbMessages {
+		page.Messages = append(page.Messages, toRawMessage(dbMsg, user.ID, deviceID))
+	}
+	if err := h.addReactions(ctx, page.Messages); err != nil {
+		log.Printf("Error retrieving reactions for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
 
-		messagesToClient = append(messagesToClient, RawMessageE2EE{
-			ID:          dbMsg.ID,
-			GroupID:     *groupID,
-			SenderID:    *senderID,
-			MsgNonce:    base64.StdEncoding.EncodeToString(dbMsg.MsgNonce),
-			Ciphertext:  base64.StdEncoding.EncodeToString(dbMsg.Ciphertext),
-			MessageType: dbMsg.MessageType,
-			Timestamp:   dbMsg.Timestamp.Time.Format(time.RFC3339Nano),
-			Envelopes:   envelopes,
+	if len(dbMessages) > 0 {
+		oldest, newest := dbMessages[0], dbMessages[len(dbMessages)-1]
+		olderCursor := newMessageCursor(oldest.Timestamp, oldest.ID).String()
+		newerCursor := newMessageCursor(newest.Timestamp, newest.ID).String()
+		page.OlderCursor, page.NewerCursor = &olderCursor, &newerCursor
+	} else if after != nil {
+		newerCursor := after.String()
+		page.NewerCursor = &newerCursor
+	} else if before != nil {
+		olderCursor := before.String()
+		page.OlderCursor = &olderCursor
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// envelopeDeviceIdentifier is the device whose envelopes a message listing
+// should include. Sessions without a device (e.g. personal access tokens)
+// have none to open, so they get an empty identifier that matches nothing.
+func (h *Handler) envelopeDeviceIdentifier(c *gin.Context, userID uuid.UUID) string {
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error resolving device for user %s, returning messages without envelopes: %v", userID, err)
+	}
+	return deviceID
+}
+
+// toRawMessage converts a stored message into the wire format, with the
+// envelope for the user's deviceID if the row has one.
+func toRawMessage(dbMsg db.GetRelevantMessagesRow, userID uuid.UUID, deviceID string) RawMessageE2EE {
+	envelopes := []Envelope{}
+	if dbMsg.SealedKey != nil {
+		envelopes = append(envelopes, Envelope{
+			UserID:    userID,
+			DeviceID:  deviceID,
+			EphPubKey: base64.StdEncoding.EncodeToString(dbMsg.EphPubKey),
+			KeyNonce:  base64.StdEncoding.EncodeToString(dbMsg.KeyNonce),
+			SealedKey: base64.StdEncoding.EncodeToString(dbMsg.SealedKey),
 		})
 	}
-	c.JSON(http.StatusOK, messagesToClient)
+
+	var mlsEpoch *int64
+	if dbMsg.MlsEpoch.Valid {
+		mlsEpoch = &dbMsg.MlsEpoch.Int64
+	}
+
+	message := RawMessageE2EE{
+		ID:             dbMsg.ID,
+		GroupID:        *dbMsg.GroupID,
+		MsgNonce:       base64.StdEncoding.EncodeToString(dbMsg.MsgNonce),
+		Ciphertext:     base64.StdEncoding.EncodeToString(dbMsg.Ciphertext),
+		MessageType:    dbMsg.MessageType,
+		Timestamp:      dbMsg.Timestamp.Time.Format(time.RFC3339Nano),
+		Envelopes:      envelopes,
+		SenderKeyID:    dbMsg.SenderKeyID,
+		MLSEpoch:       mlsEpoch,
+		SenderDeviceID: dbMsg.SenderDeviceID.String,
+	}
+	// Messages of deleted accounts keep their content but lose their sender.
+	if dbMsg.SenderID != nil {
+		message.SenderID = *dbMsg.SenderID
+	}
+	// updated_at only moves past created_at when the message is edited or
+	// deleted.
+	if dbMsg.DeletedAt.Valid {
+		message.DeletedAt = dbMsg.DeletedAt.Time.Format(time.RFC3339Nano)
+	} else if dbMsg.UpdatedAt.Time.After(dbMsg.Timestamp.Time) {
+		message.EditedAt = dbMsg.UpdatedAt.Time.Format(time.RFC3339Nano)
+	}
+	return message
+}
+
+func toTombstone(dbMsg db.GetMessageTombstonesRow) RawMessageE2EE {
+	tombstone := RawMessageE2EE{
+		ID:          dbMsg.ID,
+		GroupID:     *dbMsg.GroupID,
+		MessageType: dbMsg.MessageType,
+		Timestamp:   dbMsg.Timestamp.Time.Format(time.RFC3339Nano),
+		Envelopes:   []Envelope{},
+		DeletedAt:   dbMsg.DeletedAt.Time.Format(time.RFC3339Nano),
+	}
+	if dbMsg.SenderID != nil {
+		tombstone.SenderID = *dbMsg.SenderID
+	}
+	return tombstone
 }
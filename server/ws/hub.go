@@ -13,6 +13,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
@@ -69,6 +70,34 @@ type GroupUpdateEventPayload struct {
 	Name    string    `json:"name,omitempty"`
 }
 
+type ClientRevokedPayload struct {
+	UserID    uuid.UUID `json:"user_id"`
+	TokenID   string    `json:"token_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+}
+
+type DeviceKeysChangedPayload struct {
+	UserID                   uuid.UUID   `json:"user_id"`
+	GroupIDs                 []uuid.UUID `json:"group_ids"`
+	RemovedDeviceIdentifiers []string    `json:"removed_device_identifiers,omitempty"`
+}
+
+// GroupClientEventPayload carries a ServerEvent for a group's clients across
+// instances; Recipients narrows it to clients connected from those devices.
+type GroupClientEventPayload struct {
+	GroupID    uuid.UUID           `json:"group_id"`
+	Recipients []EnvelopeRecipient `json:"recipients,omitempty"`
+	Event      ServerEvent         `json:"event"`
+}
+
+// UserClientEventPayload carries a ServerEvent for one user's connection to
+// the instance holding it; DeviceID narrows it to a connection from that device.
+type UserClientEventPayload struct {
+	UserID   uuid.UUID   `json:"user_id"`
+	DeviceID string      `json:"device_id,omitempty"`
+	Event    ServerEvent `json:"event"`
+}
+
 type Hub struct {
 	Clients                 map[uuid.UUID]*Client
 	Groups                  map[uuid.UUID]*Group
@@ -86,6 +115,9 @@ type Hub struct {
 	db                      *db.Queries
 	pgxPool                 *pgxpool.Pool
 	ctx                     context.Context
+	// editWindow is how long after sending a message its sender may edit it;
+	// zero means no limit.
+	editWindow time.Duration
 }
 
 const (
@@ -97,6 +129,7 @@ const (
 
 	pubSubGroupMessagesChannel = "group_messages"
 	pubSubGroupEventsChannel   = "group_events"
+	pubSubServerEventsChannel  = "server_events"
 )
 
 func NewHub(
@@ -122,6 +155,7 @@ func NewHub(
 		db:                      dbQueries,
 		pgxPool:                 conn,
 		ctx:                     ctx,
+		editWindow:              messageEditWindowFromEnv(),
 	}
 
 	// Populate Redis from DB on startup
@@ -144,7 +178,8 @@ func NewHub(
 
 func (h *Hub) listenPubSub() {
 	groupMessagesPattern := pubSubGroupMessagesChannel + ":*"
-	pubsub := h.redisClient.Subscribe(h.ctx, pubSubGroupEventsChannel)
+	serverEventsChannel := pubSubServerEventsChannel + ":" + h.serverID
+	pubsub := h.redisClient.Subscribe(h.ctx, pubSubGroupEventsChannel, serverEventsChannel)
 	if err := pubsub.PUnsubscribe(h.ctx); err != nil {
 		log.Printf("Hub %s: PUnsubscribe failed", h.serverID)
 		return
@@ -186,6 +221,20 @@ func (h *Hub) listenPubSub() {
 					continue
 				}
 				h.deliverChatMessage(payload.Message)
+			case "message_edited", "message_deleted":
+				var payload ChatMessagePayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Error decoding %s payload: %v", pubSubMsg.Type, err)
+					continue
+				}
+				h.deliverMessageEvent(pubSubMsg.Type, payload.Message)
+			case "reaction_added", "reaction_removed":
+				var payload ReactionEventPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Error decoding %s payload: %v", pubSubMsg.Type, err)
+					continue
+				}
+				h.deliverReactionEvent(pubSubMsg.Type, &payload)
 			case "user_added_to_group":
 				var payload UserGroupEventPayload
 				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
@@ -221,6 +270,34 @@ func (h *Hub) listenPubSub() {
 					continue
 				}
 				h.handleGroupUpdatedEvent(payload.GroupID, payload.Name)
+			case "client_revoked":
+				var payload ClientRevokedPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding client_revoked payload: %v", h.serverID, err)
+					continue
+				}
+				h.handleClientRevokedEvent(payload)
+			case "device_keys_changed":
+				var payload DeviceKeysChangedPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding device_keys_changed payload: %v", h.serverID, err)
+					continue
+				}
+				h.handleDeviceKeysChangedEvent(payload)
+			case "group_client_event":
+				var payload GroupClientEventPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding group_client_event payload: %v", h.serverID, err)
+					continue
+				}
+				h.handleGroupClientEvent(payload)
+			case "user_client_event":
+				var payload UserClientEventPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding user_client_event payload: %v", h.serverID, err)
+					continue
+				}
+				h.handleUserClientEvent(payload)
 			}
 		}
 	}
@@ -307,8 +384,10 @@ func (h *Hub) deliverChatMessage(message *RawMessageE2EE) {
 		h.mutex.RUnlock()
 
 		if stillConnected {
+			clientMessage := *message
+			clientMessage.Envelopes = envelopesForDevice(message.Envelopes, client.User.ID, client.deviceID)
 			select {
-			case client.Message <- message:
+			case client.Message <- &clientMessage:
 			default:
 				log.Printf("Hub %s: Client %s message channel full for group %s. E2EE Message ID %s dropped.", h.serverID, client.User.ID.String(), message.GroupID.String(), message.ID)
 			}
@@ -398,6 +477,240 @@ func (h *Hub) handleGroupUpdatedEvent(groupID uuid.UUID, newName string) {
 	}
 }
 
+func (h *Hub) handleClientRevokedEvent(payload ClientRevokedPayload) {
+	h.mutex.RLock()
+	client, ok := h.Clients[payload.UserID]
+	h.mutex.RUnlock()
+
+	if !ok {
+		return
+	}
+	revokesAll := payload.TokenID == "" && payload.SessionID == ""
+	if !revokesAll && !client.AuthenticatedWith(payload.TokenID, payload.SessionID) {
+		return
+	}
+	log.Printf("Hub %s: Closing connection for user %s after token revocation", h.serverID, payload.UserID.String())
+	client.Close("Token revoked")
+}
+
+// DisconnectRevokedClient closes the user's live connection if it was opened
+// with the revoked token or session. The instance holding the connection is
+// found through the client presence key and notified on its own channel.
+func (h *Hub) DisconnectRevokedClient(ctx context.Context, userID uuid.UUID, tokenID string, sessionID string) error {
+	clientKey := redisClientServerPrefix + userID.String() + ":server_id"
+	serverID, err := h.redisClient.Get(ctx, clientKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up server for client %s: %w", userID.String(), err)
+	}
+
+	payload := ClientRevokedPayload{UserID: userID, TokenID: tokenID, SessionID: sessionID}
+	if serverID == h.serverID {
+		h.handleClientRevokedEvent(payload)
+		return nil
+	}
+
+	pubSubEvt := PubSubMessage{Type: "client_revoked", Payload: payload, OriginServerID: h.serverID}
+	serializedEvt, err := json.Marshal(pubSubEvt)
+	if err != nil {
+		return fmt.Errorf("error marshalling client_revoked event: %w", err)
+	}
+	return h.redisClient.Publish(ctx, pubSubServerEventsChannel+":"+serverID, serializedEvt).Err()
+}
+
+// handleDeviceKeysChangedEvent tells every local client sharing a group with
+// the user to refetch their device keys. Clients in several of those groups
+// are notified once.
+func (h *Hub) handleDeviceKeysChangedEvent(payload DeviceKeysChangedPayload) {
+	event := &ServerEvent{Type: "device_keys_changed", Payload: payload}
+	notified := make(map[uuid.UUID]bool)
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, groupID := range payload.GroupIDs {
+		group, ok := h.Groups[groupID]
+		if !ok {
+			continue
+		}
+		group.mutex.RLock()
+		for clientID, client := range group.Clients {
+			if notified[clientID] {
+				continue
+			}
+			notified[clientID] = true
+			client.SendEvent(event)
+		}
+		group.mutex.RUnlock()
+	}
+}
+
+// PublishDeviceKeysChanged notifies the user's group peers on every instance
+// that the user's set of device keys changed.
+func (h *Hub) PublishDeviceKeysChanged(ctx context.Context, userID uuid.UUID, removedDeviceIdentifiers []string) error {
+	userGroupsKey := redisUserGroupsPrefix + userID.String() + ":groups"
+	groupIDsStr, err := h.redisClient.SMembers(ctx, userGroupsKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("error fetching groups for user %s: %w", userID.String(), err)
+	}
+
+	payload := DeviceKeysChangedPayload{UserID: userID, GroupIDs: make([]uuid.UUID, 0, len(groupIDsStr)), RemovedDeviceIdentifiers: removedDeviceIdentifiers}
+	for _, groupIDStr := range groupIDsStr {
+		groupID, err := uuid.Parse(groupIDStr)
+		if err != nil {
+			log.Printf("Hub %s: Error converting groupID %q to uuid: %v", h.serverID, groupIDStr, err)
+			continue
+		}
+		payload.GroupIDs = append(payload.GroupIDs, groupID)
+	}
+	if len(payload.GroupIDs) == 0 {
+		return nil
+	}
+
+	pubSubEvt := PubSubMessage{Type: "device_keys_changed", Payload: payload, OriginServerID: h.serverID}
+	serializedEvt, err := json.Marshal(pubSubEvt)
+	if err != nil {
+		return fmt.Errorf("error marshalling device_keys_changed event: %w", err)
+	}
+	return h.redisClient.Publish(ctx, pubSubGroupEventsChannel, serializedEvt).Err()
+}
+
+// handleGroupClientEvent hands an event to the group's local clients, or only
+// to those connected from one of the payload's recipient devices.
+func (h *Hub) handleGroupClientEvent(payload GroupClientEventPayload) {
+	var recipients map[EnvelopeRecipient]bool
+	if len(payload.Recipients) > 0 {
+		recipients = make(map[EnvelopeRecipient]bool, len(payload.Recipients))
+		for _, recipient := range payload.Recipients {
+			recipients[recipient] = true
+		}
+	}
+
+	h.mutex.RLock()
+	group, ok := h.Groups[payload.GroupID]
+	h.mutex.RUnlock()
+	if !ok {
+		return
+	}
+
+	event := payload.Event
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	for _, client := range group.Clients {
+		if recipients == nil || recipients[EnvelopeRecipient{UserID: client.User.ID, DeviceID: client.deviceID}] {
+			client.SendEvent(&event)
+		}
+	}
+}
+
+// PublishGroupClientEvent sends an event to the group's clients on every
+// instance. With recipients set only clients connected from those devices get
+// it; device identifiers are only unique per user, so each names its user.
+func (h *Hub) PublishGroupClientEvent(ctx context.Context, groupID uuid.UUID, recipients []EnvelopeRecipient, event ServerEvent) error {
+	payload := GroupClientEventPayload{GroupID: groupID, Recipients: recipients, Event: event}
+	pubSubEvt := PubSubMessage{Type: "group_client_event", Payload: payload, OriginServerID: h.serverID}
+	serializedEvt, err := json.Marshal(pubSubEvt)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s event: %w", event.Type, err)
+	}
+	return h.redisClient.Publish(ctx, pubSubGroupEventsChannel, serializedEvt).Err()
+}
+
+// handleUserClientEvent hands an event to the user's local connection if it
+// was opened from the payload's device.
+func (h *Hub) handleUserClientEvent(payload UserClientEventPayload) {
+	h.mutex.RLock()
+	client, ok := h.Clients[payload.UserID]
+	h.mutex.RUnlock()
+
+	if !ok || (payload.DeviceID != "" && client.deviceID != payload.DeviceID) {
+		return
+	}
+	event := payload.Event
+	client.SendEvent(&event)
+}
+
+// PublishUserClientEvent sends an event to the user's live connection, or only
+// to a connection from deviceID when it is set. Like DisconnectRevokedClient
+// it finds the instance through the client presence key; offline users are
+// skipped.
+func (h *Hub) PublishUserClientEvent(ctx context.Context, userID uuid.UUID, deviceID string, event ServerEvent) error {
+	clientKey := redisClientServerPrefix + userID.String() + ":server_id"
+	serverID, err := h.redisClient.Get(ctx, clientKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up server for client %s: %w", userID.String(), err)
+	}
+
+	payload := UserClientEventPayload{UserID: userID, DeviceID: deviceID, Event: event}
+	if serverID == h.serverID {
+		h.handleUserClientEvent(payload)
+		return nil
+	}
+
+	pubSubEvt := PubSubMessage{Type: "user_client_event", Payload: payload, OriginServerID: h.serverID}
+	serializedEvt, err := json.Marshal(pubSubEvt)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s event: %w", event.Type, err)
+	}
+	return h.redisClient.Publish(ctx, pubSubServerEventsChannel+":"+serverID, serializedEvt).Err()
+}
+
+// NotifyUserLeftGroup updates Redis membership and peers after a committed
+// LeaveGroupTx, deleting the group's hub state when it was emptied.
+func (h *Hub) NotifyUserLeftGroup(ctx context.Context, userID uuid.UUID, groupID uuid.UUID, groupDeleted bool) {
+	select {
+	case h.RemoveUserFromGroupChan <- &RemoveClientFromGroupMsg{UserID: userID, GroupID: groupID}:
+		log.Printf("Sent request to hub to process user %d removal from group %d state", userID, groupID)
+	case <-ctx.Done():
+		log.Printf("Context cancelled while trying to send RemoveUserFromGroupChan for user %d, group %d", userID, groupID)
+		return
+	default:
+		log.Printf("Warning: Hub RemoveUserFromGroupChan full for user %d group %d. Update might be delayed or dropped.", userID, groupID)
+	}
+
+	if groupDeleted {
+		select {
+		case h.DeleteHubGroupChan <- &DeleteHubGroupMsg{GroupID: groupID}:
+			log.Printf("Sent request to hub to delete empty group %d state", groupID)
+		case <-ctx.Done():
+			log.Printf("Context cancelled while trying to send DeleteHubGroupChan for group %d", groupID)
+		default:
+			log.Printf("Warning: Hub DeleteHubGroupChan full for group %d. Deletion might be delayed or dropped.", groupID)
+		}
+	}
+}
+
+// ClearUserGroups drops the user's group membership set from Redis, e.g. once
+// their account is deleted.
+func (h *Hub) ClearUserGroups(ctx context.Context, userID uuid.UUID) error {
+	return h.redisClient.Del(ctx, redisUserGroupsPrefix+userID.String()+":groups").Err()
+}
+
+// saveMessage stores a message together with its per-device envelopes.
+func (h *Hub) saveMessage(params db.InsertMessageParams, envelopes []db.InsertMessageEnvelopeParams) (db.InsertMessageRow, error) {
+	tx, err := h.pgxPool.Begin(h.ctx)
+	if err != nil {
+		return db.InsertMessageRow{}, err
+	}
+	defer tx.Rollback(h.ctx)
+
+	qtx := h.db.WithTx(tx)
+	savedMessage, err := qtx.InsertMessage(h.ctx, params)
+	if err != nil {
+		return db.InsertMessageRow{}, err
+	}
+	for _, envelope := range envelopes {
+		if err := qtx.InsertMessageEnvelope(h.ctx, envelope); err != nil {
+			return db.InsertMessageRow{}, err
+		}
+	}
+	return savedMessage, tx.Commit(h.ctx)
+}
+
 func (h *Hub) Run() {
 	log.Printf("Hub %s Run loop started", h.serverID)
 	refreshDuration := 30 * time.Second
@@ -498,23 +811,33 @@ func (h *Hub) Run() {
 				continue
 			}
 
-			keyEnvelopesJSON, err := json.Marshal(message.Envelopes)
+			envelopes, err := envelopeParams(message.ID, message.Envelopes)
 			if err != nil {
-				log.Printf("Error marshalling key_envelopes for message in group %s: %v", message.GroupID, err)
+				log.Printf("Error decoding envelopes for message in group %s: %v", message.GroupID, err)
 				continue
 			}
 
+			var mlsEpoch pgtype.Int8
+			if message.MLSEpoch != nil {
+				mlsEpoch = pgtype.Int8{Int64: *message.MLSEpoch, Valid: true}
+			}
+
 			insertParams := db.InsertMessageParams{
-				ID:           message.ID,
-				UserID:       &message.SenderID,
-				GroupID:      &message.GroupID,
-				Ciphertext:   cipherBytes,
-				MessageType:  message.MessageType,
-				MsgNonce:     nonceBytes,
-				KeyEnvelopes: keyEnvelopesJSON,
+				ID:          message.ID,
+				UserID:      &message.SenderID,
+				GroupID:     &message.GroupID,
+				Ciphertext:  cipherBytes,
+				MessageType: message.MessageType,
+				MsgNonce:    nonceBytes,
+				SenderKeyID: message.SenderKeyID,
+				MlsEpoch:    mlsEpoch,
+				SenderDeviceID: pgtype.Text{
+					String: message.SenderDeviceID,
+					Valid:  message.SenderDeviceID != "",
+				},
 			}
 
-			savedMessage, err := h.db.InsertMessage(h.ctx, insertParams)
+			savedMessage, err := h.saveMessage(insertParams, envelopes)
 			if err != nil {
 				log.Printf("Error saving E2EE message: %v", err)
 				continue
@@ -0,0 +1,119 @@
+package ws
+
+import (
+	"bytes"
+	"chat-app-server/db"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// messageChange is an edit or tombstone at its position in (changed_at, id)
+// order, where changed_at is updated_at for edits and deleted_at for
+// tombstones.
+type messageChange struct {
+	position messageCursor
+	message  RawMessageE2EE
+}
+
+func changeBefore(a messageCursor, b messageCursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return bytes.Compare(a.ID[:], b.ID[:]) < 0
+}
+
+// takeMessageChanges merges edits and tombstones, each already in position
+// order, and keeps the first limit of them. It returns the kept ones split
+// back by kind, the position of the last one kept (nil if none) and whether
+// any were left over.
+func takeMessageChanges(edits []messageChange, tombstones []messageChange, limit int) ([]RawMessageE2EE, []RawMessageE2EE, *messageCursor, bool) {
+	keptEdits := []RawMessageE2EE{}
+	keptTombstones := []RawMessageE2EE{}
+	var last *messageCursor
+	i, j := 0, 0
+	for taken := 0; taken < limit && (i < len(edits) || j < len(tombstones)); taken++ {
+		if j == len(tombstones) || (i < len(edits) && changeBefore(edits[i].position, tombstones[j].position)) {
+			keptEdits = append(keptEdits, edits[i].message)
+			last = &edits[i].position
+			i++
+		} else {
+			keptTombstones = append(keptTombstones, tombstones[j].message)
+			last = &tombstones[j].position
+			j++
+		}
+	}
+	return keptEdits, keptTombstones, last, i < len(edits) || j < len(tombstones)
+}
+
+// addMessageChanges fills in the edits and tombstones of messages up to since
+// that changed after changedAfter, at most limit of them, and the watermark
+// the client passes back as ?changes_since=. The watermark only moves past
+// changes the page actually holds, so a quiet group gets nothing twice and a
+// busy one is caught up over several pages.
+func (h *Handler) addMessageChanges(ctx context.Context, page *MessagePage, params db.GetRelevantMessagesParams, since messageCursor, changedAfter messageCursor, limit int32) error {
+	dbTombstones, err := h.db.GetMessageTombstones(ctx, db.GetMessageTombstonesParams{
+		UserID:          &params.UserID,
+		ChangedAfter:    changedAfter.Timestamp(),
+		ChangedAfterID:  changedAfter.ID,
+		GroupID:         params.GroupID,
+		CursorCreatedAt: since.Timestamp(),
+		CursorID:        since.ID,
+		MaxChanges:      limit + 1,
+	})
+	if err != nil {
+		return err
+	}
+	tombstones := make([]messageChange, 0, len(dbTombstones))
+	for _, dbTombstone := range dbTombstones {
+		tombstones = append(tombstones, messageChange{
+			position: newMessageCursor(dbTombstone.DeletedAt, dbTombstone.ID),
+			message:  toTombstone(dbTombstone),
+		})
+	}
+
+	dbEdits, err := h.db.GetEditedMessages(ctx, db.GetEditedMessagesParams{
+		UserID:          &params.UserID,
+		DeviceID:        params.DeviceID,
+		ChangedAfter:    changedAfter.Timestamp(),
+		ChangedAfterID:  changedAfter.ID,
+		GroupID:         params.GroupID,
+		CursorCreatedAt: since.Timestamp(),
+		CursorID:        since.ID,
+		MaxChanges:      limit + 1,
+	})
+	if err != nil {
+		return err
+	}
+	edits := make([]messageChange, 0, len(dbEdits))
+	for _, dbEdit := range dbEdits {
+		edits = append(edits, messageChange{
+			position: newMessageCursor(dbEdit.UpdatedAt, dbEdit.ID),
+			message:  toRawMessage(db.GetRelevantMessagesRow(dbEdit), params.UserID, params.DeviceID),
+		})
+	}
+
+	var last *messageCursor
+	var more bool
+	page.Edits, page.Tombstones, last, more = takeMessageChanges(edits, tombstones, int(limit))
+	if last == nil {
+		last = &changedAfter
+	}
+	changesCursor := last.String()
+	page.ChangesCursor = &changesCursor
+	page.HasMore = page.HasMore || more
+	return nil
+}
+
+// startMessageChanges gives a sync without ?since= its first watermark. Its
+// messages come in their current versions, so only changes made from now on
+// matter.
+func (h *Handler) startMessageChanges(ctx context.Context, page *MessagePage) error {
+	now, err := h.db.GetCurrentTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	changesCursor := newMessageCursor(now, uuid.Nil).String()
+	page.ChangesCursor = &changesCursor
+	return nil
+}
@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTakeMessageChanges(t *testing.T) {
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	change := func(seconds int, id string) messageChange {
+		messageID := uuid.MustParse(id)
+		return messageChange{
+			position: messageCursor{CreatedAt: base.Add(time.Duration(seconds) * time.Second), ID: messageID},
+			message:  RawMessageE2EE{ID: messageID},
+		}
+	}
+	a := "00000000-0000-0000-0000-00000000000a"
+	b := "00000000-0000-0000-0000-00000000000b"
+	c := "00000000-0000-0000-0000-00000000000c"
+
+	tests := []struct {
+		name           string
+		edits          []messageChange
+		tombstones     []messageChange
+		limit          int
+		wantEdits      []string
+		wantTombstones []string
+		wantLast       *messageChange
+		wantMore       bool
+	}{
+		{
+			name:  "nothing changed",
+			limit: 10,
+		},
+		{
+			name:           "interleaved within the limit",
+			edits:          []messageChange{change(1, a), change(3, c)},
+			tombstones:     []messageChange{change(2, b)},
+			limit:          10,
+			wantEdits:      []string{a, c},
+			wantTombstones: []string{b},
+			wantLast:       &messageChange{position: change(3, c).position},
+		},
+		{
+			name:           "cut at the limit",
+			edits:          []messageChange{change(1, a), change(3, c)},
+			tombstones:     []messageChange{change(2, b)},
+			limit:          2,
+			wantEdits:      []string{a},
+			wantTombstones: []string{b},
+			wantLast:       &messageChange{position: change(2, b).position},
+			wantMore:       true,
+		},
+		{
+			name:           "same time ordered by id",
+			edits:          []messageChange{change(1, b)},
+			tombstones:     []messageChange{change(1, a)},
+			limit:          1,
+			wantTombstones: []string{a},
+			wantLast:       &messageChange{position: change(1, a).position},
+			wantMore:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, tombstones, last, more := takeMessageChanges(tt.edits, tt.tombstones, tt.limit)
+			if got := messageIDs(edits); !slices.Equal(got, tt.wantEdits) {
+				t.Errorf("edits = %v, want %v", got, tt.wantEdits)
+			}
+			if got := messageIDs(tombstones); !slices.Equal(got, tt.wantTombstones) {
+				t.Errorf("tombstones = %v, want %v", got, tt.wantTombstones)
+			}
+			switch {
+			case tt.wantLast == nil && last != nil:
+				t.Errorf("last = %v, want nil", *last)
+			case tt.wantLast != nil && (last == nil || *last != tt.wantLast.position):
+				t.Errorf("last = %v, want %v", last, tt.wantLast.position)
+			}
+			if more != tt.wantMore {
+				t.Errorf("more = %v, want %v", more, tt.wantMore)
+			}
+		})
+	}
+}
+
+func messageIDs(messages []RawMessageE2EE) []string {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID.String())
+	}
+	return ids
+}
@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultMessagesPerPage = 100
+	maxMessagesPerPage     = 500
+)
+
+var errInvalidMessageCursor = errors.New("invalid message cursor")
+
+// messageCursor is a position in (created_at, id) order. Clients get it as an
+// opaque string and hand it back unchanged. The changes watermark uses the
+// same encoding for a position in (changed_at, id) order.
+type messageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func newMessageCursor(createdAt pgtype.Timestamp, id uuid.UUID) messageCursor {
+	return messageCursor{CreatedAt: createdAt.Time, ID: id}
+}
+
+// String encodes the cursor as base64url of "<unix microseconds>_<id>";
+// created_at has microsecond precision, so the position survives the round
+// trip exactly.
+func (mc messageCursor) String() string {
+	raw := strconv.FormatInt(mc.CreatedAt.UnixMicro(), 10) + "_" + mc.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (mc messageCursor) Timestamp() pgtype.Timestamp {
+	return pgtype.Timestamp{Time: mc.CreatedAt, Valid: true}
+}
+
+func parseMessageCursor(encoded string) (messageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return messageCursor{}, errInvalidMessageCursor
+	}
+	micros, id, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return messageCursor{}, errInvalidMessageCursor
+	}
+	unixMicro, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return messageCursor{}, errInvalidMessageCursor
+	}
+	messageID, err := uuid.Parse(id)
+	if err != nil {
+		return messageCursor{}, errInvalidMessageCursor
+	}
+	return messageCursor{CreatedAt: time.UnixMicro(unixMicro).UTC(), ID: messageID}, nil
+}
+
+// messageCursorFromQuery parses an optional cursor query parameter. It
+// responds itself on error.
+func messageCursorFromQuery(c *gin.Context, param string) (*messageCursor, bool) {
+	value := c.Query(param)
+	if value == "" {
+		return nil, true
+	}
+	cursor, err := parseMessageCursor(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+		return nil, false
+	}
+	return &cursor, true
+}
+
+// messagePageSize reads ?limit=, defaulting to defaultMessagesPerPage and
+// capping it at maxMessagesPerPage. It responds itself on error.
+func messagePageSize(c *gin.Context) (int32, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultMessagesPerPage)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return 0, false
+	}
+	return int32(min(limit, maxMessagesPerPage)), true
+}
@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	id := uuid.MustParse("0b8f6a36-4e6c-4f55-9d8c-3f1e5b2a7c10")
+	tests := []time.Time{
+		time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC),
+		time.Date(1999, 12, 31, 23, 59, 59, 999999000, time.UTC),
+		time.Unix(0, 0).UTC(),
+		time.Date(1960, 1, 1, 0, 0, 0, 1000, time.UTC),
+	}
+	for _, createdAt := range tests {
+		cursor := newMessageCursor(pgtype.Timestamp{Time: createdAt, Valid: true}, id)
+		parsed, err := parseMessageCursor(cursor.String())
+		if err != nil {
+			t.Fatalf("parseMessageCursor(%s): %v", cursor, err)
+		}
+		if !parsed.CreatedAt.Equal(createdAt) || parsed.ID != id {
+			t.Errorf("round trip of (%s, %s) = (%s, %s)", createdAt, id, parsed.CreatedAt, parsed.ID)
+		}
+		if ts := parsed.Timestamp(); !ts.Valid || !ts.Time.Equal(createdAt) {
+			t.Errorf("Timestamp() = %v, want %s", ts, createdAt)
+		}
+	}
+}
+
+func TestParseMessageCursorRejects(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	id := "0b8f6a36-4e6c-4f55-9d8c-3f1e5b2a7c10"
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64url", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("1_" + id))},
+		{"no separator", encode("1709296245123456" + id)},
+		{"non-numeric time", encode("yesterday_" + id)},
+		{"time overflows int64", encode("99999999999999999999_" + id)},
+		{"bad id", encode("1709296245123456_not-a-uuid")},
+		{"missing id", encode("1709296245123456_")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseMessageCursor(tt.cursor); err != errInvalidMessageCursor {
+				t.Errorf("parseMessageCursor(%q) error = %v, want %v", tt.cursor, err, errInvalidMessageCursor)
+			}
+		})
+	}
+}
+
+func testContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return c, recorder
+}
+
+func TestMessageCursorFromQuery(t *testing.T) {
+	cursor := messageCursor{
+		CreatedAt: time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC),
+		ID:        uuid.MustParse("0b8f6a36-4e6c-4f55-9d8c-3f1e5b2a7c10"),
+	}
+
+	c, _ := testContext("/messages")
+	if got, ok := messageCursorFromQuery(c, "before"); !ok || got != nil {
+		t.Errorf("missing cursor = %v, %v; want nil, true", got, ok)
+	}
+
+	c, _ = testContext("/messages?before=" + cursor.String())
+	got, ok := messageCursorFromQuery(c, "before")
+	if !ok || got == nil || *got != cursor {
+		t.Errorf("valid cursor = %v, %v; want %v, true", got, ok, cursor)
+	}
+
+	c, recorder := testContext("/messages?before=garbage!")
+	if _, ok := messageCursorFromQuery(c, "before"); ok {
+		t.Error("invalid cursor was accepted")
+	}
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMessagePageSize(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantLimit  int32
+		wantStatus int
+	}{
+		{"", defaultMessagesPerPage, http.StatusOK},
+		{"?limit=1", 1, http.StatusOK},
+		{"?limit=50", 50, http.StatusOK},
+		{"?limit=500", maxMessagesPerPage, http.StatusOK},
+		{"?limit=1000", maxMessagesPerPage, http.StatusOK},
+		{"?limit=", 0, http.StatusBadRequest},
+		{"?limit=0", 0, http.StatusBadRequest},
+		{"?limit=-1", 0, http.StatusBadRequest},
+		{"?limit=abc", 0, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, recorder := testContext("/messages" + tt.query)
+			limit, ok := messagePageSize(c)
+			if ok != (tt.wantStatus == http.StatusOK) || limit != tt.wantLimit {
+				t.Errorf("messagePageSize = %d, %v; want %d", limit, ok, tt.wantLimit)
+			}
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
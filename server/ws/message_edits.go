@@ -0,0 +1,198 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultMessageEditWindow = 15 * time.Minute
+
+	invalidEditCode       = "invalid_edit"
+	messageNotFoundCode   = "message_not_found"
+	messageDeletedCode    = "message_deleted"
+	editNotAllowedCode    = "edit_not_allowed"
+	editWindowExpiredCode = "edit_window_expired"
+)
+
+// messageEditWindowFromEnv reads MESSAGE_EDIT_WINDOW as a Go duration such as
+// "15m" or "24h". Zero lets senders edit their messages at any time.
+func messageEditWindowFromEnv() time.Duration {
+	value := os.Getenv("MESSAGE_EDIT_WINDOW")
+	if value == "" {
+		return defaultMessageEditWindow
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		log.Printf("Invalid MESSAGE_EDIT_WINDOW %q, using %s", value, defaultMessageEditWindow)
+		return defaultMessageEditWindow
+	}
+	return window
+}
+
+func messageActionRejected(code string, message string, messageID uuid.UUID) *ServerEvent {
+	return &ServerEvent{
+		Type:    "error",
+		Message: message,
+		Payload: &MessageActionRejectedPayload{Code: code, MessageID: messageID},
+	}
+}
+
+// EditMessage replaces the content of one of the sender's messages with a new
+// ciphertext, keeping the previous version and its envelopes in
+// message_edits. The new content goes through the same key checks as a new
+// message in the group. A non-nil event is an error frame for the sender.
+func (h *Hub) EditMessage(ctx context.Context, senderID uuid.UUID, senderDeviceID string, edit *ClientSentE2EMessage) (*ServerEvent, error) {
+	cipherBytes, err := base64.StdEncoding.DecodeString(edit.Ciphertext)
+	if err != nil {
+		return messageActionRejected(invalidEditCode, "Invalid ciphertext encoding", edit.ID), nil
+	}
+	nonceBytes, err := base64.StdEncoding.DecodeString(edit.MsgNonce)
+	if err != nil {
+		return messageActionRejected(invalidEditCode, "Invalid msgNonce encoding", edit.ID), nil
+	}
+
+	tx, err := h.pgxPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+	original, err := qtx.LockMessage(ctx, edit.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return messageActionRejected(messageNotFoundCode, "Message not found", edit.ID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if original.DeletedAt.Valid {
+		return messageActionRejected(messageDeletedCode, "Message was deleted", edit.ID), nil
+	}
+	if original.UserID == nil || *original.UserID != senderID || original.GroupID == nil {
+		return messageActionRejected(editNotAllowedCode, "Only the sender can edit a message", edit.ID), nil
+	}
+	if h.editWindow > 0 && time.Since(original.CreatedAt.Time) > h.editWindow {
+		return messageActionRejected(editWindowExpiredCode, "Message can no longer be edited", edit.ID), nil
+	}
+
+	isMember, err := util.UserInGroup(ctx, senderID, *original.GroupID, h.db)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return messageActionRejected(editNotAllowedCode, "Only the sender can edit a message", edit.ID), nil
+	}
+
+	edit.GroupID = *original.GroupID
+	edit.MessageType = original.MessageType
+	rejection, err := h.CheckMessageKeys(ctx, senderID, senderDeviceID, edit)
+	if err != nil || rejection != nil {
+		return rejection, err
+	}
+
+	message := newRawMessage(edit, senderID, senderDeviceID)
+	envelopes, err := envelopeParams(message.ID, message.Envelopes)
+	if err != nil {
+		return messageActionRejected(invalidEditCode, "Invalid envelope encoding", edit.ID), nil
+	}
+
+	editID, err := qtx.ArchiveMessageVersion(ctx, edit.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := qtx.ArchiveMessageEnvelopes(ctx, db.ArchiveMessageEnvelopesParams{EditID: editID, MessageID: edit.ID}); err != nil {
+		return nil, err
+	}
+	if err := qtx.DeleteMessageEnvelopes(ctx, edit.ID); err != nil {
+		return nil, err
+	}
+	for _, envelope := range envelopes {
+		if err := qtx.InsertMessageEnvelope(ctx, envelope); err != nil {
+			return nil, err
+		}
+	}
+
+	var mlsEpoch pgtype.Int8
+	if message.MLSEpoch != nil {
+		mlsEpoch = pgtype.Int8{Int64: *message.MLSEpoch, Valid: true}
+	}
+	updatedAt, err := qtx.UpdateMessageContent(ctx, db.UpdateMessageContentParams{
+		ID:          edit.ID,
+		Ciphertext:  cipherBytes,
+		MsgNonce:    nonceBytes,
+		SenderKeyID: message.SenderKeyID,
+		SenderDeviceID: pgtype.Text{
+			String: message.SenderDeviceID,
+			Valid:  message.SenderDeviceID != "",
+		},
+		MlsEpoch: mlsEpoch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	message.Timestamp = original.CreatedAt.Time.Format(time.RFC3339Nano)
+	message.EditedAt = updatedAt.Time.Format(time.RFC3339Nano)
+	if err := h.publishMessageEvent(ctx, "message_edited", message.GroupID, ChatMessagePayload{Message: message}); err != nil {
+		log.Printf("Hub %s: Error publishing edit of message %s: %v", h.serverID, message.ID, err)
+	}
+	return nil, nil
+}
+
+// publishMessageEvent fans a change to an existing message out to the
+// group's clients on every server, alongside its chat messages.
+func (h *Hub) publishMessageEvent(ctx context.Context, eventType string, groupID uuid.UUID, payload interface{}) error {
+	pubSubMsg := PubSubMessage{
+		Type:           eventType,
+		Payload:        payload,
+		OriginServerID: h.serverID,
+	}
+	serializedMsg, err := json.Marshal(pubSubMsg)
+	if err != nil {
+		return err
+	}
+	channel := pubSubGroupMessagesChannel + ":" + groupID.String()
+	return h.redisClient.Publish(ctx, channel, serializedMsg).Err()
+}
+
+// deliverMessageEvent sends a message event to the group's local clients,
+// each with only its own device's envelope.
+func (h *Hub) deliverMessageEvent(eventType string, message *RawMessageE2EE) {
+	h.mutex.RLock()
+	group, groupExists := h.Groups[message.GroupID]
+	h.mutex.RUnlock()
+
+	if !groupExists {
+		return
+	}
+
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+
+	for clientID, client := range group.Clients {
+		h.mutex.RLock()
+		_, stillConnected := h.Clients[clientID]
+		h.mutex.RUnlock()
+
+		if stillConnected {
+			clientMessage := *message
+			clientMessage.Envelopes = envelopesForDevice(message.Envelopes, client.User.ID, client.deviceID)
+			client.SendEvent(&ServerEvent{Type: eventType, Payload: &clientMessage})
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxPlaintextReactionBytes = 64
+	maxEncryptedReactionBytes = 256
+	// maxReactionsPerUser caps one user's distinct reactions to a message.
+	maxReactionsPerUser = 20
+
+	invalidReactionCode    = "invalid_reaction"
+	reactionNotAllowedCode = "reaction_not_allowed"
+	tooManyReactionsCode   = "too_many_reactions"
+)
+
+var errInvalidReaction = errors.New("invalid reaction")
+
+// validateReaction checks a reaction against the group's mode: a short
+// plaintext emoji, or a base64 encrypted payload.
+func validateReaction(reaction string, encrypted bool) error {
+	if encrypted {
+		payload, err := base64.StdEncoding.DecodeString(reaction)
+		if err != nil || len(payload) == 0 || len(payload) > maxEncryptedReactionBytes {
+			return errInvalidReaction
+		}
+		return nil
+	}
+	if reaction == "" || len(reaction) > maxPlaintextReactionBytes || !utf8.ValidString(reaction) {
+		return errInvalidReaction
+	}
+	for _, r := range reaction {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return errInvalidReaction
+		}
+	}
+	return nil
+}
+
+// ReactToMessage adds or removes the user's reaction to a message in one of
+// their groups. New reactions follow the group's encrypted_reactions setting.
+// Adding a reaction the user already has, or removing one they don't, changes
+// nothing and sends no event. A non-nil event is an error frame for the user.
+func (h *Hub) ReactToMessage(ctx context.Context, userID uuid.UUID, request *ClientReaction, add bool) (*ServerEvent, error) {
+	tx, err := h.pgxPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+	message, err := qtx.LockMessage(ctx, request.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return messageActionRejected(messageNotFoundCode, "Message not found", request.ID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if message.DeletedAt.Valid {
+		return messageActionRejected(messageDeletedCode, "Message was deleted", request.ID), nil
+	}
+	if message.GroupID == nil {
+		return messageActionRejected(reactionNotAllowedCode, "User does not belong to this group", request.ID), nil
+	}
+
+	isMember, err := util.UserInGroup(ctx, userID, *message.GroupID, qtx)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return messageActionRejected(reactionNotAllowedCode, "User does not belong to this group", request.ID), nil
+	}
+
+	event := ReactionEventPayload{
+		MessageID: request.ID,
+		GroupID:   *message.GroupID,
+		UserID:    userID,
+		Reaction:  request.Reaction,
+	}
+	eventType := "reaction_added"
+	if add {
+		group, err := qtx.GetGroupById(ctx, *message.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateReaction(request.Reaction, group.EncryptedReactions); err != nil {
+			return messageActionRejected(invalidReactionCode, "Invalid reaction", request.ID), nil
+		}
+		count, err := qtx.CountUserMessageReactions(ctx, db.CountUserMessageReactionsParams{
+			MessageID: request.ID,
+			UserID:    userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if count >= maxReactionsPerUser {
+			return messageActionRejected(tooManyReactionsCode, "Too many reactions to this message", request.ID), nil
+		}
+		added, err := qtx.InsertMessageReaction(ctx, db.InsertMessageReactionParams{
+			MessageID: request.ID,
+			UserID:    userID,
+			Reaction:  request.Reaction,
+			Encrypted: group.EncryptedReactions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if added == 0 {
+			return nil, nil
+		}
+		event.Encrypted = group.EncryptedReactions
+	} else {
+		eventType = "reaction_removed"
+		encrypted, err := qtx.DeleteMessageReaction(ctx, db.DeleteMessageReactionParams{
+			MessageID: request.ID,
+			UserID:    userID,
+			Reaction:  request.Reaction,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		event.Encrypted = encrypted
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := h.publishMessageEvent(ctx, eventType, event.GroupID, event); err != nil {
+		log.Printf("Hub %s: Error publishing %s for message %s: %v", h.serverID, eventType, request.ID, err)
+	}
+	return nil, nil
+}
+
+// deliverReactionEvent sends a reaction change to the group's local clients.
+func (h *Hub) deliverReactionEvent(eventType string, reaction *ReactionEventPayload) {
+	h.mutex.RLock()
+	group, groupExists := h.Groups[reaction.GroupID]
+	h.mutex.RUnlock()
+
+	if !groupExists {
+		return
+	}
+
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+
+	for clientID, client := range group.Clients {
+		h.mutex.RLock()
+		_, stillConnected := h.Clients[clientID]
+		h.mutex.RUnlock()
+
+		if stillConnected {
+			client.SendEvent(&ServerEvent{Type: eventType, Payload: reaction})
+		}
+	}
+}
+
+// addReactions fills in the aggregated reactions of a page of messages.
+func (h *Handler) addReactions(ctx context.Context, messages []RawMessageE2EE) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	messageIDs := make([]uuid.UUID, 0, len(messages))
+	positions := make(map[uuid.UUID]int, len(messages))
+	for i, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+		positions[message.ID] = i
+	}
+
+	reactions, err := h.db.GetReactionsForMessages(ctx, messageIDs)
+	if err != nil {
+		return err
+	}
+	for _, reaction := range reactions {
+		message := &messages[positions[reaction.MessageID]]
+		message.Reactions = append(message.Reactions, ReactionSummary{
+			Reaction:  reaction.Reaction,
+			Encrypted: reaction.Encrypted,
+			UserIDs:   reaction.UserIds,
+			Count:     len(reaction.UserIds),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package ws
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestValidateReaction(t *testing.T) {
+	encrypted := func(n int) string { return base64.StdEncoding.EncodeToString(make([]byte, n)) }
+	tests := []struct {
+		name      string
+		reaction  string
+		encrypted bool
+		wantOK    bool
+	}{
+		{"emoji", "👍", false, true},
+		{"emoji sequence", "👩‍👩‍👧", false, true},
+		{"shortcode", ":thumbsup:", false, true},
+		{"at plaintext limit", strings.Repeat("a", maxPlaintextReactionBytes), false, true},
+		{"over plaintext limit", strings.Repeat("a", maxPlaintextReactionBytes+1), false, false},
+		{"empty plaintext", "", false, false},
+		{"space", "thumbs up", false, false},
+		{"newline", "👍\n", false, false},
+		{"control character", "a\x00", false, false},
+		{"invalid UTF-8", "\xff", false, false},
+		{"ciphertext", encrypted(48), true, true},
+		{"at encrypted limit", encrypted(maxEncryptedReactionBytes), true, true},
+		{"over encrypted limit", encrypted(maxEncryptedReactionBytes + 1), true, false},
+		{"empty ciphertext", "", true, false},
+		{"plaintext in encrypted group", "👍", true, false},
+		{"base64url ciphertext", "-_-_", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateReaction(tt.reaction, tt.encrypted)
+			if (err == nil) != tt.wantOK {
+				t.Errorf("validateReaction(%q, %v) = %v, want ok %v", tt.reaction, tt.encrypted, err, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const deleteNotAllowedCode = "delete_not_allowed"
+
+// DeleteMessage deletes a message for everyone on behalf of its sender or a
+// group admin. The message row is kept as a tombstone without content, and
+// its envelopes, earlier versions and reactions are removed. Deleting a
+// tombstone again does nothing. A non-nil event is an error frame for the
+// requester.
+func (h *Hub) DeleteMessage(ctx context.Context, userID uuid.UUID, messageID uuid.UUID) (*ServerEvent, error) {
+	tx, err := h.pgxPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+	original, err := qtx.LockMessage(ctx, messageID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return messageActionRejected(messageNotFoundCode, "Message not found", messageID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if original.DeletedAt.Valid {
+		return nil, nil
+	}
+	if original.GroupID == nil {
+		return messageActionRejected(deleteNotAllowedCode, "Only the sender or a group admin can delete a message", messageID), nil
+	}
+
+	membership, err := qtx.GetUserGroupByGroupIDAndUserID(ctx, db.GetUserGroupByGroupIDAndUserIDParams{
+		UserID:  &userID,
+		GroupID: original.GroupID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return messageActionRejected(deleteNotAllowedCode, "Only the sender or a group admin can delete a message", messageID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	isSender := original.UserID != nil && *original.UserID == userID
+	if !isSender && !membership.Admin {
+		return messageActionRejected(deleteNotAllowedCode, "Only the sender or a group admin can delete a message", messageID), nil
+	}
+
+	if err := qtx.DeleteMessageEnvelopes(ctx, messageID); err != nil {
+		return nil, err
+	}
+	if err := qtx.DeleteMessageEdits(ctx, messageID); err != nil {
+		return nil, err
+	}
+	if err := qtx.DeleteMessageReactions(ctx, messageID); err != nil {
+		return nil, err
+	}
+	deletedAt, err := qtx.TombstoneMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	tombstone := &RawMessageE2EE{
+		ID:          messageID,
+		GroupID:     *original.GroupID,
+		MessageType: original.MessageType,
+		Timestamp:   original.CreatedAt.Time.Format(time.RFC3339Nano),
+		Envelopes:   []Envelope{},
+		DeletedAt:   deletedAt.Time.Format(time.RFC3339Nano),
+	}
+	if original.UserID != nil {
+		tombstone.SenderID = *original.UserID
+	}
+	if err := h.publishMessageEvent(ctx, "message_deleted", tombstone.GroupID, ChatMessagePayload{Message: tombstone}); err != nil {
+		log.Printf("Hub %s: Error publishing deletion of message %s: %v", h.serverID, messageID, err)
+	}
+	return nil, nil
+}
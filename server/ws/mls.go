@@ -0,0 +1,541 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// The server is the MLS (RFC 9420) delivery service for groups that opt in:
+// it stores KeyPackages, orders Commits per epoch and delivers Welcomes. It
+// never sees group secrets; application messages still go through the hub,
+// tagged with their epoch.
+
+const (
+	maxMLSKeyPackagesPerDevice = 200
+	maxMLSCommitsPerPage       = 100
+)
+
+// mlsGroupMember resolves the :groupID param and checks the user is in the
+// group. It responds itself on error.
+func (h *Handler) mlsGroupMember(c *gin.Context, userID uuid.UUID) (uuid.UUID, bool) {
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return groupID, false
+	}
+	isMember, err := util.UserInGroup(c.Request.Context(), userID, groupID, h.db)
+	if err != nil {
+		log.Printf("Error checking membership of user %s in group %s: %v", userID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group membership"})
+		return groupID, false
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this group"})
+		return groupID, false
+	}
+	return groupID, true
+}
+
+// EnableMLS switches a group to MLS at epoch 0. Only admins can do it and it
+// can't be undone; the admin's client is expected to create the MLS group and
+// add the other members with the first Commit.
+func (h *Handler) EnableMLS(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	userGroup, err := h.db.GetUserGroupByGroupIDAndUserID(ctx, db.GetUserGroupByGroupIDAndUserIDParams{
+		UserID:  &user.ID,
+		GroupID: &groupID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this group"})
+		} else {
+			log.Printf("Error checking admin status of user %s in group %s: %v", user.ID, groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user permissions"})
+		}
+		return
+	}
+	if !userGroup.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User does not have admin privileges for this group"})
+		return
+	}
+
+	enabled, err := h.db.EnableMLSGroup(ctx, groupID)
+	if err != nil {
+		log.Printf("Error enabling MLS for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable MLS"})
+		return
+	}
+	if enabled == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Group already uses MLS"})
+		return
+	}
+
+	state := MLSGroupState{GroupID: groupID, Epoch: 0}
+	if err := h.hub.PublishGroupClientEvent(ctx, groupID, nil, ServerEvent{Type: "mls_enabled", Payload: state}); err != nil {
+		log.Printf("Error publishing mls_enabled for group %s: %v", groupID, err)
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// GetMLSGroupState returns the group's current epoch, or 404 if the group
+// doesn't use MLS.
+func (h *Handler) GetMLSGroupState(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	groupID, ok := h.mlsGroupMember(c, user.ID)
+	if !ok {
+		return
+	}
+
+	mlsGroup, err := h.db.GetMLSGroup(c.Request.Context(), groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group does not use MLS"})
+		} else {
+			log.Printf("Error loading MLS state of group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load MLS group"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, MLSGroupState{GroupID: groupID, Epoch: mlsGroup.Epoch})
+}
+
+// GetMLSCommits pages through the group's Commits in epoch order, starting
+// with the one built on ?since_epoch=.
+func (h *Handler) GetMLSCommits(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	groupID, ok := h.mlsGroupMember(c, user.ID)
+	if !ok {
+		return
+	}
+	sinceEpoch, err := strconv.ParseInt(c.DefaultQuery("since_epoch", "0"), 10, 64)
+	if err != nil || sinceEpoch < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since_epoch"})
+		return
+	}
+
+	rows, err := h.db.GetMLSCommitsSince(c.Request.Context(), db.GetMLSCommitsSinceParams{
+		GroupID:    groupID,
+		SinceEpoch: sinceEpoch,
+		MaxCommits: maxMLSCommitsPerPage,
+	})
+	if err != nil {
+		log.Printf("Error loading MLS commits of group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load commits"})
+		return
+	}
+
+	commits := make([]MLSCommit, 0, len(rows))
+	for _, row := range rows {
+		commits = append(commits, toMLSCommit(row))
+	}
+	c.JSON(http.StatusOK, commits)
+}
+
+// SubmitMLSCommit accepts a Commit only if it was built on the group's current
+// epoch, so every member applies the same Commits in the same order. A
+// committer that loses the race gets 409 with the current epoch and has to
+// catch up and rebuild its Commit. Welcomes are queued for the listed devices
+// of members who are already in the group.
+func (h *Handler) SubmitMLSCommit(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Commits can only be sent from a signed-in device"})
+		return
+	}
+	groupID, ok := h.mlsGroupMember(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req MLSCommitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	commitMessage, err := base64.StdEncoding.DecodeString(req.Commit)
+	if err != nil || len(commitMessage) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid commit"})
+		return
+	}
+	var welcomeMessage []byte
+	if req.Welcome != "" {
+		welcomeMessage, err = base64.StdEncoding.DecodeString(req.Welcome)
+		if err != nil || len(welcomeMessage) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid welcome"})
+			return
+		}
+	}
+	if (welcomeMessage == nil) != (len(req.WelcomeRecipients) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A welcome needs recipients and recipients need a welcome"})
+		return
+	}
+
+	if len(req.WelcomeRecipients) > 0 {
+		devices, err := h.db.GetGroupDeviceIdentifiers(ctx, &groupID)
+		if err != nil {
+			log.Printf("Error loading devices of group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group devices"})
+			return
+		}
+		groupDevices := make(map[MLSDevice]bool, len(devices))
+		for _, device := range devices {
+			groupDevices[MLSDevice{UserID: device.UserID, DeviceID: device.DeviceIdentifier}] = true
+		}
+		for _, recipient := range req.WelcomeRecipients {
+			if !groupDevices[recipient] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Welcome recipient " + recipient.DeviceID + " is not a device of a group member"})
+				return
+			}
+		}
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for MLS commit to group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store commit"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	epoch, err := qtx.LockMLSGroupEpoch(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group does not use MLS"})
+		} else {
+			log.Printf("Error locking MLS group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store commit"})
+		}
+		return
+	}
+	if *req.Epoch != epoch {
+		c.JSON(http.StatusConflict, gin.H{"error": "Commit is not based on the current epoch", "epoch": epoch})
+		return
+	}
+
+	commit, err := qtx.InsertMLSCommit(ctx, db.InsertMLSCommitParams{
+		GroupID:        groupID,
+		Epoch:          epoch,
+		SenderID:       user.ID,
+		SenderDeviceID: deviceID,
+		CommitMessage:  commitMessage,
+	})
+	if err != nil {
+		log.Printf("Error inserting MLS commit for group %s epoch %d: %v", groupID, epoch, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store commit"})
+		return
+	}
+	if err := qtx.AdvanceMLSGroupEpoch(ctx, groupID); err != nil {
+		log.Printf("Error advancing MLS epoch of group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store commit"})
+		return
+	}
+
+	welcomeRecipients := make([]EnvelopeRecipient, 0, len(req.WelcomeRecipients))
+	for _, recipient := range req.WelcomeRecipients {
+		if err := qtx.InsertMLSWelcome(ctx, db.InsertMLSWelcomeParams{
+			GroupID:           groupID,
+			Epoch:             epoch + 1,
+			RecipientUserID:   recipient.UserID,
+			RecipientDeviceID: recipient.DeviceID,
+			WelcomeMessage:    welcomeMessage,
+		}); err != nil {
+			log.Printf("Error queueing MLS welcome for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store commit"})
+			return
+		}
+		welcomeRecipients = append(welcomeRecipients, EnvelopeRecipient{UserID: recipient.UserID, DeviceID: recipient.DeviceID})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing MLS commit for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store commit"})
+		return
+	}
+
+	if err := h.hub.PublishGroupClientEvent(ctx, groupID, nil, ServerEvent{Type: "mls_commit", Payload: toMLSCommit(commit)}); err != nil {
+		log.Printf("Error publishing mls_commit for group %s: %v", groupID, err)
+	}
+	if len(welcomeRecipients) > 0 {
+		state := MLSGroupState{GroupID: groupID, Epoch: epoch + 1}
+		if err := h.hub.PublishGroupClientEvent(ctx, groupID, welcomeRecipients, ServerEvent{Type: "mls_welcome", Payload: state}); err != nil {
+			log.Printf("Error publishing mls_welcome for group %s: %v", groupID, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, MLSGroupState{GroupID: groupID, Epoch: epoch + 1})
+}
+
+// UploadMLSKeyPackages adds one-time KeyPackages for the calling device.
+func (h *Handler) UploadMLSKeyPackages(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "KeyPackages can only be uploaded from a signed-in device"})
+		return
+	}
+
+	var req UploadMLSKeyPackagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	keyPackages := make([][]byte, 0, len(req.KeyPackages))
+	for _, encoded := range req.KeyPackages {
+		keyPackage, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(keyPackage) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key package"})
+			return
+		}
+		keyPackages = append(keyPackages, keyPackage)
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for KeyPackages of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store key packages"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	countParams := db.CountMLSKeyPackagesParams{UserID: user.ID, DeviceIdentifier: deviceID}
+	count, err := qtx.CountMLSKeyPackages(ctx, countParams)
+	if err != nil {
+		log.Printf("Error counting KeyPackages of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store key packages"})
+		return
+	}
+	if count+int64(len(keyPackages)) > maxMLSKeyPackagesPerDevice {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many unclaimed key packages for this device", "count": count})
+		return
+	}
+
+	for _, keyPackage := range keyPackages {
+		if err := qtx.InsertMLSKeyPackage(ctx, db.InsertMLSKeyPackageParams{
+			UserID:           user.ID,
+			DeviceIdentifier: deviceID,
+			KeyPackage:       keyPackage,
+		}); err != nil {
+			log.Printf("Error inserting KeyPackage for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store key packages"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing KeyPackages of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store key packages"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": count + int64(len(keyPackages))})
+}
+
+// ClaimMLSKeyPackages hands out one KeyPackage for every device of each
+// requested user, each package exactly once. Callers can claim for themselves
+// and for people they share a group with; every target is checked before
+// anything is claimed, and the claims commit together so a failed request
+// uses up no packages. Devices that have run out are listed under "missing".
+func (h *Handler) ClaimMLSKeyPackages(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req ClaimMLSKeyPackagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	for _, targetID := range req.UserIDs {
+		if targetID == user.ID {
+			continue
+		}
+		shared, err := h.db.UsersShareGroup(ctx, db.UsersShareGroupParams{UserID: &user.ID, OtherUserID: &targetID})
+		if err != nil {
+			log.Printf("Error checking shared groups for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim key packages"})
+			return
+		}
+		if !shared {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found: " + targetID.String()})
+			return
+		}
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for KeyPackage claims by user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim key packages"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	claimed := []ClaimedMLSKeyPackage{}
+	missing := []MLSDevice{}
+	for _, targetID := range req.UserIDs {
+		devices, err := qtx.GetDeviceKeysForUser(ctx, targetID)
+		if err != nil {
+			log.Printf("Error loading devices of user %s: %v", targetID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim key packages"})
+			return
+		}
+		for _, device := range devices {
+			keyPackage, err := qtx.ClaimMLSKeyPackage(ctx, db.ClaimMLSKeyPackageParams{
+				UserID:           targetID,
+				DeviceIdentifier: device.DeviceIdentifier,
+			})
+			if errors.Is(err, pgx.ErrNoRows) {
+				missing = append(missing, MLSDevice{UserID: targetID, DeviceID: device.DeviceIdentifier})
+				continue
+			}
+			if err != nil {
+				log.Printf("Error claiming KeyPackage of user %s: %v", targetID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim key packages"})
+				return
+			}
+			claimed = append(claimed, ClaimedMLSKeyPackage{
+				UserID:     targetID,
+				DeviceID:   device.DeviceIdentifier,
+				KeyPackage: base64.StdEncoding.EncodeToString(keyPackage),
+			})
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing KeyPackage claims by user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim key packages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key_packages": claimed, "missing": missing})
+}
+
+// GetMLSWelcomes returns the Welcomes waiting for the calling device.
+func (h *Handler) GetMLSWelcomes(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Welcomes can only be fetched from a signed-in device"})
+		return
+	}
+
+	rows, err := h.db.GetMLSWelcomesForDevice(c.Request.Context(), db.GetMLSWelcomesForDeviceParams{
+		RecipientUserID:   user.ID,
+		RecipientDeviceID: deviceID,
+	})
+	if err != nil {
+		log.Printf("Error loading MLS welcomes for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load welcomes"})
+		return
+	}
+
+	welcomes := make([]MLSWelcome, 0, len(rows))
+	for _, row := range rows {
+		welcomes = append(welcomes, MLSWelcome{
+			ID:        row.ID,
+			GroupID:   row.GroupID,
+			Epoch:     row.Epoch,
+			Welcome:   base64.StdEncoding.EncodeToString(row.WelcomeMessage),
+			CreatedAt: row.CreatedAt.Time,
+		})
+	}
+	c.JSON(http.StatusOK, welcomes)
+}
+
+// DeleteMLSWelcome acknowledges a Welcome once the device has joined.
+func (h *Handler) DeleteMLSWelcome(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Welcomes can only be acknowledged from a signed-in device"})
+		return
+	}
+	welcomeID, err := uuid.Parse(c.Param("welcomeID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid welcome ID"})
+		return
+	}
+
+	deleted, err := h.db.DeleteMLSWelcome(c.Request.Context(), db.DeleteMLSWelcomeParams{
+		ID:                welcomeID,
+		RecipientUserID:   user.ID,
+		RecipientDeviceID: deviceID,
+	})
+	if err != nil {
+		log.Printf("Error deleting MLS welcome %s: %v", welcomeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete welcome"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Welcome not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Welcome deleted"})
+}
+
+func toMLSCommit(row db.MlsCommit) MLSCommit {
+	return MLSCommit{
+		GroupID:        row.GroupID,
+		Epoch:          row.Epoch,
+		SenderID:       row.SenderID,
+		SenderDeviceID: row.SenderDeviceID,
+		Commit:         base64.StdEncoding.EncodeToString(row.CommitMessage),
+		CreatedAt:      row.CreatedAt.Time,
+	}
+}
@@ -0,0 +1,340 @@
+package ws
+
+import (
+	"chat-app-server/auth"
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Devices publish an X3DH signed prekey, signed by the user's identity key,
+// and a supply of one-time prekeys. Initiators claim a bundle per device so
+// envelopes no longer depend only on the static device key; each one-time
+// prekey is handed out once and the device is told when to top up.
+
+const (
+	prekeyPublicKeySize        = 32
+	maxOneTimePrekeysPerDevice = 500
+	oneTimePrekeyLowWatermark  = 20
+)
+
+// UploadPrekeys replaces the calling device's signed prekey and adds
+// one-time prekeys. The signed prekey must verify against the account's
+// identity key; one-time prekey IDs must not repeat an unclaimed one.
+func (h *Handler) UploadPrekeys(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prekeys can only be uploaded from a signed-in device"})
+		return
+	}
+
+	var req UploadPrekeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.SignedPrekey == nil && len(req.OneTimePrekeys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to upload"})
+		return
+	}
+
+	var signedParams *db.UpsertSignedPrekeyParams
+	if req.SignedPrekey != nil {
+		publicKey, ok := decodePrekey(req.SignedPrekey.PublicKey)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signed prekey"})
+			return
+		}
+		identityKey, err := h.db.GetUserIdentityKey(ctx, user.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Account has no identity key"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading identity key of user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+			return
+		}
+		signature, err := auth.VerifySignedPrekeySignature(
+			ed25519.PublicKey(identityKey.PublicKey),
+			deviceID,
+			req.SignedPrekey.KeyID,
+			publicKey,
+			req.SignedPrekey.Signature,
+		)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		signedParams = &db.UpsertSignedPrekeyParams{
+			UserID:           user.ID,
+			DeviceIdentifier: deviceID,
+			KeyID:            req.SignedPrekey.KeyID,
+			PublicKey:        publicKey,
+			Signature:        signature,
+		}
+	}
+
+	oneTimeParams := make([]db.InsertOneTimePrekeyParams, 0, len(req.OneTimePrekeys))
+	for _, prekey := range req.OneTimePrekeys {
+		publicKey, ok := decodePrekey(prekey.PublicKey)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid one-time prekey"})
+			return
+		}
+		oneTimeParams = append(oneTimeParams, db.InsertOneTimePrekeyParams{
+			UserID:           user.ID,
+			DeviceIdentifier: deviceID,
+			KeyID:            prekey.KeyID,
+			PublicKey:        publicKey,
+		})
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for prekeys of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	countParams := db.CountOneTimePrekeysParams{UserID: user.ID, DeviceIdentifier: deviceID}
+	count, err := qtx.CountOneTimePrekeys(ctx, countParams)
+	if err != nil {
+		log.Printf("Error counting one-time prekeys of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+		return
+	}
+	if count+int64(len(oneTimeParams)) > maxOneTimePrekeysPerDevice {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many unclaimed one-time prekeys for this device", "count": count})
+		return
+	}
+
+	if signedParams != nil {
+		if err := qtx.UpsertSignedPrekey(ctx, *signedParams); err != nil {
+			log.Printf("Error storing signed prekey for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+			return
+		}
+	}
+	for _, params := range oneTimeParams {
+		inserted, err := qtx.InsertOneTimePrekey(ctx, params)
+		if err != nil {
+			log.Printf("Error inserting one-time prekey for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+			return
+		}
+		if inserted == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Duplicate one-time prekey ID", "key_id": params.KeyID})
+			return
+		}
+	}
+
+	status, err := prekeyStatus(ctx, qtx, user.ID, deviceID)
+	if err != nil {
+		log.Printf("Error loading prekey status of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing prekeys of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prekeys"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetPrekeyStatus reports the calling device's signed prekey and how many
+// one-time prekeys it has left, so clients can top up after being offline.
+func (h *Handler) GetPrekeyStatus(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prekeys can only be checked from a signed-in device"})
+		return
+	}
+
+	status, err := prekeyStatus(c.Request.Context(), h.db, user.ID, deviceID)
+	if err != nil {
+		log.Printf("Error loading prekey status of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prekeys"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ClaimPrekeyBundles hands out a prekey bundle for every device of each
+// requested user. Each one-time prekey goes to exactly one caller; devices
+// that have run out get a bundle without one and devices that never uploaded
+// a signed prekey are listed under "missing". Callers can claim for
+// themselves and for people they share a group with; every target is checked
+// before anything is claimed, and the claims commit together so a failed
+// request uses up no one-time prekeys.
+func (h *Handler) ClaimPrekeyBundles(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req ClaimPrekeyBundlesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	for _, targetID := range req.UserIDs {
+		if targetID == user.ID {
+			continue
+		}
+		shared, err := h.db.UsersShareGroup(ctx, db.UsersShareGroupParams{UserID: &user.ID, OtherUserID: &targetID})
+		if err != nil {
+			log.Printf("Error checking shared groups for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim prekeys"})
+			return
+		}
+		if !shared {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found: " + targetID.String()})
+			return
+		}
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for prekey claims by user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim prekeys"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	bundles := []PrekeyBundle{}
+	missing := []MLSDevice{}
+	for _, targetID := range req.UserIDs {
+		devices, err := qtx.GetDeviceKeysForUser(ctx, targetID)
+		if err != nil {
+			log.Printf("Error loading devices of user %s: %v", targetID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim prekeys"})
+			return
+		}
+		signedPrekeys, err := qtx.GetSignedPrekeysForUser(ctx, targetID)
+		if err != nil {
+			log.Printf("Error loading signed prekeys of user %s: %v", targetID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim prekeys"})
+			return
+		}
+		signedByDevice := make(map[string]db.DeviceSignedPrekey, len(signedPrekeys))
+		for _, signed := range signedPrekeys {
+			signedByDevice[signed.DeviceIdentifier] = signed
+		}
+
+		for _, device := range devices {
+			signed, ok := signedByDevice[device.DeviceIdentifier]
+			if !ok {
+				missing = append(missing, MLSDevice{UserID: targetID, DeviceID: device.DeviceIdentifier})
+				continue
+			}
+			bundle := PrekeyBundle{
+				UserID:    targetID,
+				DeviceID:  device.DeviceIdentifier,
+				DeviceKey: base64.StdEncoding.EncodeToString(device.PublicKey),
+				SignedPrekey: SignedPrekey{
+					KeyID:     signed.KeyID,
+					PublicKey: base64.StdEncoding.EncodeToString(signed.PublicKey),
+					Signature: base64.StdEncoding.EncodeToString(signed.Signature),
+				},
+			}
+
+			oneTime, err := qtx.ClaimOneTimePrekey(ctx, db.ClaimOneTimePrekeyParams{
+				UserID:           targetID,
+				DeviceIdentifier: device.DeviceIdentifier,
+			})
+			switch {
+			case err == nil:
+				bundle.OneTimePrekey = &OneTimePrekey{
+					KeyID:     oneTime.KeyID,
+					PublicKey: base64.StdEncoding.EncodeToString(oneTime.PublicKey),
+				}
+			case !errors.Is(err, pgx.ErrNoRows):
+				log.Printf("Error claiming one-time prekey of user %s: %v", targetID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim prekeys"})
+				return
+			}
+			bundles = append(bundles, bundle)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing prekey claims by user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim prekeys"})
+		return
+	}
+
+	for _, bundle := range bundles {
+		h.notifyPrekeysLow(ctx, bundle.UserID, bundle.DeviceID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bundles": bundles, "missing": missing})
+}
+
+// notifyPrekeysLow sends a "prekeys_low" event to the device if a claim left
+// it below the low watermark. Failures are only logged; the device also
+// checks its status when it comes back online.
+func (h *Handler) notifyPrekeysLow(ctx context.Context, userID uuid.UUID, deviceID string) {
+	status, err := prekeyStatus(ctx, h.db, userID, deviceID)
+	if err != nil {
+		log.Printf("Error loading prekey status of user %s: %v", userID, err)
+		return
+	}
+	if status.OneTimePrekeys >= oneTimePrekeyLowWatermark {
+		return
+	}
+	if err := h.hub.PublishUserClientEvent(ctx, userID, deviceID, ServerEvent{Type: "prekeys_low", Payload: status}); err != nil {
+		log.Printf("Error publishing prekeys_low event for user %s: %v", userID, err)
+	}
+}
+
+func prekeyStatus(ctx context.Context, queries *db.Queries, userID uuid.UUID, deviceID string) (PrekeyStatus, error) {
+	status := PrekeyStatus{DeviceID: deviceID, LowWatermark: oneTimePrekeyLowWatermark}
+	signed, err := queries.GetSignedPrekey(ctx, db.GetSignedPrekeyParams{UserID: userID, DeviceIdentifier: deviceID})
+	switch {
+	case err == nil:
+		status.SignedPrekeyID = &signed.KeyID
+	case !errors.Is(err, pgx.ErrNoRows):
+		return status, err
+	}
+	status.OneTimePrekeys, err = queries.CountOneTimePrekeys(ctx, db.CountOneTimePrekeysParams{
+		UserID:           userID,
+		DeviceIdentifier: deviceID,
+	})
+	return status, err
+}
+
+func decodePrekey(encoded string) ([]byte, bool) {
+	publicKey, err := base64.StdEncoding.DecodeString(encoded)
+	return publicKey, err == nil && len(publicKey) == prekeyPublicKeySize
+}
@@ -0,0 +1,222 @@
+package ws
+
+import (
+	"chat-app-server/auth"
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// currentDeviceIdentifier resolves the device the request was made from via
+// the session family in the access token.
+func (h *Handler) currentDeviceIdentifier(c *gin.Context) (string, error) {
+	claims, err := auth.GetClaims(c)
+	if err != nil {
+		return "", err
+	}
+	familyID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return "", errors.New("token has no session")
+	}
+	return h.db.GetSessionFamilyDeviceIdentifier(c.Request.Context(), familyID)
+}
+
+// UploadSenderKey stores sender key distribution messages from the calling
+// device and notifies the recipient devices. Distributions may only go to the
+// group's current devices; the sender's own device never needs one.
+func (h *Handler) UploadSenderKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sender keys can only be uploaded from a signed-in device"})
+		return
+	}
+
+	var req UploadSenderKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	isMember, err := util.UserInGroup(ctx, user.ID, req.GroupID, h.db)
+	if err != nil {
+		log.Printf("Error checking membership of user %s in group %s: %v", user.ID, req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group membership"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this group"})
+		return
+	}
+
+	devices, err := h.db.GetGroupDeviceIdentifiers(ctx, &req.GroupID)
+	if err != nil {
+		log.Printf("Error loading devices of group %s: %v", req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group devices"})
+		return
+	}
+	// Device identifiers are only unique per user, so recipients are matched
+	// on the user the distribution names as well.
+	groupDevices := make(map[EnvelopeRecipient]bool, len(devices))
+	for _, device := range devices {
+		if device.UserID == user.ID && device.DeviceIdentifier == deviceID {
+			continue
+		}
+		groupDevices[EnvelopeRecipient{UserID: device.UserID, DeviceID: device.DeviceIdentifier}] = true
+	}
+
+	distributions := make([]db.UpsertSenderKeyDistributionParams, 0, len(req.Distributions))
+	extraDevices := []EnvelopeRecipient{}
+	for _, envelope := range req.Distributions {
+		recipient := EnvelopeRecipient{UserID: envelope.UserID, DeviceID: envelope.DeviceID}
+		if !groupDevices[recipient] {
+			extraDevices = append(extraDevices, recipient)
+			continue
+		}
+		ephPubKey, ephErr := base64.StdEncoding.DecodeString(envelope.EphPubKey)
+		keyNonce, nonceErr := base64.StdEncoding.DecodeString(envelope.KeyNonce)
+		sealedKey, sealedErr := base64.StdEncoding.DecodeString(envelope.SealedKey)
+		if ephErr != nil || nonceErr != nil || sealedErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid base64 in distribution for device " + envelope.DeviceID})
+			return
+		}
+		distributions = append(distributions, db.UpsertSenderKeyDistributionParams{
+			KeyID:             req.KeyID,
+			RecipientUserID:   envelope.UserID,
+			RecipientDeviceID: envelope.DeviceID,
+			EphPubKey:         ephPubKey,
+			KeyNonce:          keyNonce,
+			SealedKey:         sealedKey,
+		})
+	}
+	if len(extraDevices) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Distributions may only be sent to other current devices of the group",
+			"extra_devices": extraDevices,
+		})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for sender key %s: %v", req.KeyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sender key"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	if err := qtx.InsertSenderKey(ctx, db.InsertSenderKeyParams{
+		ID:             req.KeyID,
+		GroupID:        req.GroupID,
+		SenderID:       user.ID,
+		SenderDeviceID: deviceID,
+	}); err != nil {
+		log.Printf("Error inserting sender key %s: %v", req.KeyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sender key"})
+		return
+	}
+	senderKey, err := qtx.GetSenderKey(ctx, req.KeyID)
+	if err != nil {
+		log.Printf("Error loading sender key %s: %v", req.KeyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sender key"})
+		return
+	}
+	if senderKey.GroupID != req.GroupID || senderKey.SenderID != user.ID || senderKey.SenderDeviceID != deviceID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sender key ID is already in use"})
+		return
+	}
+
+	recipients := make([]EnvelopeRecipient, 0, len(distributions))
+	for _, distribution := range distributions {
+		if err := qtx.UpsertSenderKeyDistribution(ctx, distribution); err != nil {
+			log.Printf("Error storing distribution of sender key %s: %v", req.KeyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sender key"})
+			return
+		}
+		recipients = append(recipients, EnvelopeRecipient{UserID: distribution.RecipientUserID, DeviceID: distribution.RecipientDeviceID})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing sender key %s: %v", req.KeyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sender key"})
+		return
+	}
+
+	if len(recipients) > 0 {
+		event := ServerEvent{Type: "sender_key_distributed", Payload: SenderKeyDistributedPayload{
+			GroupID:        req.GroupID,
+			KeyID:          req.KeyID,
+			SenderID:       user.ID,
+			SenderDeviceID: deviceID,
+		}}
+		if err := h.hub.PublishGroupClientEvent(ctx, req.GroupID, recipients, event); err != nil {
+			log.Printf("Error publishing distribution of sender key %s: %v", req.KeyID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key_id": req.KeyID, "distributed": len(recipients)})
+}
+
+// GetSenderKeyDistributions returns the distribution messages addressed to
+// the calling device, optionally only those for ?group_id=.
+func (h *Handler) GetSenderKeyDistributions(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	deviceID, err := h.currentDeviceIdentifier(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sender keys can only be fetched from a signed-in device"})
+		return
+	}
+
+	params := db.GetSenderKeyDistributionsForDeviceParams{
+		RecipientUserID:   user.ID,
+		RecipientDeviceID: deviceID,
+	}
+	if groupIDParam := c.Query("group_id"); groupIDParam != "" {
+		groupID, err := uuid.Parse(groupIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			return
+		}
+		params.GroupID = &groupID
+	}
+
+	rows, err := h.db.GetSenderKeyDistributionsForDevice(ctx, params)
+	if err != nil {
+		log.Printf("Error loading sender key distributions for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sender keys"})
+		return
+	}
+
+	distributions := make([]SenderKeyDistribution, 0, len(rows))
+	for _, row := range rows {
+		distributions = append(distributions, SenderKeyDistribution{
+			KeyID:          row.KeyID,
+			GroupID:        row.GroupID,
+			SenderID:       row.SenderID,
+			SenderDeviceID: row.SenderDeviceID,
+			EphPubKey:      base64.StdEncoding.EncodeToString(row.EphPubKey),
+			KeyNonce:       base64.StdEncoding.EncodeToString(row.KeyNonce),
+			SealedKey:      base64.StdEncoding.EncodeToString(row.SealedKey),
+			CreatedAt:      row.CreatedAt.Time,
+		})
+	}
+	c.JSON(http.StatusOK, distributions)
+}
@@ -7,11 +7,14 @@ import (
 	"github.com/google/uuid"
 )
 
+// Envelope is the message key sealed to one recipient device. Device
+// identifiers are only unique per user, so it names both.
 type Envelope struct {
-	DeviceID  string `json:"deviceId"`
-	EphPubKey string `json:"ephPubKey"` // Base64 encoded
-	KeyNonce  string `json:"keyNonce"`  // Base64 encoded
-	SealedKey string `json:"sealedKey"` // Base64 encoded
+	UserID    uuid.UUID `json:"userId"`
+	DeviceID  string    `json:"deviceId"`
+	EphPubKey string    `json:"ephPubKey"` // Base64 encoded
+	KeyNonce  string    `json:"keyNonce"`  // Base64 encoded
+	SealedKey string    `json:"sealedKey"` // Base64 encoded
 }
 
 type RawMessageE2EE struct {
@@ -23,7 +26,82 @@ type RawMessageE2EE struct {
 	Timestamp   string         `json:"timestamp"`
 	SenderID    uuid.UUID      `json:"sender_id"`
 	Envelopes   []Envelope     `json:"envelopes"`
+	// Set instead of Envelopes for messages encrypted under a sender key or,
+	// in MLS groups, as an MLS application message.
+	SenderKeyID    *uuid.UUID `json:"senderKeyId,omitempty"`
+	MLSEpoch       *int64     `json:"mlsEpoch,omitempty"`
+	SenderDeviceID string     `json:"senderDeviceId,omitempty"`
+	// Set once the message has been edited.
+	EditedAt string `json:"editedAt,omitempty"`
+	// Set on tombstones of messages deleted for everyone, which have no
+	// ciphertext, nonce or envelopes.
+	DeletedAt string `json:"deletedAt,omitempty"`
+	// Aggregated reactions, included in message listings.
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
 }
+
+// ReactionSummary is one reaction to a message and who reacted with it, in
+// the order they did. Encrypted reactions are base64 payloads the client
+// decrypts; identical emoji encrypted by different users don't aggregate.
+type ReactionSummary struct {
+	Reaction  string      `json:"reaction"`
+	Encrypted bool        `json:"encrypted"`
+	UserIDs   []uuid.UUID `json:"user_ids"`
+	Count     int         `json:"count"`
+}
+
+// MessagePage is one page of a cursor-paginated message listing. With a
+// cursor, Edits and Tombstones list messages up to it that were edited or
+// deleted after the changes watermark; ChangesCursor is the next watermark.
+type MessagePage struct {
+	Messages      []RawMessageE2EE `json:"messages"`
+	Edits         []RawMessageE2EE `json:"edits"`
+	Tombstones    []RawMessageE2EE `json:"tombstones"`
+	NextCursor    *string          `json:"next_cursor"`
+	ChangesCursor *string          `json:"changes_cursor"`
+	HasMore       bool             `json:"has_more"`
+}
+
+// GroupMessagePage is one page of a group's history. OlderCursor and
+// NewerCursor go back as ?before= and ?after= to continue either way.
+type GroupMessagePage struct {
+	Messages    []RawMessageE2EE `json:"messages"`
+	OlderCursor *string          `json:"older_cursor"`
+	NewerCursor *string          `json:"newer_cursor"`
+	HasMore     bool             `json:"has_more"`
+}
+
+// ClientFrame is decoded first from every frame a client sends to route it.
+// Chat messages have no type; "edit_message" frames carry a
+// ClientSentE2EMessage for an existing message ID and "delete_message" frames
+// a ClientDeleteMessage. "add_reaction" and "remove_reaction" frames carry a
+// ClientReaction.
+type ClientFrame struct {
+	Type string `json:"type"`
+}
+
+type ClientDeleteMessage struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// ClientReaction adds or removes the sender's reaction to message ID. In
+// groups with encrypted reactions, Reaction is the base64 encrypted payload
+// and removing it takes the same payload.
+type ClientReaction struct {
+	ID       uuid.UUID `json:"id"`
+	Reaction string    `json:"reaction"`
+}
+
+// ReactionEventPayload accompanies the "reaction_added" and
+// "reaction_removed" events.
+type ReactionEventPayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+	GroupID   uuid.UUID `json:"group_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Reaction  string    `json:"reaction"`
+	Encrypted bool      `json:"encrypted"`
+}
+
 type ClientSentE2EMessage struct {
 	ID          uuid.UUID      `json:"id" binding:"required"`
 	GroupID     uuid.UUID      `json:"group_id"`
@@ -31,6 +109,178 @@ type ClientSentE2EMessage struct {
 	Ciphertext  string         `json:"ciphertext"` // Base64 encoded
 	MessageType db.MessageType `json:"messageType"`
 	Envelopes   []Envelope     `json:"envelopes"`
+	// SenderKeyID selects sender-key mode: the ciphertext is encrypted under
+	// the sending device's sender key for the group and Envelopes is ignored.
+	SenderKeyID *uuid.UUID `json:"senderKeyId,omitempty"`
+	// MLSEpoch is required in groups that use MLS, where the ciphertext is an
+	// MLS application message for that epoch.
+	MLSEpoch *int64 `json:"mlsEpoch,omitempty"`
+}
+
+// ServerEvent is a notification pushed to a connected client alongside chat
+// messages, e.g. when a group peer's device keys change. Error frames have
+// type "error" and a human-readable Message.
+type ServerEvent struct {
+	Type    string      `json:"type"`
+	Message string      `json:"message,omitempty"`
+	Payload interface{} `json:"payload"`
+}
+
+type EnvelopeRecipient struct {
+	UserID   uuid.UUID `json:"user_id"`
+	DeviceID string    `json:"deviceId"`
+}
+
+// EnvelopeMismatchPayload accompanies the "stale_envelopes" error frame sent
+// back to a client whose message wasn't encrypted for exactly the group's
+// current devices. The client should refresh device keys, re-encrypt and
+// resend under the same message ID.
+type EnvelopeMismatchPayload struct {
+	Code           string              `json:"code"`
+	MessageID      uuid.UUID           `json:"message_id"`
+	GroupID        uuid.UUID           `json:"group_id"`
+	MissingDevices []EnvelopeRecipient `json:"missing_devices"`
+	ExtraDevices   []EnvelopeRecipient `json:"extra_devices"`
+}
+
+// MLSEpochMismatchPayload accompanies the "stale_epoch" and
+// "mls_not_enabled" error frames: the message was built for a different MLS
+// epoch than the group's (Epoch), or for MLS in a group that doesn't use it.
+type MLSEpochMismatchPayload struct {
+	Code      string    `json:"code"`
+	MessageID uuid.UUID `json:"message_id"`
+	GroupID   uuid.UUID `json:"group_id"`
+	Epoch     *int64    `json:"epoch,omitempty"`
+}
+
+// MessageActionRejectedPayload accompanies error frames rejecting an action
+// on an existing message, such as an edit, a delete or a reaction.
+type MessageActionRejectedPayload struct {
+	Code      string    `json:"code"`
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+// UploadSenderKeyRequest distributes a sender key to group devices. Each
+// distribution is an Envelope whose sealed key is the distribution message
+// (chain key and signing key) boxed to that device. Devices can be added to
+// an existing key in later uploads.
+type UploadSenderKeyRequest struct {
+	KeyID         uuid.UUID  `json:"key_id" binding:"required"`
+	GroupID       uuid.UUID  `json:"group_id" binding:"required"`
+	Distributions []Envelope `json:"distributions" binding:"required"`
+}
+
+type SenderKeyDistributedPayload struct {
+	GroupID        uuid.UUID `json:"group_id"`
+	KeyID          uuid.UUID `json:"key_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	SenderDeviceID string    `json:"sender_device_id"`
+}
+
+// SenderKeyDistribution is a distribution message addressed to the calling
+// device.
+type SenderKeyDistribution struct {
+	KeyID          uuid.UUID `json:"key_id"`
+	GroupID        uuid.UUID `json:"group_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	SenderDeviceID string    `json:"sender_device_id"`
+	EphPubKey      string    `json:"ephPubKey"` // Base64 encoded
+	KeyNonce       string    `json:"keyNonce"`  // Base64 encoded
+	SealedKey      string    `json:"sealedKey"` // Base64 encoded
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type MLSDevice struct {
+	UserID   uuid.UUID `json:"user_id" binding:"required"`
+	DeviceID string    `json:"device_id" binding:"required"`
+}
+
+type UploadMLSKeyPackagesRequest struct {
+	KeyPackages []string `json:"key_packages" binding:"required,min=1,max=100,dive,required"` // Base64 encoded
+}
+
+type ClaimMLSKeyPackagesRequest struct {
+	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1,max=100"`
+}
+
+type ClaimedMLSKeyPackage struct {
+	UserID     uuid.UUID `json:"user_id"`
+	DeviceID   string    `json:"device_id"`
+	KeyPackage string    `json:"key_package"` // Base64 encoded
+}
+
+// MLSCommitRequest submits a Commit built on Epoch. Adding members comes with
+// the Welcome for them and the devices it should be delivered to.
+type MLSCommitRequest struct {
+	Epoch             *int64      `json:"epoch" binding:"required"`
+	Commit            string      `json:"commit" binding:"required"` // Base64 encoded MLSMessage
+	Welcome           string      `json:"welcome,omitempty"`         // Base64 encoded MLSMessage
+	WelcomeRecipients []MLSDevice `json:"welcome_recipients,omitempty" binding:"dive"`
+}
+
+type MLSCommit struct {
+	GroupID        uuid.UUID `json:"group_id"`
+	Epoch          int64     `json:"epoch"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	SenderDeviceID string    `json:"sender_device_id"`
+	Commit         string    `json:"commit"` // Base64 encoded
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type MLSWelcome struct {
+	ID        uuid.UUID `json:"id"`
+	GroupID   uuid.UUID `json:"group_id"`
+	Epoch     int64     `json:"epoch"`
+	Welcome   string    `json:"welcome"` // Base64 encoded
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MLSGroupState is the payload of the "mls_enabled" and "mls_welcome" events
+// and of the group state endpoint.
+type MLSGroupState struct {
+	GroupID uuid.UUID `json:"group_id"`
+	Epoch   int64     `json:"epoch"`
+}
+
+type SignedPrekey struct {
+	KeyID     int64  `json:"key_id" binding:"min=0"`
+	PublicKey string `json:"public_key" binding:"required"` // Base64 encoded
+	Signature string `json:"signature" binding:"required"`  // Base64 encoded
+}
+
+type OneTimePrekey struct {
+	KeyID     int64  `json:"key_id" binding:"min=0"`
+	PublicKey string `json:"public_key" binding:"required"` // Base64 encoded
+}
+
+// UploadPrekeysRequest replaces the device's signed prekey and/or adds
+// one-time prekeys; either part may be left out.
+type UploadPrekeysRequest struct {
+	SignedPrekey   *SignedPrekey   `json:"signed_prekey"`
+	OneTimePrekeys []OneTimePrekey `json:"one_time_prekeys" binding:"max=100,dive"`
+}
+
+type ClaimPrekeyBundlesRequest struct {
+	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1,max=100"`
+}
+
+// PrekeyBundle is what an initiator needs to run X3DH against one device.
+// OneTimePrekey is nil once the device has run out.
+type PrekeyBundle struct {
+	UserID        uuid.UUID      `json:"user_id"`
+	DeviceID      string         `json:"device_id"`
+	DeviceKey     string         `json:"device_key"` // Base64 encoded
+	SignedPrekey  SignedPrekey   `json:"signed_prekey"`
+	OneTimePrekey *OneTimePrekey `json:"one_time_prekey"`
+}
+
+// PrekeyStatus is the payload of the "prekeys_low" event and of the prekey
+// status endpoint.
+type PrekeyStatus struct {
+	DeviceID       string `json:"device_id"`
+	SignedPrekeyID *int64 `json:"signed_prekey_id"`
+	OneTimePrekeys int64  `json:"one_time_prekeys"`
+	LowWatermark   int64  `json:"low_watermark"`
 }
 
 type CreateGroupRequest struct {
@@ -52,6 +302,9 @@ type UpdateGroupRequest struct {
 	Location    *string    `json:"location,omitempty"`
 	ImageUrl    *string    `json:"image_url,omitempty"`
 	Blurhash    *string    `json:"blurhash,omitempty"`
+	// EncryptedReactions switches new reactions in the group between
+	// plaintext emoji and encrypted payloads.
+	EncryptedReactions *bool `json:"encrypted_reactions,omitempty"`
 }
 
 type ClientGroup struct {
@@ -67,6 +320,9 @@ type ClientGroup struct {
 	UpdatedAt   time.Time         `json:"updated_at"`
 	Admin       bool              `json:"admin"`
 	GroupUsers  []ClientGroupUser `json:"group_users"`
+	// EncryptedReactions says whether new reactions must be encrypted
+	// payloads rather than plaintext emoji.
+	EncryptedReactions bool `json:"encrypted_reactions"`
 }
 
 type UpdateGroupResponse struct {